@@ -3,23 +3,25 @@ package main
 // 1
 import (
 	"context"
+	"errors"
 
-	"encoding/json"
-
-	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
-
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/aniket0951/testproject/config"
+	"github.com/aniket0951/testproject/controllers"
 	dbconfig "github.com/aniket0951/testproject/db-config"
+	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/jobs"
+	"github.com/aniket0951/testproject/logger"
 	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/notifier"
 	"github.com/aniket0951/testproject/proxyapis"
 	"github.com/aniket0951/testproject/repositories"
 	"github.com/aniket0951/testproject/services"
-	"github.com/go-co-op/gocron"
 	"github.com/mashingan/smapping"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -107,69 +109,36 @@ type VehiclesData struct {
 	UpdatedAt         time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
-var (
-	Log *log.Logger
-)
-
-func LoggerFile(msg string) *os.File {
-	// set location of log file
-	// LOG_FILE := "info.log"
-	// open log file
-	f, err := os.OpenFile("newInfo.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	return f
-}
-
-func GetVehicleData() {
-	reqURL := "http://fusioniot.mobilogix.com/webservice?token=getLiveData&user=skroman@mautoafrica.com&pass=Mauto@777&vehicle_no=DG5181-TOGO&format=json"
-	resp, err := http.Get(reqURL)
-	if err != nil {
-		log.Fatal("error", err.Error())
-		fmt.Println("error from err", err.Error())
-	}
-
-	defer resp.Body.Close()
+func GetVehicleData(vehicleNo string) {
+	reqURL := appConfig.Feed.VehicleLiveDataURL(vehicleNo)
 
-	body, parsing_err := ioutil.ReadAll(resp.Body)
-
-	if parsing_err != nil {
-		log.Fatal("parsing error", err)
-		fmt.Println("error from parsing err", parsing_err.Error())
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
 
-	content := string(body)
 	var jsonMap AutoGenerated
-	json.Unmarshal([]byte(content), &jsonMap)
+	if err := proxyapis.NewFetcher(appConfig.Feed).GetJSON(ctx, reqURL, &jsonMap); err != nil {
+		logger.From(ctx).WithField(logger.FieldVehicleNo, vehicleNo).WithError(err).Error("failed to fetch the vehicle")
+		return
+	}
 
 	SaveData(jsonMap)
 }
 
 func GetAllVehicles() {
-	reqURL := "http://fusioniot.mobilogix.com/webservice?token=getLiveData&user=skroman@mautoafrica.com&pass=Mauto@777"
-
-	requestChannel := make(chan models.AutoGenerated)
-	go proxyapis.GetAllVehicels(reqURL, requestChannel)
+	ctx := context.Background()
+	vehicleData, err := feedProvider.FetchVehicles(ctx)
+	if err != nil {
+		logger.From(ctx).WithError(err).Error("failed to fetch the vehicles")
+		return
+	}
 
 	new_data := []interface{}{}
 
-	for i := range requestChannel {
-		for ik := range i.Root.VehicleData {
-
-			vehicleToInsert := models.VehiclesData{}
-			smapping_err := smapping.FillStruct(&vehicleToInsert, smapping.MapFields(i.Root.VehicleData[ik]))
-
-			if smapping_err != nil {
-				log.Fatal("smapping error == >", smapping_err)
-			}
-
-			vehicleToInsert.TimeStamp = primitive.NewDateTimeFromTime(time.Now().Local().UTC())
-			vehicleToInsert.Id = primitive.NewObjectID()
+	for i := range vehicleData {
+		vehicleData[i].TimeStamp = primitive.NewDateTimeFromTime(time.Now().Local().UTC())
+		vehicleData[i].Id = primitive.NewObjectID()
 
-			new_data = append(new_data, vehicleToInsert)
-		}
+		new_data = append(new_data, vehicleData[i])
 	}
 
 	SaveMultiple(new_data)
@@ -180,13 +149,12 @@ func SaveMultiple(newData []interface{}) {
 	defer cancel()
 	var client = dbconfig.ResolveClientDB()
 	if client != nil {
-		var vehicleconnection *mongo.Collection = (*mongo.Collection)(client.Database("mautodb").Collection("vehicles"))
+		var vehicleconnection *mongo.Collection = dbconfig.GetCollection(client, "vehicles")
 		_, inserror := vehicleconnection.InsertMany(ctx, newData)
 
 		if inserror != nil {
-			LoggerFile("Insertation Error ==> " + inserror.Error())
+			logger.From(ctx).WithError(inserror).Error("failed to insert the vehicles")
 		}
-		LoggerFile("Inserted ids => ")
 	}
 }
 
@@ -195,7 +163,7 @@ func SaveData(jsonmap AutoGenerated) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if client != nil {
-		var companyCollection *mongo.Collection = (*mongo.Collection)(client.Database("mautodb").Collection("vehicles"))
+		var companyCollection *mongo.Collection = dbconfig.GetCollection(client, "vehicles")
 		if len(jsonmap.Root.VehicleData) > 0 {
 			vehicledata := VehiclesData{}
 			smapping.FillStruct(&vehicledata, smapping.MapFields(&jsonmap.Root.VehicleData[0]))
@@ -205,16 +173,12 @@ func SaveData(jsonmap AutoGenerated) {
 			vehicledata.UpdatedAt = time.Now()
 
 			res, err := companyCollection.InsertOne(ctx, &vehicledata)
-
 			if err != nil {
-				LoggerFile("Insertation Error ==> " + err.Error())
+				logger.From(ctx).WithError(err).Error("failed to insert the vehicle")
+				return
 			}
-			str := fmt.Sprintf("%v", res.InsertedID)
-
-			LoggerFile("insert success ==> " + str)
+			logger.From(ctx).WithField("id", res.InsertedID).Debug("inserted the vehicle")
 		}
-	} else {
-		LoggerFile("client connection faied...")
 	}
 }
 
@@ -226,141 +190,256 @@ const (
 	ContentTypeText   = "text/plain; charset=utf-8"
 )
 
-var batteryRepo repositories.BatteryRepository = repositories.NewBatteryRepository()
-var batteryService services.BatteryService = services.NewBatteryService(batteryRepo)
-var vehicleRepo repositories.VehicleRepository = repositories.NewVehicleRepository()
-var vehicleService services.VehicleServices = services.NewVehicleService(vehicleRepo, batteryService)
-
-func RunCronJob() {
-	scheduler := gocron.NewScheduler(time.UTC)
-	f := LoggerFile("")
-	log.SetOutput(f)
-	fmt.Println("")
-	scheduler.Every(1).Minute().Do(func() {
-		fmt.Println("cron run ...battery to main : ", time.Now())
-		err := vehicleService.BatteryTempToMain()
-		fmt.Println(err)
-		if err != nil {
-			log.Println(err)
-		} else {
-			log.Println("Battery temp to main run ....")
-		}
-	})
-	scheduler.Every(1).Hour().Do(func() {
-
-		err := vehicleService.RefreshVehicleData()
-		if err != nil {
-			log.Println(err)
-		} else {
-			log.Println("Refresh vehicle data cron run...", time.Now())
-		}
-	})
+var appConfig *config.Config
+var feedProvider proxyapis.FeedProvider
+var batteryRepo repositories.BatteryRepository
+var batteryService services.BatteryService
+var vehicleRepo repositories.VehicleRepository
+var vehicleService services.VehicleServices
+var notificationService services.NotificationService
+
+// registerJobs adds every cron job to the registry, the registry records
+// each run in job_runs
+func registerJobs(registry jobs.Registry) error {
+	handlers := []struct {
+		name    string
+		handler jobs.Handler
+	}{
+		{config.JobBatteryTempToMain, vehicleService.BatteryTempToMain},
+		{config.JobRefreshVehicleData, vehicleService.RefreshVehicleData},
+		{config.JobCreateVehicleAlertHistory, vehicleService.CreateVehicleAlertHistory},
+		{config.JobCreateDistanceTravelHistory, vehicleService.CreateDistanceTravelHistory},
+		{config.JobCreateBatteryTemperatureHistory, vehicleService.CreateBatteryTemperatureHistory},
+		{config.JobUpdateBatteryDistanceTravelled, batteryService.UpdateBatteryDistanceTravelled},
+		{config.JobUpdateBatteryStatus, batteryService.UpdateBatteryStatus},
+		{config.JobCheckForBatteryCycle, vehicleService.CheckForBatteryCycle},
+		{config.JobUpdateLastSevenHourUnreported, batteryService.UpdateLastSevenHourUnReported},
+		{config.JobUpdateLast24HourUnreported, batteryService.UpdateLast24HourUnreported},
+		{config.JobProcessNotificationOutbox, func(ctx context.Context) error {
+			sent, err := notificationService.ProcessOutbox(ctx)
+			jobs.AddItems(ctx, "sent", sent)
+			return err
+		}},
+	}
 
-	scheduler.Every(24).Hour().Do(func() {
-		err := vehicleService.CreateVehicleAlertHistory()
-		if err != nil {
-			log.Println(err)
-		} else {
-			log.Println("Vehicle Alert History cron run successfully...", time.Now())
+	for _, job := range handlers {
+		definition := jobDefinition(job.name, appConfig.Jobs[job.name])
+		definition.Handler = job.handler
+		if err := registry.Register(definition); err != nil {
+			return err
 		}
-	})
+	}
+	return nil
+}
 
-	scheduler.Every(24).Hour().Do(func() {
-		err := vehicleService.CreateDistanceTravelHistory()
+func jobDefinition(name string, schedule config.JobConfig) jobs.Job {
+	return jobs.Job{
+		Name:     name,
+		Schedule: schedule.Schedule,
+		Timeout:  schedule.TimeoutDuration(),
+		Overlap:  schedule.Overlap,
+		Disabled: !schedule.IsEnabled(),
+	}
+}
 
-		if err != nil {
-			log.Println("err from create distance travel history => ", err)
-		} else {
-			log.Println("Create Distance Travel History  run successfully....", time.Now())
+// reloadJobs re-reads the config on SIGHUP and applies the jobs section,
+// everything else only changes with a restart
+func reloadJobs(registry jobs.Registry) {
+	reloaded, err := config.Load()
+	if err != nil {
+		logger.From(context.Background()).WithError(err).Error("keeping the current job schedules")
+		return
+	}
+	for name, schedule := range reloaded.Jobs {
+		if err := registry.Reschedule(jobDefinition(name, schedule)); err != nil {
+			logger.From(context.Background()).WithField(logger.FieldJob, name).WithError(err).Error("failed to reschedule the job")
 		}
-	})
+	}
+	if reloaded.Scheduler.TimeZone != appConfig.Scheduler.TimeZone {
+		logger.From(context.Background()).Warn("scheduler.timezone only changes with a restart")
+	}
+}
 
-	scheduler.Every(24).Hour().Do(func() {
-		err := vehicleService.CreateBatteryTemperatureHistory()
-		if err != nil {
-			log.Println("err from create distance travel history => ", err)
-		} else {
-			log.Println("Create Battery Temperature History  run successfully....", time.Now())
-		}
-	})
-	scheduler.Every(24).Hour().Do(func() {
-		err := batteryService.UpdateBatteryDistanceTravelled()
-		if err != nil {
-			log.Println("Error to update battery DistanceTraveled : ", err)
-		} else {
-			log.Println("Update battery distance Travlled run successfully : ", time.Now())
-		}
-	})
-	scheduler.Every(5).Minute().Do(func() {
-		err := batteryService.UpdateBatteryStatus()
-		if err != nil {
-			log.Println("Error from update battery status => ", err)
-		} else {
-			log.Println("Update battery status run successfully.....", time.Now())
-		}
-	})
+func main() {
+	var err error
+	startLog := logger.From(context.Background())
+	appConfig, err = config.Load()
+	if err != nil {
+		startLog.WithError(err).Fatal("failed to load the config")
+	}
+	if err := logger.Configure(appConfig.Log); err != nil {
+		startLog.WithError(err).Fatal("failed to configure the logger")
+	}
+	dbconfig.Configure(appConfig)
 
-	scheduler.Every(1).Hour().Do(func() {
-		fmt.Println("Cycle count checking start...")
-		err := vehicleService.CheckForBatteryCycle()
-		fmt.Println("Error from battery chycel :", err)
-	})
+	database := dbconfig.ResolveDatabase()
+	telematics := dbconfig.ResolveTelematicsClient()
 
-	scheduler.Every(1).Hour().Do(func() {
-		err := batteryService.UpdateLastSevenHourUnReported()
-		if err != nil {
-			log.Println("Error from update last seven hour unreported => ", err)
-		} else {
-			log.Println("Update last seven hour unreported successfully.....", time.Now())
-		}
-	})
+	batteryRepo = repositories.NewBatteryRepository(database, telematics)
+	batteryService = services.NewBatteryService(batteryRepo)
+	feedProvider, err = proxyapis.NewFeedProvider(appConfig.Feed)
+	if err != nil {
+		startLog.WithError(err).Fatal("failed to create the feed provider")
+	}
 
-	scheduler.Every(1).Hour().Do(func() {
-		err := batteryService.UpdateLast24HourUnreported()
-		if err != nil {
-			log.Println("Error from update last seven hour unreported => ", err)
-		} else {
-			log.Println("Update last seven hour unreported successfully.....", time.Now())
-		}
-	})
+	gpsFilter := helper.GPSFilter{
+		MaxSpeedKmph:    appConfig.GPSFilter.MaxSpeedKmph,
+		IdleDriftMeters: appConfig.GPSFilter.IdleDrift(),
+	}
+	vehicleRepo = repositories.NewVehicleRepository(database, telematics, feedProvider, gpsFilter)
 
-	scheduler.StartBlocking()
-}
+	setupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := repositories.EnsureVehicleTrackCollection(setupCtx, database, appConfig.Tracks.RetentionDuration()); err != nil {
+		startLog.WithError(err).Fatal("failed to create vehicle track collection")
+	}
+	trackRepo := repositories.NewTrackRepository(database)
+	tripRepo := repositories.NewTripRepository(database)
+	if err := tripRepo.EnsureIndexes(setupCtx); err != nil {
+		startLog.WithError(err).Fatal("failed to create vehicle trip indexes")
+	}
+	geofenceRepo := repositories.NewGeofenceRepository(database)
+	if err := geofenceRepo.EnsureIndexes(setupCtx); err != nil {
+		startLog.WithError(err).Fatal("failed to create geofence indexes")
+	}
+	alertRepo := repositories.NewAlertRepository(database)
+	if err := alertRepo.EnsureIndexes(setupCtx); err != nil {
+		startLog.WithError(err).Fatal("failed to create alert indexes")
+	}
+	notificationRepo := repositories.NewNotificationRepository(database)
+	if err := notificationRepo.EnsureIndexes(setupCtx); err != nil {
+		startLog.WithError(err).Fatal("failed to create notification outbox indexes")
+	}
+	userRepo := repositories.NewUserRepository(database)
+	if err := userRepo.EnsureIndexes(setupCtx); err != nil {
+		startLog.WithError(err).Fatal("failed to create user indexes")
+	}
+	jobRunRepo := repositories.NewJobRunRepository(database)
+	if err := jobRunRepo.EnsureIndexes(setupCtx, appConfig.Scheduler.RunRetentionDuration()); err != nil {
+		startLog.WithError(err).Fatal("failed to create job run indexes")
+	}
+	jobLockRepo := repositories.NewJobLockRepository(database)
+	if err := jobLockRepo.EnsureIndexes(setupCtx); err != nil {
+		startLog.WithError(err).Fatal("failed to create job lock indexes")
+	}
 
-func main() {
+	notifiers, err := notifier.New(appConfig.Notify)
+	if err != nil {
+		startLog.WithError(err).Fatal("failed to create the notifiers")
+	}
+	templates, err := notifier.NewTemplates(appConfig.Notify.Templates)
+	if err != nil {
+		startLog.WithError(err).Fatal("failed to parse the notification templates")
+	}
+	notificationService = services.NewNotificationService(notificationRepo, notifiers, templates, services.NotificationSettings{
+		Enabled:      appConfig.Notify.IsEnabled(),
+		Routes:       appConfig.Notify.Routes,
+		RateLimit:    appConfig.Notify.RateLimitDuration(),
+		MaxAttempts:  appConfig.Notify.MaxAttempts,
+		RetryBackoff: appConfig.Notify.RetryBackoffDuration(),
+		Location:     appConfig.Feed.Location(),
+	})
 
-	RunCronJob()
+	geofenceService := services.NewGeofenceService(geofenceRepo)
+	alertEngine := services.NewAlertEngine()
+	alertService := services.NewAlertService(alertRepo, alertEngine, notificationService, appConfig.Alerts.DedupWindowDuration())
+	tripService := services.NewTripService(tripRepo, gpsFilter, services.TripSettings{
+		MinMovingSpeedKmph: appConfig.Trips.MinMovingSpeedKmph,
+		MaxGap:             appConfig.Trips.MaxGapDuration(),
+		MinDistanceKm:      appConfig.Trips.MinDistance(),
+	})
 
-	// router := gin.Default()
-	// var vehicleRepo repositories.VehicleRepository = repositories.NewVehicleRepository()
-	// var vehicleService services.VehicleServices = services.NewVehicleService(vehicleRepo)
+	snapshotOptions := models.SnapshotOptions{
+		Location:    appConfig.Feed.Location(),
+		TimeLayouts: appConfig.Feed.TimeLayouts,
+	}
+	vehicleService = services.NewVehicleService(vehicleRepo, trackRepo, tripService, geofenceService, alertService, batteryService, snapshotOptions)
+
+	// reset tokens go out through the email channel when a route uses it
+	authService := services.NewAuthService(userRepo, notifiers[config.ChannelEmail], services.AuthSettings{
+		Secret:     []byte(appConfig.Auth.JWTSecret),
+		Issuer:     appConfig.Auth.Issuer,
+		AccessTTL:  appConfig.Auth.AccessTTLDuration(),
+		RefreshTTL: appConfig.Auth.RefreshTTLDuration(),
+		ResetTTL:   appConfig.Auth.ResetTTLDuration(),
+		BcryptCost: appConfig.Auth.BcryptCost,
+	})
+	if err := authService.EnsureAdmin(setupCtx, appConfig.Auth.BootstrapAdminEmail, appConfig.Auth.BootstrapAdminPassword); err != nil {
+		startLog.WithError(err).Fatal("failed to create bootstrap admin")
+	}
+	cancel()
+	scopeService := services.NewScopeService(vehicleRepo, batteryRepo)
 
-	// router.POST("/refresh-data", func(ctx *gin.Context) {
-	// 	// fmt.Println("Get vehicle info cron run ...", time.Now().Local())
-	// 	err := vehicleService.RefreshVehicleData()
-	// 	fmt.Println(err)
+	jobStateRepo := repositories.NewJobStateRepository(database)
+	registry := jobs.NewRegistry(appConfig.Scheduler.Location(), jobRunRepo, jobLockRepo, jobStateRepo, jobs.Lease{
+		Owner: appConfig.Scheduler.OwnerName(),
+		TTL:   appConfig.Scheduler.LeaseTTLDuration(),
+	})
+	if err := registerJobs(registry); err != nil {
+		startLog.WithError(err).Fatal("failed to register the jobs")
+	}
 
-	// })
+	router := controllers.NewRouter(
+		controllers.NewAuthController(authService),
+		controllers.RequireAuth(authService),
+		controllers.NewVehicleController(vehicleService, scopeService, feedProvider, snapshotOptions),
+		controllers.NewBatteryController(batteryService, scopeService),
+		controllers.NewAlertController(alertService, scopeService),
+		controllers.NewAlertRuleController(services.NewAlertRuleService(alertRepo, alertService, alertEngine)),
+		controllers.NewGeofenceController(geofenceService, scopeService),
+		controllers.NewJobController(registry),
+	)
+	server := &http.Server{
+		Addr:         appConfig.HTTP.Addr,
+		Handler:      router,
+		ReadTimeout:  appConfig.HTTP.ReadTimeoutDuration(),
+		WriteTimeout: appConfig.HTTP.WriteTimeoutDuration(),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			startLog.WithError(err).Fatal("http server stopped")
+		}
+	}()
 
-	// router.POST("/alert-history", func(ctx *gin.Context) {
-	// 	fmt.Println("Alert history run..", time.Now().Local())
-	// 	// err := vehicleService.CreateVehicleAlertHistory()
-	// 	// fmt.Println(err)
-	// })
+	registry.StartAsync()
 
-	// router.POST("/add-test-data", func(ctx *gin.Context) {
-	// 	err := vehicleService.AddTestData()
-	// 	fmt.Println(err)
-	// })
+	// SIGHUP reloads the job schedules, SIGINT/SIGTERM shut down and a
+	// second one kills the process the default way
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reloadJobs(registry)
+	}
+	signal.Reset()
+	shutdown(server, registry)
+}
 
-	// router.GET("/temp-to-main", func(ctx *gin.Context) {
-	// 	err := vehicleService.BatteryTempToMain()
-	// 	fmt.Println(err)
-	// })
+// shutdown stops taking requests and starting jobs, waits for the ones still
+// going until the shutdown timeout and disconnects both mongo clients
+func shutdown(server *http.Server, registry jobs.Registry) {
+	shutdownLog := logger.From(context.Background())
+	shutdownLog.WithField("timeout", appConfig.Shutdown.Timeout).Info("shutting down, waiting for requests and jobs")
+	ctx, cancel := context.WithTimeout(context.Background(), appConfig.Shutdown.TimeoutDuration())
+	defer cancel()
 
-	// err := router.Run(":5000")
-	// if err != nil {
-	// 	fmt.Println(err)
-	// }
+	if err := server.Shutdown(ctx); err != nil {
+		shutdownLog.WithError(err).Error("failed to stop the http server")
+	}
+	if err := registry.Stop(ctx); err != nil {
+		shutdownLog.WithError(err).Error("failed to stop the jobs")
+	}
 
+	// the disconnect gets its own deadline, the jobs may have used up ctx
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer closeCancel()
+	if err := dbconfig.CloseClientDB(closeCtx); err != nil {
+		shutdownLog.WithError(err).Error("failed to close the mautodb client")
+	}
+	if err := dbconfig.CloseTelematicsClient(closeCtx); err != nil {
+		shutdownLog.WithError(err).Error("failed to close the telematics client")
+	}
+	shutdownLog.Info("stopped")
+	_ = logger.Close()
 }
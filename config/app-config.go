@@ -0,0 +1,979 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// the feed timezone has to resolve on hosts without a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// default location of the config file, override it with MAUTO_CONFIG_FILE
+const DefaultConfigFile = "config.yaml"
+
+type MongoConfig struct {
+	URI      string `yaml:"uri"`
+	Database string `yaml:"database"`
+}
+
+type FeedConfig struct {
+	Provider string `yaml:"provider"`
+	BaseURL  string `yaml:"base_url"`
+	Token    string `yaml:"token"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+
+	Timeout string `yaml:"timeout"`
+	// 0 turns retries off
+	MaxRetries       *int   `yaml:"max_retries"`
+	RetryBackoff     string `yaml:"retry_backoff"`
+	MaxRetryBackoff  string `yaml:"max_retry_backoff"`
+	MaxResponseBytes int64  `yaml:"max_response_bytes"`
+
+	// the feed sends wall clock times without an offset
+	TimeZone    string   `yaml:"timezone"`
+	TimeLayouts []string `yaml:"time_layouts"`
+}
+
+// GPSFilterConfig holds the thresholds of the distance noise filter
+type GPSFilterConfig struct {
+	MaxSpeedKmph float64 `yaml:"max_speed_kmph"`
+	// 0 turns the parked jitter filter off
+	IdleDriftMeters *float64 `yaml:"idle_drift_meters"`
+}
+
+type TrackConfig struct {
+	// fixes older than this are expired from vehicle_tracks, 0 keeps them forever
+	Retention string `yaml:"retention"`
+}
+
+// TripConfig tunes the trip engine
+type TripConfig struct {
+	MinMovingSpeedKmph float64 `yaml:"min_moving_speed_kmph"`
+	MaxGap             string  `yaml:"max_gap"`
+	// shorter trips are dropped, 0 keeps every trip
+	MinDistanceKm *float64 `yaml:"min_distance_km"`
+}
+
+type AlertConfig struct {
+	// a rule firing again within this window reopens the previous incident
+	DedupWindow string `yaml:"dedup_window"`
+}
+
+// NotificationConfig configures where alert notifications go, nothing is
+// sent unless it is enabled and a route matches
+type NotificationConfig struct {
+	Enabled     *bool `yaml:"enabled"`
+	MaxAttempts int   `yaml:"max_attempts"`
+	// first retry delay, doubled on every further attempt
+	RetryBackoff string `yaml:"retry_backoff"`
+	// the same alert of the same subject goes out at most once per window and route
+	RateLimit string `yaml:"rate_limit"`
+	Timeout   string `yaml:"timeout"`
+
+	Webhook WebhookConfig `yaml:"webhook"`
+	Email   EmailConfig   `yaml:"email"`
+	SMS     SMSConfig     `yaml:"sms"`
+
+	Routes []NotificationRoute `yaml:"routes"`
+	// keyed by alert type, "default" applies to the others
+	Templates map[string]NotificationTemplate `yaml:"templates"`
+}
+
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	// signs the body as X-Signature: sha256=<hmac>
+	Secret string `yaml:"secret"`
+}
+
+type EmailConfig struct {
+	Provider         string `yaml:"provider"`
+	From             string `yaml:"from"`
+	FromName         string `yaml:"from_name"`
+	SMTPHost         string `yaml:"smtp_host"`
+	SMTPPort         int    `yaml:"smtp_port"`
+	SMTPUser         string `yaml:"smtp_user"`
+	SMTPPassword     string `yaml:"smtp_password"`
+	SendinblueAPIKey string `yaml:"sendinblue_api_key"`
+}
+
+type SMSConfig struct {
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+	Sender string `yaml:"sender"`
+}
+
+// NotificationRoute sends the matching alerts to the recipients of one channel
+type NotificationRoute struct {
+	Name string `yaml:"name"`
+	// empty matches every alert type
+	AlertTypes  []string `yaml:"alert_types"`
+	MinSeverity string   `yaml:"min_severity"`
+	Channel     string   `yaml:"channel"`
+	Recipients  []string `yaml:"recipients"`
+	// also notify when the alert clears
+	OnClear bool `yaml:"on_clear"`
+}
+
+type NotificationTemplate struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+type HTTPConfig struct {
+	Addr         string `yaml:"addr"`
+	ReadTimeout  string `yaml:"read_timeout"`
+	WriteTimeout string `yaml:"write_timeout"`
+}
+
+type AuthConfig struct {
+	// signs the api tokens, required
+	JWTSecret  string `yaml:"jwt_secret"`
+	Issuer     string `yaml:"issuer"`
+	AccessTTL  string `yaml:"access_ttl"`
+	RefreshTTL string `yaml:"refresh_ttl"`
+	ResetTTL   string `yaml:"reset_ttl"`
+	BcryptCost int    `yaml:"bcrypt_cost"`
+	// created as admin when the users collection is empty
+	BootstrapAdminEmail    string `yaml:"bootstrap_admin_email"`
+	BootstrapAdminPassword string `yaml:"bootstrap_admin_password"`
+}
+
+// SchedulerConfig is how replicas share the cron jobs, see jobs.Lease
+type SchedulerConfig struct {
+	// how long the scheduler lease lasts without a renewal
+	LeaseTTL string `yaml:"lease_ttl"`
+	// names this replica in job_locks, hostname-pid when empty
+	Owner string `yaml:"owner"`
+	// zone the job schedules are read in
+	TimeZone string `yaml:"timezone"`
+	// finished runs older than this are expired from job_runs, 0 keeps them forever
+	RunRetention string `yaml:"run_retention"`
+}
+
+// ShutdownConfig bounds how long SIGINT/SIGTERM waits for the api requests
+// and job runs still going
+type ShutdownConfig struct {
+	Timeout string `yaml:"timeout"`
+}
+
+// LogConfig is the json log output, see the logger package
+type LogConfig struct {
+	// debug, info, warn or error
+	Level string `yaml:"level"`
+	// rotated log file, stdout when empty
+	File string `yaml:"file"`
+	// the file is rotated once it reaches this size
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// rotated files kept, 0 keeps all of them until MaxAgeDays
+	MaxBackups *int `yaml:"max_backups"`
+	// days a rotated file is kept, 0 keeps them regardless of age
+	MaxAgeDays *int `yaml:"max_age_days"`
+	// gzip the rotated files
+	Compress *bool `yaml:"compress"`
+}
+
+type JobConfig struct {
+	// a cron expression like "5 0 * * *" or a descriptor like "@every 1h",
+	// read in the scheduler timezone
+	Schedule string `yaml:"schedule"`
+	// a disabled job only runs when triggered by hand, enabled when unset
+	Enabled *bool `yaml:"enabled"`
+	// a run is cancelled and recorded as timeout after this long
+	Timeout string `yaml:"timeout"`
+	// skip or queue, see JobOverlapSkip
+	Overlap string `yaml:"overlap"`
+}
+
+type Config struct {
+	MautoDB    MongoConfig          `yaml:"mautodb"`
+	Telematics MongoConfig          `yaml:"telematics"`
+	Feed       FeedConfig           `yaml:"feed"`
+	GPSFilter  GPSFilterConfig      `yaml:"gps_filter"`
+	Tracks     TrackConfig          `yaml:"tracks"`
+	Trips      TripConfig           `yaml:"trips"`
+	Alerts     AlertConfig          `yaml:"alerts"`
+	Notify     NotificationConfig   `yaml:"notifications"`
+	HTTP       HTTPConfig           `yaml:"http"`
+	Auth       AuthConfig           `yaml:"auth"`
+	Scheduler  SchedulerConfig      `yaml:"scheduler"`
+	Shutdown   ShutdownConfig       `yaml:"shutdown"`
+	Log        LogConfig            `yaml:"log"`
+	Jobs       map[string]JobConfig `yaml:"jobs"`
+}
+
+const FeedProviderMobilogix = "mobilogix"
+
+// notification channels and email providers
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+
+	EmailProviderSMTP       = "smtp"
+	EmailProviderSendinblue = "sendinblue"
+)
+
+// what a job does when its next run comes up while the previous one is
+// still going
+const (
+	// drop the run
+	JobOverlapSkip = "skip"
+	// run once more as soon as the previous run finishes
+	JobOverlapQueue = "queue"
+)
+
+// job names used as keys in the jobs section of the config file
+const (
+	JobBatteryTempToMain               = "battery_temp_to_main"
+	JobRefreshVehicleData              = "refresh_vehicle_data"
+	JobCreateVehicleAlertHistory       = "create_vehicle_alert_history"
+	JobCreateDistanceTravelHistory     = "create_distance_travel_history"
+	JobCreateBatteryTemperatureHistory = "create_battery_temperature_history"
+	JobUpdateBatteryDistanceTravelled  = "update_battery_distance_travelled"
+	JobUpdateBatteryStatus             = "update_battery_status"
+	JobCheckForBatteryCycle            = "check_for_battery_cycle"
+	JobUpdateLastSevenHourUnreported   = "update_last_seven_hour_unreported"
+	JobUpdateLast24HourUnreported      = "update_last_24_hour_unreported"
+	JobProcessNotificationOutbox       = "process_notification_outbox"
+)
+
+// Default returns the config with everything except secrets filled in
+func Default() *Config {
+	return &Config{
+		MautoDB: MongoConfig{
+			Database: "mautodb",
+		},
+		Telematics: MongoConfig{
+			Database: "telematics",
+		},
+		Feed: FeedConfig{
+			Provider: FeedProviderMobilogix,
+			BaseURL:  "http://fusioniot.mobilogix.com/webservice",
+			Token:    "getLiveData",
+
+			Timeout:          "30s",
+			MaxRetries:       intPtr(3),
+			RetryBackoff:     "1s",
+			MaxRetryBackoff:  "30s",
+			MaxResponseBytes: 20 << 20,
+
+			TimeZone: "Asia/Kolkata",
+		},
+		GPSFilter: GPSFilterConfig{
+			MaxSpeedKmph:    150,
+			IdleDriftMeters: floatPtr(50),
+		},
+		Tracks: TrackConfig{
+			Retention: "2160h",
+		},
+		Trips: TripConfig{
+			MinMovingSpeedKmph: 5,
+			MaxGap:             "2h",
+			MinDistanceKm:      floatPtr(0.2),
+		},
+		Alerts: AlertConfig{
+			DedupWindow: "10m",
+		},
+		Notify: NotificationConfig{
+			MaxAttempts:  5,
+			RetryBackoff: "1m",
+			RateLimit:    "15m",
+			Timeout:      "10s",
+			Email: EmailConfig{
+				Provider: EmailProviderSMTP,
+				SMTPPort: 587,
+			},
+		},
+		HTTP: HTTPConfig{
+			Addr:         ":5000",
+			ReadTimeout:  "15s",
+			WriteTimeout: "60s",
+		},
+		Auth: AuthConfig{
+			Issuer:     "mauto",
+			AccessTTL:  "15m",
+			RefreshTTL: "720h",
+			ResetTTL:   "1h",
+			BcryptCost: 12,
+		},
+		Scheduler: SchedulerConfig{
+			LeaseTTL:     "30s",
+			TimeZone:     "Asia/Kolkata",
+			RunRetention: "720h",
+		},
+		Shutdown: ShutdownConfig{
+			Timeout: "25s",
+		},
+		Log: LogConfig{
+			Level:      "info",
+			MaxSizeMB:  100,
+			MaxBackups: intPtr(10),
+			MaxAgeDays: intPtr(30),
+		},
+		Jobs: map[string]JobConfig{
+			JobBatteryTempToMain:               {Schedule: "* * * * *", Timeout: "1m", Overlap: JobOverlapSkip},
+			JobRefreshVehicleData:              {Schedule: "0 * * * *", Timeout: "30m", Overlap: JobOverlapSkip},
+			JobCreateVehicleAlertHistory:       {Schedule: "5 0 * * *", Timeout: "30m", Overlap: JobOverlapSkip},
+			JobCreateDistanceTravelHistory:     {Schedule: "10 0 * * *", Timeout: "30m", Overlap: JobOverlapSkip},
+			JobCreateBatteryTemperatureHistory: {Schedule: "15 0 * * *", Timeout: "30m", Overlap: JobOverlapSkip},
+			JobUpdateBatteryDistanceTravelled:  {Schedule: "20 0 * * *", Timeout: "30m", Overlap: JobOverlapSkip},
+			JobUpdateBatteryStatus:             {Schedule: "*/5 * * * *", Timeout: "5m", Overlap: JobOverlapSkip},
+			JobCheckForBatteryCycle:            {Schedule: "30 * * * *", Timeout: "30m", Overlap: JobOverlapSkip},
+			JobUpdateLastSevenHourUnreported:   {Schedule: "0 * * * *", Timeout: "10m", Overlap: JobOverlapSkip},
+			JobUpdateLast24HourUnreported:      {Schedule: "0 * * * *", Timeout: "10m", Overlap: JobOverlapSkip},
+			JobProcessNotificationOutbox:       {Schedule: "* * * * *", Timeout: "5m", Overlap: JobOverlapSkip},
+		},
+	}
+}
+
+// Load reads the config file (if present) on top of the defaults and then
+// applies environment variable overrides, the result is validated
+func Load() (*Config, error) {
+	cfg := Default()
+
+	path := os.Getenv("MAUTO_CONFIG_FILE")
+	if path == "" {
+		path = DefaultConfigFile
+	}
+
+	if err := cfg.loadFile(path); err != nil {
+		return nil, err
+	}
+
+	cfg.applyEnv()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		// config file is optional when everything comes from the environment
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read config file %s : %w", path, err)
+	}
+
+	fileCfg := Config{}
+	if err := yaml.UnmarshalStrict(content, &fileCfg); err != nil {
+		return fmt.Errorf("parse config file %s : %w", path, err)
+	}
+
+	cfg.merge(fileCfg)
+	return nil
+}
+
+// merge copies every non empty value of other into cfg
+func (cfg *Config) merge(other Config) {
+	setIfNotEmpty(&cfg.MautoDB.URI, other.MautoDB.URI)
+	setIfNotEmpty(&cfg.MautoDB.Database, other.MautoDB.Database)
+	setIfNotEmpty(&cfg.Telematics.URI, other.Telematics.URI)
+	setIfNotEmpty(&cfg.Telematics.Database, other.Telematics.Database)
+	setIfNotEmpty(&cfg.Feed.Provider, other.Feed.Provider)
+	setIfNotEmpty(&cfg.Feed.BaseURL, other.Feed.BaseURL)
+	setIfNotEmpty(&cfg.Feed.Token, other.Feed.Token)
+	setIfNotEmpty(&cfg.Feed.User, other.Feed.User)
+	setIfNotEmpty(&cfg.Feed.Password, other.Feed.Password)
+	setIfNotEmpty(&cfg.Feed.Timeout, other.Feed.Timeout)
+	setIfNotEmpty(&cfg.Feed.RetryBackoff, other.Feed.RetryBackoff)
+	setIfNotEmpty(&cfg.Feed.MaxRetryBackoff, other.Feed.MaxRetryBackoff)
+	if other.Feed.MaxRetries != nil {
+		cfg.Feed.MaxRetries = other.Feed.MaxRetries
+	}
+	if other.Feed.MaxResponseBytes != 0 {
+		cfg.Feed.MaxResponseBytes = other.Feed.MaxResponseBytes
+	}
+	setIfNotEmpty(&cfg.Feed.TimeZone, other.Feed.TimeZone)
+	if len(other.Feed.TimeLayouts) > 0 {
+		cfg.Feed.TimeLayouts = other.Feed.TimeLayouts
+	}
+
+	if other.GPSFilter.MaxSpeedKmph != 0 {
+		cfg.GPSFilter.MaxSpeedKmph = other.GPSFilter.MaxSpeedKmph
+	}
+	if other.GPSFilter.IdleDriftMeters != nil {
+		cfg.GPSFilter.IdleDriftMeters = other.GPSFilter.IdleDriftMeters
+	}
+	setIfNotEmpty(&cfg.Tracks.Retention, other.Tracks.Retention)
+	if other.Trips.MinMovingSpeedKmph != 0 {
+		cfg.Trips.MinMovingSpeedKmph = other.Trips.MinMovingSpeedKmph
+	}
+	setIfNotEmpty(&cfg.Trips.MaxGap, other.Trips.MaxGap)
+	if other.Trips.MinDistanceKm != nil {
+		cfg.Trips.MinDistanceKm = other.Trips.MinDistanceKm
+	}
+	setIfNotEmpty(&cfg.Alerts.DedupWindow, other.Alerts.DedupWindow)
+	cfg.mergeNotify(other.Notify)
+	setIfNotEmpty(&cfg.HTTP.Addr, other.HTTP.Addr)
+	setIfNotEmpty(&cfg.HTTP.ReadTimeout, other.HTTP.ReadTimeout)
+	setIfNotEmpty(&cfg.HTTP.WriteTimeout, other.HTTP.WriteTimeout)
+	setIfNotEmpty(&cfg.Auth.JWTSecret, other.Auth.JWTSecret)
+	setIfNotEmpty(&cfg.Scheduler.LeaseTTL, other.Scheduler.LeaseTTL)
+	setIfNotEmpty(&cfg.Scheduler.Owner, other.Scheduler.Owner)
+	setIfNotEmpty(&cfg.Scheduler.TimeZone, other.Scheduler.TimeZone)
+	setIfNotEmpty(&cfg.Scheduler.RunRetention, other.Scheduler.RunRetention)
+	setIfNotEmpty(&cfg.Shutdown.Timeout, other.Shutdown.Timeout)
+	setIfNotEmpty(&cfg.Log.Level, other.Log.Level)
+	setIfNotEmpty(&cfg.Log.File, other.Log.File)
+	if other.Log.MaxSizeMB != 0 {
+		cfg.Log.MaxSizeMB = other.Log.MaxSizeMB
+	}
+	if other.Log.MaxBackups != nil {
+		cfg.Log.MaxBackups = other.Log.MaxBackups
+	}
+	if other.Log.MaxAgeDays != nil {
+		cfg.Log.MaxAgeDays = other.Log.MaxAgeDays
+	}
+	if other.Log.Compress != nil {
+		cfg.Log.Compress = other.Log.Compress
+	}
+	setIfNotEmpty(&cfg.Auth.Issuer, other.Auth.Issuer)
+	setIfNotEmpty(&cfg.Auth.AccessTTL, other.Auth.AccessTTL)
+	setIfNotEmpty(&cfg.Auth.RefreshTTL, other.Auth.RefreshTTL)
+	setIfNotEmpty(&cfg.Auth.ResetTTL, other.Auth.ResetTTL)
+	if other.Auth.BcryptCost != 0 {
+		cfg.Auth.BcryptCost = other.Auth.BcryptCost
+	}
+	setIfNotEmpty(&cfg.Auth.BootstrapAdminEmail, other.Auth.BootstrapAdminEmail)
+	setIfNotEmpty(&cfg.Auth.BootstrapAdminPassword, other.Auth.BootstrapAdminPassword)
+
+	for name, job := range other.Jobs {
+		current := cfg.Jobs[name]
+		setIfNotEmpty(&current.Schedule, job.Schedule)
+		if job.Enabled != nil {
+			current.Enabled = job.Enabled
+		}
+		setIfNotEmpty(&current.Timeout, job.Timeout)
+		setIfNotEmpty(&current.Overlap, job.Overlap)
+		cfg.Jobs[name] = current
+	}
+}
+
+func (cfg *Config) mergeNotify(other NotificationConfig) {
+	notify := &cfg.Notify
+	if other.Enabled != nil {
+		notify.Enabled = other.Enabled
+	}
+	if other.MaxAttempts != 0 {
+		notify.MaxAttempts = other.MaxAttempts
+	}
+	setIfNotEmpty(&notify.RetryBackoff, other.RetryBackoff)
+	setIfNotEmpty(&notify.RateLimit, other.RateLimit)
+	setIfNotEmpty(&notify.Timeout, other.Timeout)
+
+	setIfNotEmpty(&notify.Webhook.URL, other.Webhook.URL)
+	setIfNotEmpty(&notify.Webhook.Secret, other.Webhook.Secret)
+
+	setIfNotEmpty(&notify.Email.Provider, other.Email.Provider)
+	setIfNotEmpty(&notify.Email.From, other.Email.From)
+	setIfNotEmpty(&notify.Email.FromName, other.Email.FromName)
+	setIfNotEmpty(&notify.Email.SMTPHost, other.Email.SMTPHost)
+	if other.Email.SMTPPort != 0 {
+		notify.Email.SMTPPort = other.Email.SMTPPort
+	}
+	setIfNotEmpty(&notify.Email.SMTPUser, other.Email.SMTPUser)
+	setIfNotEmpty(&notify.Email.SMTPPassword, other.Email.SMTPPassword)
+	setIfNotEmpty(&notify.Email.SendinblueAPIKey, other.Email.SendinblueAPIKey)
+
+	setIfNotEmpty(&notify.SMS.URL, other.SMS.URL)
+	setIfNotEmpty(&notify.SMS.APIKey, other.SMS.APIKey)
+	setIfNotEmpty(&notify.SMS.Sender, other.SMS.Sender)
+
+	if len(other.Routes) > 0 {
+		notify.Routes = other.Routes
+	}
+	if len(other.Templates) > 0 {
+		notify.Templates = other.Templates
+	}
+}
+
+func (cfg *Config) applyEnv() {
+	setIfNotEmpty(&cfg.MautoDB.URI, os.Getenv("MAUTO_MONGO_URI"))
+	setIfNotEmpty(&cfg.MautoDB.Database, os.Getenv("MAUTO_MONGO_DATABASE"))
+	setIfNotEmpty(&cfg.Telematics.URI, os.Getenv("TELEMATICS_MONGO_URI"))
+	setIfNotEmpty(&cfg.Telematics.Database, os.Getenv("TELEMATICS_MONGO_DATABASE"))
+	setIfNotEmpty(&cfg.Feed.Provider, os.Getenv("FEED_PROVIDER"))
+	setIfNotEmpty(&cfg.Feed.BaseURL, os.Getenv("MOBILOGIX_BASE_URL"))
+	setIfNotEmpty(&cfg.Feed.Token, os.Getenv("MOBILOGIX_TOKEN"))
+	setIfNotEmpty(&cfg.Feed.User, os.Getenv("MOBILOGIX_USER"))
+	setIfNotEmpty(&cfg.Feed.Password, os.Getenv("MOBILOGIX_PASSWORD"))
+	setIfNotEmpty(&cfg.Feed.Timeout, os.Getenv("MOBILOGIX_TIMEOUT"))
+	if retries, err := strconv.Atoi(os.Getenv("MOBILOGIX_MAX_RETRIES")); err == nil {
+		cfg.Feed.MaxRetries = &retries
+	}
+	setIfNotEmpty(&cfg.Feed.TimeZone, os.Getenv("MOBILOGIX_TIMEZONE"))
+
+	setIfNotEmpty(&cfg.HTTP.Addr, os.Getenv("HTTP_ADDR"))
+	setIfNotEmpty(&cfg.Auth.JWTSecret, os.Getenv("AUTH_JWT_SECRET"))
+	setIfNotEmpty(&cfg.Auth.BootstrapAdminEmail, os.Getenv("AUTH_BOOTSTRAP_ADMIN_EMAIL"))
+	setIfNotEmpty(&cfg.Auth.BootstrapAdminPassword, os.Getenv("AUTH_BOOTSTRAP_ADMIN_PASSWORD"))
+	setIfNotEmpty(&cfg.Scheduler.LeaseTTL, os.Getenv("SCHEDULER_LEASE_TTL"))
+	setIfNotEmpty(&cfg.Scheduler.Owner, os.Getenv("SCHEDULER_OWNER"))
+	setIfNotEmpty(&cfg.Scheduler.TimeZone, os.Getenv("SCHEDULER_TIMEZONE"))
+	setIfNotEmpty(&cfg.Scheduler.RunRetention, os.Getenv("SCHEDULER_RUN_RETENTION"))
+	setIfNotEmpty(&cfg.Shutdown.Timeout, os.Getenv("SHUTDOWN_TIMEOUT"))
+	setIfNotEmpty(&cfg.Log.Level, os.Getenv("LOG_LEVEL"))
+	setIfNotEmpty(&cfg.Log.File, os.Getenv("LOG_FILE"))
+
+	if enabled, err := strconv.ParseBool(os.Getenv("NOTIFY_ENABLED")); err == nil {
+		cfg.Notify.Enabled = &enabled
+	}
+	setIfNotEmpty(&cfg.Notify.Webhook.URL, os.Getenv("NOTIFY_WEBHOOK_URL"))
+	setIfNotEmpty(&cfg.Notify.Webhook.Secret, os.Getenv("NOTIFY_WEBHOOK_SECRET"))
+	setIfNotEmpty(&cfg.Notify.Email.SMTPPassword, os.Getenv("NOTIFY_SMTP_PASSWORD"))
+	setIfNotEmpty(&cfg.Notify.Email.SendinblueAPIKey, os.Getenv("SENDINBLUE_API_KEY"))
+	setIfNotEmpty(&cfg.Notify.SMS.APIKey, os.Getenv("NOTIFY_SMS_API_KEY"))
+
+	// per job override e.g. JOB_REFRESH_VEHICLE_DATA_SCHEDULE="30 * * * *"
+	for name, job := range cfg.Jobs {
+		setIfNotEmpty(&job.Schedule, os.Getenv("JOB_"+strings.ToUpper(name)+"_SCHEDULE"))
+		if enabled, err := strconv.ParseBool(os.Getenv("JOB_" + strings.ToUpper(name) + "_ENABLED")); err == nil {
+			job.Enabled = &enabled
+		}
+		setIfNotEmpty(&job.Timeout, os.Getenv("JOB_"+strings.ToUpper(name)+"_TIMEOUT"))
+		setIfNotEmpty(&job.Overlap, os.Getenv("JOB_"+strings.ToUpper(name)+"_OVERLAP"))
+		cfg.Jobs[name] = job
+	}
+}
+
+// Validate checks that every required value is present and well formed
+func (cfg *Config) Validate() error {
+	var problems []string
+
+	if cfg.MautoDB.URI == "" {
+		problems = append(problems, "mautodb.uri (MAUTO_MONGO_URI) is required")
+	}
+	if cfg.MautoDB.Database == "" {
+		problems = append(problems, "mautodb.database is required")
+	}
+	if cfg.Telematics.URI == "" {
+		problems = append(problems, "telematics.uri (TELEMATICS_MONGO_URI) is required")
+	}
+	if cfg.Telematics.Database == "" {
+		problems = append(problems, "telematics.database is required")
+	}
+
+	if cfg.Feed.Provider != FeedProviderMobilogix {
+		problems = append(problems, fmt.Sprintf("feed.provider %q is not supported", cfg.Feed.Provider))
+	}
+	if cfg.Feed.BaseURL == "" {
+		problems = append(problems, "feed.base_url is required")
+	} else if _, err := url.ParseRequestURI(cfg.Feed.BaseURL); err != nil {
+		problems = append(problems, "feed.base_url is not a valid url")
+	}
+	if cfg.Feed.User == "" {
+		problems = append(problems, "feed.user (MOBILOGIX_USER) is required")
+	}
+	if cfg.Feed.Password == "" {
+		problems = append(problems, "feed.password (MOBILOGIX_PASSWORD) is required")
+	}
+
+	for field, value := range map[string]string{
+		"feed.timeout":           cfg.Feed.Timeout,
+		"feed.retry_backoff":     cfg.Feed.RetryBackoff,
+		"feed.max_retry_backoff": cfg.Feed.MaxRetryBackoff,
+	} {
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid duration", field, value))
+		}
+	}
+	if cfg.Feed.Retries() < 0 {
+		problems = append(problems, "feed.max_retries can not be negative")
+	}
+	if cfg.Feed.MaxResponseBytes <= 0 {
+		problems = append(problems, "feed.max_response_bytes has to be positive")
+	}
+	if _, err := time.LoadLocation(cfg.Feed.TimeZone); err != nil || cfg.Feed.TimeZone == "" {
+		problems = append(problems, fmt.Sprintf("feed.timezone %q is not a known timezone", cfg.Feed.TimeZone))
+	}
+
+	if cfg.GPSFilter.MaxSpeedKmph <= 0 {
+		problems = append(problems, "gps_filter.max_speed_kmph has to be positive")
+	}
+	if cfg.GPSFilter.IdleDrift() < 0 {
+		problems = append(problems, "gps_filter.idle_drift_meters can not be negative")
+	}
+	if d, err := time.ParseDuration(cfg.Tracks.Retention); err != nil || d < 0 {
+		problems = append(problems, fmt.Sprintf("tracks.retention %q is not a valid duration", cfg.Tracks.Retention))
+	}
+	if d, err := time.ParseDuration(cfg.Trips.MaxGap); err != nil || d <= 0 {
+		problems = append(problems, fmt.Sprintf("trips.max_gap %q is not a valid duration", cfg.Trips.MaxGap))
+	}
+	if cfg.Trips.MinMovingSpeedKmph < 0 || cfg.Trips.MinDistance() < 0 {
+		problems = append(problems, "trips thresholds can not be negative")
+	}
+	if d, err := time.ParseDuration(cfg.Alerts.DedupWindow); err != nil || d < 0 {
+		problems = append(problems, fmt.Sprintf("alerts.dedup_window %q is not a valid duration", cfg.Alerts.DedupWindow))
+	}
+
+	problems = append(problems, cfg.Notify.validate()...)
+
+	if cfg.HTTP.Addr == "" {
+		problems = append(problems, "http.addr (HTTP_ADDR) is required")
+	}
+	if len(cfg.Auth.JWTSecret) < 32 {
+		problems = append(problems, "auth.jwt_secret (AUTH_JWT_SECRET) needs at least 32 characters")
+	}
+	if cfg.Auth.BcryptCost < 10 || cfg.Auth.BcryptCost > 31 {
+		problems = append(problems, "auth.bcrypt_cost has to be between 10 and 31")
+	}
+	for field, value := range map[string]string{
+		"auth.access_ttl":    cfg.Auth.AccessTTL,
+		"auth.refresh_ttl":   cfg.Auth.RefreshTTL,
+		"auth.reset_ttl":     cfg.Auth.ResetTTL,
+		"http.read_timeout":  cfg.HTTP.ReadTimeout,
+		"http.write_timeout": cfg.HTTP.WriteTimeout,
+		"shutdown.timeout":   cfg.Shutdown.Timeout,
+	} {
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid duration", field, value))
+		}
+	}
+
+	if _, err := time.LoadLocation(cfg.Scheduler.TimeZone); err != nil {
+		problems = append(problems, fmt.Sprintf("scheduler.timezone %q is not a known zone", cfg.Scheduler.TimeZone))
+	}
+
+	if _, err := logrus.ParseLevel(cfg.Log.Level); err != nil {
+		problems = append(problems, fmt.Sprintf("log.level %q has to be debug, info, warn or error", cfg.Log.Level))
+	}
+	if cfg.Log.MaxSizeMB <= 0 || cfg.Log.Backups() < 0 || cfg.Log.AgeDays() < 0 {
+		problems = append(problems, "log.max_size_mb has to be positive, log.max_backups and log.max_age_days can't be negative")
+	}
+
+	// renewals happen every third of the ttl
+	if d, err := time.ParseDuration(cfg.Scheduler.LeaseTTL); err != nil || d < 3*time.Second {
+		problems = append(problems, fmt.Sprintf("scheduler.lease_ttl %q has to be a duration of at least 3s", cfg.Scheduler.LeaseTTL))
+	}
+	if d, err := time.ParseDuration(cfg.Scheduler.RunRetention); err != nil || d < 0 {
+		problems = append(problems, fmt.Sprintf("scheduler.run_retention %q is not a valid duration", cfg.Scheduler.RunRetention))
+	}
+
+	known := Default().Jobs
+	for name, job := range cfg.Jobs {
+		if _, ok := known[name]; !ok {
+			problems = append(problems, fmt.Sprintf("jobs.%s is not a known job", name))
+			continue
+		}
+		if _, err := cron.ParseStandard(job.Schedule); err != nil {
+			problems = append(problems, fmt.Sprintf("jobs.%s.schedule %q is not a valid cron expression : %v", name, job.Schedule, err))
+		}
+		timeout, err := time.ParseDuration(job.Timeout)
+		if err != nil || timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("jobs.%s.timeout %q is not a valid duration", name, job.Timeout))
+		}
+		if job.Overlap != JobOverlapSkip && job.Overlap != JobOverlapQueue {
+			problems = append(problems, fmt.Sprintf("jobs.%s.overlap %q has to be skip or queue", name, job.Overlap))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config : " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (notify NotificationConfig) validate() []string {
+	var problems []string
+
+	for field, value := range map[string]string{
+		"notifications.retry_backoff": notify.RetryBackoff,
+		"notifications.timeout":       notify.Timeout,
+	} {
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid duration", field, value))
+		}
+	}
+	if d, err := time.ParseDuration(notify.RateLimit); err != nil || d < 0 {
+		problems = append(problems, fmt.Sprintf("notifications.rate_limit %q is not a valid duration", notify.RateLimit))
+	}
+	if notify.MaxAttempts <= 0 {
+		problems = append(problems, "notifications.max_attempts has to be positive")
+	}
+
+	if !notify.IsEnabled() {
+		return problems
+	}
+
+	for i, route := range notify.Routes {
+		name := route.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+
+		switch route.Channel {
+		case ChannelWebhook:
+			if notify.Webhook.URL == "" && len(route.Recipients) == 0 {
+				problems = append(problems, fmt.Sprintf("notifications.routes.%s needs recipients or notifications.webhook.url", name))
+			}
+		case ChannelEmail, ChannelSMS:
+			if len(route.Recipients) == 0 {
+				problems = append(problems, fmt.Sprintf("notifications.routes.%s has no recipients", name))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("notifications.routes.%s channel %q has to be webhook, email or sms", name, route.Channel))
+		}
+
+		switch route.MinSeverity {
+		case "", "info", "warning", "critical":
+		default:
+			problems = append(problems, fmt.Sprintf("notifications.routes.%s min_severity %q has to be info, warning or critical", name, route.MinSeverity))
+		}
+	}
+
+	if notify.uses(ChannelEmail) {
+		if notify.Email.From == "" {
+			problems = append(problems, "notifications.email.from is required")
+		}
+		switch notify.Email.Provider {
+		case EmailProviderSMTP:
+			if notify.Email.SMTPHost == "" {
+				problems = append(problems, "notifications.email.smtp_host is required")
+			}
+		case EmailProviderSendinblue:
+			if notify.Email.SendinblueAPIKey == "" {
+				problems = append(problems, "notifications.email.sendinblue_api_key (SENDINBLUE_API_KEY) is required")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("notifications.email.provider %q has to be smtp or sendinblue", notify.Email.Provider))
+		}
+	}
+	if notify.uses(ChannelSMS) && notify.SMS.URL == "" {
+		problems = append(problems, "notifications.sms.url is required")
+	}
+
+	return problems
+}
+
+// uses reports whether any route sends through channel
+func (notify NotificationConfig) uses(channel string) bool {
+	for _, route := range notify.Routes {
+		if route.Channel == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// LiveDataURL builds the getLiveData url for all vehicles of the account
+func (feed FeedConfig) LiveDataURL() string {
+	return feed.VehicleLiveDataURL("")
+}
+
+// VehicleLiveDataURL builds the getLiveData url, vehicleNo is optional
+func (feed FeedConfig) VehicleLiveDataURL(vehicleNo string) string {
+	query := url.Values{}
+	query.Set("token", feed.Token)
+	query.Set("user", feed.User)
+	query.Set("pass", feed.Password)
+	if vehicleNo != "" {
+		query.Set("vehicle_no", vehicleNo)
+		query.Set("format", "json")
+	}
+
+	return feed.BaseURL + "?" + query.Encode()
+}
+
+// the duration getters below are only meaningful on a validated config
+
+// Backups is how many rotated files are kept, 10 when unset
+func (log LogConfig) Backups() int {
+	if log.MaxBackups == nil {
+		return 10
+	}
+	return *log.MaxBackups
+}
+
+// AgeDays is how many days a rotated file is kept, 30 when unset
+func (log LogConfig) AgeDays() int {
+	if log.MaxAgeDays == nil {
+		return 30
+	}
+	return *log.MaxAgeDays
+}
+
+func (log LogConfig) IsCompressed() bool {
+	return log.Compress != nil && *log.Compress
+}
+
+// Retries is how often a failed fetch is retried, 3 when unset
+func (feed FeedConfig) Retries() int {
+	if feed.MaxRetries == nil {
+		return 3
+	}
+	return *feed.MaxRetries
+}
+
+func (feed FeedConfig) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(feed.Timeout)
+	return d
+}
+
+func (feed FeedConfig) RetryBackoffDuration() time.Duration {
+	d, _ := time.ParseDuration(feed.RetryBackoff)
+	return d
+}
+
+func (feed FeedConfig) MaxRetryBackoffDuration() time.Duration {
+	d, _ := time.ParseDuration(feed.MaxRetryBackoff)
+	return d
+}
+
+// IdleDrift is the parked jitter in metres that is not counted as a move,
+// 50 when unset
+func (filter GPSFilterConfig) IdleDrift() float64 {
+	if filter.IdleDriftMeters == nil {
+		return 50
+	}
+	return *filter.IdleDriftMeters
+}
+
+func (tracks TrackConfig) RetentionDuration() time.Duration {
+	d, _ := time.ParseDuration(tracks.Retention)
+	return d
+}
+
+// MinDistance is the shortest trip in km that is kept, 0.2 when unset
+func (trips TripConfig) MinDistance() float64 {
+	if trips.MinDistanceKm == nil {
+		return 0.2
+	}
+	return *trips.MinDistanceKm
+}
+
+func (trips TripConfig) MaxGapDuration() time.Duration {
+	d, _ := time.ParseDuration(trips.MaxGap)
+	return d
+}
+
+func (scheduler SchedulerConfig) LeaseTTLDuration() time.Duration {
+	d, _ := time.ParseDuration(scheduler.LeaseTTL)
+	return d
+}
+
+// RunRetentionDuration is how long finished job runs are kept, 0 keeps them forever
+func (scheduler SchedulerConfig) RunRetentionDuration() time.Duration {
+	d, _ := time.ParseDuration(scheduler.RunRetention)
+	return d
+}
+
+// OwnerName is the configured owner or hostname-pid, unique per process
+func (scheduler SchedulerConfig) OwnerName() string {
+	if scheduler.Owner != "" {
+		return scheduler.Owner
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "mauto"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func (scheduler SchedulerConfig) Location() *time.Location {
+	location, err := time.LoadLocation(scheduler.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func (shutdown ShutdownConfig) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(shutdown.Timeout)
+	return d
+}
+
+func (job JobConfig) IsEnabled() bool {
+	return job.Enabled == nil || *job.Enabled
+}
+
+func (job JobConfig) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(job.Timeout)
+	return d
+}
+
+func (alerts AlertConfig) DedupWindowDuration() time.Duration {
+	d, _ := time.ParseDuration(alerts.DedupWindow)
+	return d
+}
+
+func (notify NotificationConfig) IsEnabled() bool {
+	return notify.Enabled != nil && *notify.Enabled
+}
+
+func (notify NotificationConfig) RetryBackoffDuration() time.Duration {
+	d, _ := time.ParseDuration(notify.RetryBackoff)
+	return d
+}
+
+func (notify NotificationConfig) RateLimitDuration() time.Duration {
+	d, _ := time.ParseDuration(notify.RateLimit)
+	return d
+}
+
+func (notify NotificationConfig) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(notify.Timeout)
+	return d
+}
+
+func (httpCfg HTTPConfig) ReadTimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(httpCfg.ReadTimeout)
+	return d
+}
+
+func (httpCfg HTTPConfig) WriteTimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(httpCfg.WriteTimeout)
+	return d
+}
+
+func (auth AuthConfig) AccessTTLDuration() time.Duration {
+	d, _ := time.ParseDuration(auth.AccessTTL)
+	return d
+}
+
+func (auth AuthConfig) RefreshTTLDuration() time.Duration {
+	d, _ := time.ParseDuration(auth.RefreshTTL)
+	return d
+}
+
+func (auth AuthConfig) ResetTTLDuration() time.Duration {
+	d, _ := time.ParseDuration(auth.ResetTTL)
+	return d
+}
+
+// Location is the timezone the feed writes its timestamps in
+func (feed FeedConfig) Location() *time.Location {
+	location, err := time.LoadLocation(feed.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func setIfNotEmpty(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AlertController interface {
+	GetIncidents(ctx *gin.Context)
+	GetIncidentEvents(ctx *gin.Context)
+	AcknowledgeIncident(ctx *gin.Context)
+	ResolveIncident(ctx *gin.Context)
+}
+
+type alertcontroller struct {
+	alertService services.AlertService
+	scopeService services.ScopeService
+}
+
+func NewAlertController(service services.AlertService, scopes services.ScopeService) AlertController {
+	return &alertcontroller{
+		alertService: service,
+		scopeService: scopes,
+	}
+}
+
+var incidentSort = map[string]string{
+	"started_at":   "started_at",
+	"last_seen_at": "last_seen_at",
+	"severity":     "severity",
+	"peak_value":   "peak_value",
+}
+
+// incidentAction is the optional body of acknowledge and resolve, the
+// actor is the signed in user
+type incidentAction struct {
+	Note string `json:"note"`
+}
+
+func (c *alertcontroller) GetIncidents(ctx *gin.Context) {
+	page, err := pageRequest(ctx, incidentSort, "-started_at")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	report, err := reportFilter(ctx, "subject_id")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	filter := models.IncidentFilter{
+		Status:      ctx.Query("status"),
+		SubjectType: ctx.Query("subject_type"),
+		SubjectId:   report.SubjectId,
+		AlertType:   report.AlertType,
+		From:        report.From,
+		To:          report.To,
+	}
+	if filter.SubjectIds, err = c.scopeService.SubjectIds(ctx.Request.Context(), requestScope(ctx)); err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+
+	incidents, total, err := c.alertService.GetIncidents(ctx.Request.Context(), filter, page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, incidents, page, total)
+}
+
+func (c *alertcontroller) GetIncidentEvents(ctx *gin.Context) {
+	incidentId, ok := c.visibleIncident(ctx)
+	if !ok {
+		return
+	}
+
+	events, err := c.alertService.GetIncidentEvents(ctx.Request.Context(), incidentId)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, events)
+}
+
+func (c *alertcontroller) AcknowledgeIncident(ctx *gin.Context) {
+	incidentId, ok := c.visibleIncident(ctx)
+	if !ok {
+		return
+	}
+	action := incidentAction{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&action); err != nil {
+			respondInvalid(ctx, err)
+			return
+		}
+	}
+
+	incident, err := c.alertService.AcknowledgeIncident(ctx.Request.Context(), incidentId, authClaims(ctx).Email, action.Note)
+	if err != nil {
+		respondIncidentError(ctx, err)
+		return
+	}
+	respondOK(ctx, incident)
+}
+
+func (c *alertcontroller) ResolveIncident(ctx *gin.Context) {
+	incidentId, ok := c.visibleIncident(ctx)
+	if !ok {
+		return
+	}
+	action := incidentAction{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&action); err != nil {
+			respondInvalid(ctx, err)
+			return
+		}
+	}
+
+	incident, err := c.alertService.ResolveIncident(ctx.Request.Context(), incidentId, authClaims(ctx).Email, action.Note)
+	if err != nil {
+		respondIncidentError(ctx, err)
+		return
+	}
+	respondOK(ctx, incident)
+}
+
+// visibleIncident reads the incident id and answers 404 when the incident's
+// subject is outside the caller's scope
+func (c *alertcontroller) visibleIncident(ctx *gin.Context) (primitive.ObjectID, bool) {
+	incidentId, ok := incidentIdParam(ctx)
+	if !ok {
+		return incidentId, false
+	}
+
+	scope := requestScope(ctx)
+	if scope.Unrestricted() {
+		return incidentId, true
+	}
+	incident, err := c.alertService.GetIncident(ctx.Request.Context(), incidentId)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return incidentId, false
+	}
+	visible, err := c.scopeService.CanSeeSubject(ctx.Request.Context(), scope, incident.SubjectId)
+	return incidentId, checkVisible(ctx, visible, err)
+}
+
+func incidentIdParam(ctx *gin.Context) (primitive.ObjectID, bool) {
+	incidentId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "id is not a valid incident id")
+		return incidentId, false
+	}
+	return incidentId, true
+}
+
+func respondIncidentError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrIncidentResolved) {
+		respondError(ctx, http.StatusConflict, ErrCodeConflict, err.Error())
+		return
+	}
+	respondServiceError(ctx, err)
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AlertRuleController interface {
+	ListRules(ctx *gin.Context)
+	ActiveRules(ctx *gin.Context)
+	GetRule(ctx *gin.Context)
+	CreateRule(ctx *gin.Context)
+	UpdateRule(ctx *gin.Context)
+	DeleteRule(ctx *gin.Context)
+	GetRuleAudits(ctx *gin.Context)
+}
+
+type alertrulecontroller struct {
+	ruleService services.AlertRuleService
+}
+
+func NewAlertRuleController(service services.AlertRuleService) AlertRuleController {
+	return &alertrulecontroller{
+		ruleService: service,
+	}
+}
+
+var ruleAuditSort = map[string]string{
+	"time": "time",
+}
+
+func (c *alertrulecontroller) ListRules(ctx *gin.Context) {
+	rules, err := c.ruleService.ListRules(ctx.Request.Context())
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, rules)
+}
+
+func (c *alertrulecontroller) ActiveRules(ctx *gin.Context) {
+	respondOK(ctx, c.ruleService.ActiveRules())
+}
+
+func (c *alertrulecontroller) GetRule(ctx *gin.Context) {
+	ruleId, ok := ruleIdParam(ctx)
+	if !ok {
+		return
+	}
+
+	rule, err := c.ruleService.GetRule(ctx.Request.Context(), ruleId)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, rule)
+}
+
+func (c *alertrulecontroller) CreateRule(ctx *gin.Context) {
+	rule := models.AlertConfig{}
+	if err := ctx.ShouldBindJSON(&rule); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	rule, err := c.ruleService.CreateRule(ctx.Request.Context(), authClaims(ctx).Email, rule)
+	if err != nil {
+		respondRuleError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, dataResponse{Data: rule})
+}
+
+// UpdateRule replaces the whole rule, fields left out are reset
+func (c *alertrulecontroller) UpdateRule(ctx *gin.Context) {
+	ruleId, ok := ruleIdParam(ctx)
+	if !ok {
+		return
+	}
+	rule := models.AlertConfig{}
+	if err := ctx.ShouldBindJSON(&rule); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	rule, err := c.ruleService.UpdateRule(ctx.Request.Context(), authClaims(ctx).Email, ruleId, rule)
+	if err != nil {
+		respondRuleError(ctx, err)
+		return
+	}
+	respondOK(ctx, rule)
+}
+
+func (c *alertrulecontroller) DeleteRule(ctx *gin.Context) {
+	ruleId, ok := ruleIdParam(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.ruleService.DeleteRule(ctx.Request.Context(), authClaims(ctx).Email, ruleId); err != nil {
+		respondRuleError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetRuleAudits lists the changes of the rule in the path, or of every rule
+// on /alert-rules/audit
+func (c *alertrulecontroller) GetRuleAudits(ctx *gin.Context) {
+	ruleId := primitive.NilObjectID
+	if ctx.Param("id") != "" {
+		var ok bool
+		if ruleId, ok = ruleIdParam(ctx); !ok {
+			return
+		}
+	}
+	page, err := pageRequest(ctx, ruleAuditSort, "-time")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	audits, total, err := c.ruleService.GetRuleAudits(ctx.Request.Context(), ruleId, page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, audits, page, total)
+}
+
+func ruleIdParam(ctx *gin.Context) (primitive.ObjectID, bool) {
+	ruleId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "id is not a valid alert rule id")
+		return ruleId, false
+	}
+	return ruleId, true
+}
+
+func respondRuleError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidAlertRule) {
+		respondInvalid(ctx, err)
+		return
+	}
+	respondServiceError(ctx, err)
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// error codes of the json error envelope
+const (
+	ErrCodeInvalidRequest = "invalid_request"
+	ErrCodeUnauthorized   = "unauthorized"
+	ErrCodeForbidden      = "forbidden"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeConflict       = "conflict"
+	ErrCodeTimeout        = "timeout"
+	ErrCodeUnavailable    = "unavailable"
+	ErrCodeInternal       = "internal_error"
+	// the signed in user has to change the password first
+	ErrCodePasswordChange = "password_change_required"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type dataResponse struct {
+	Data interface{}      `json:"data"`
+	Meta *models.PageMeta `json:"meta,omitempty"`
+}
+
+func respondOK(ctx *gin.Context, data interface{}) {
+	ctx.JSON(http.StatusOK, dataResponse{Data: data})
+}
+
+func respondPage(ctx *gin.Context, data interface{}, page models.PageRequest, total int64) {
+	ctx.JSON(http.StatusOK, dataResponse{
+		Data: data,
+		Meta: &models.PageMeta{Page: page.Page, Limit: page.Limit, Total: total},
+	})
+}
+
+func respondError(ctx *gin.Context, status int, code, message string) {
+	ctx.AbortWithStatusJSON(status, errorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+func respondInvalid(ctx *gin.Context, err error) {
+	respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+}
+
+// respondServiceError maps the errors services return onto status codes,
+// anything unexpected is logged and hidden from the client
+func respondServiceError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "not found")
+	case errors.Is(err, context.DeadlineExceeded):
+		respondError(ctx, http.StatusGatewayTimeout, ErrCodeTimeout, "the request took too long")
+	default:
+		logger.From(ctx.Request.Context()).WithFields(logger.Fields{
+			"method": ctx.Request.Method,
+			"path":   ctx.FullPath(),
+		}).WithError(err).Error("request failed")
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, "something went wrong")
+	}
+}
+
+// pageRequest reads page, limit and sort from the query. sortable maps the
+// api field names onto stored fields, "-" in front of sort sorts descending.
+func pageRequest(ctx *gin.Context, sortable map[string]string, defaultSort string) (models.PageRequest, error) {
+	page := models.PageRequest{Page: 1, Limit: defaultPageLimit}
+
+	if value := ctx.Query("page"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 {
+			return page, fmt.Errorf("page %q has to be a positive number", value)
+		}
+		page.Page = n
+	}
+	if value := ctx.Query("limit"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return page, fmt.Errorf("limit %q has to be between 1 and %d", value, maxPageLimit)
+		}
+		page.Limit = n
+	}
+
+	sort := ctx.DefaultQuery("sort", defaultSort)
+	page.SortDesc = strings.HasPrefix(sort, "-")
+	field, ok := sortable[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return page, fmt.Errorf("sort %q is not supported", sort)
+	}
+	page.Sort = field
+	return page, nil
+}
+
+// timeQuery reads an RFC 3339 time from the query, fallback is used when
+// the parameter is missing
+func timeQuery(ctx *gin.Context, name string, fallback time.Time) (time.Time, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("%s %q has to be an RFC 3339 time", name, value)
+	}
+	return t.UTC(), nil
+}
+
+// timeRangeQuery reads from and to, by default the last day
+func timeRangeQuery(ctx *gin.Context) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+
+	to, err := timeQuery(ctx, "to", now)
+	if err != nil {
+		return to, to, err
+	}
+	from, err := timeQuery(ctx, "from", to.Add(-24*time.Hour))
+	if err != nil {
+		return from, to, err
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from has to be before to")
+	}
+	return from, to, nil
+}
+
+// reportFilter reads the optional subject and time range of a report list
+func reportFilter(ctx *gin.Context, subjectParam string) (models.ReportFilter, error) {
+	filter := models.ReportFilter{
+		SubjectId: ctx.Query(subjectParam),
+		AlertType: ctx.Query("alert_type"),
+	}
+
+	var err error
+	if filter.From, err = timeQuery(ctx, "from", time.Time{}); err != nil {
+		return filter, err
+	}
+	filter.To, err = timeQuery(ctx, "to", time.Time{})
+	return filter, err
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aniket0951/testproject/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPageRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sortable := map[string]string{
+		"vehicle_no": "vehicleno",
+		"updated_at": "updatedAt",
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    models.PageRequest
+		wantErr bool
+	}{
+		{"defaults", "", models.PageRequest{Page: 1, Limit: defaultPageLimit, Sort: "vehicleno"}, false},
+		{"page and limit", "?page=3&limit=20", models.PageRequest{Page: 3, Limit: 20, Sort: "vehicleno"}, false},
+		{"descending sort", "?sort=-updated_at", models.PageRequest{Page: 1, Limit: defaultPageLimit, Sort: "updatedAt", SortDesc: true}, false},
+		{"largest limit", "?limit=500", models.PageRequest{Page: 1, Limit: maxPageLimit, Sort: "vehicleno"}, false},
+		{"limit over the maximum", "?limit=501", models.PageRequest{}, true},
+		{"zero page", "?page=0", models.PageRequest{}, true},
+		{"page not a number", "?page=two", models.PageRequest{}, true},
+		{"negative limit", "?limit=-5", models.PageRequest{}, true},
+		{"unknown sort field", "?sort=vehicleno", models.PageRequest{}, true},
+		{"unknown descending sort field", "?sort=-branch", models.PageRequest{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/vehicles"+test.query, nil)
+
+			got, err := pageRequest(ctx, sortable, "vehicle_no")
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuthController interface {
+	Login(ctx *gin.Context)
+	Refresh(ctx *gin.Context)
+	Logout(ctx *gin.Context)
+	ChangePassword(ctx *gin.Context)
+	RequestPasswordReset(ctx *gin.Context)
+	ConfirmPasswordReset(ctx *gin.Context)
+
+	ListUsers(ctx *gin.Context)
+	CreateUser(ctx *gin.Context)
+	UpdateUser(ctx *gin.Context)
+}
+
+type authcontroller struct {
+	authService services.AuthService
+}
+
+func NewAuthController(service services.AuthService) AuthController {
+	return &authcontroller{
+		authService: service,
+	}
+}
+
+var userSort = map[string]string{
+	"name":       "name",
+	"email":      "email",
+	"created_at": "createdAt",
+}
+
+type loginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type loginResponse struct {
+	services.TokenPair
+	User models.User `json:"user"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type resetRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type resetConfirmRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+func (c *authcontroller) Login(ctx *gin.Context) {
+	request := loginRequest{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	tokens, user, err := c.authService.Login(ctx.Request.Context(), request.Email, request.Password)
+	if err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	respondOK(ctx, loginResponse{TokenPair: tokens, User: user})
+}
+
+func (c *authcontroller) Refresh(ctx *gin.Context) {
+	request := refreshRequest{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	tokens, err := c.authService.Refresh(ctx.Request.Context(), request.RefreshToken)
+	if err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	respondOK(ctx, tokens)
+}
+
+func (c *authcontroller) Logout(ctx *gin.Context) {
+	userId, ok := signedInUser(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.authService.Logout(ctx.Request.Context(), userId); err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *authcontroller) ChangePassword(ctx *gin.Context) {
+	userId, ok := signedInUser(ctx)
+	if !ok {
+		return
+	}
+	request := changePasswordRequest{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	err := c.authService.ChangePassword(ctx.Request.Context(), userId, request.OldPassword, request.NewPassword)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		// not a 401, the session itself is fine
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "the old password is wrong")
+		return
+	}
+	if err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// RequestPasswordReset answers 202 whether the email exists or not, 503
+// when no email channel is configured
+func (c *authcontroller) RequestPasswordReset(ctx *gin.Context) {
+	request := resetRequest{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	if err := c.authService.RequestPasswordReset(ctx.Request.Context(), request.Email); err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (c *authcontroller) ConfirmPasswordReset(ctx *gin.Context) {
+	request := resetConfirmRequest{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	if err := c.authService.ConfirmPasswordReset(ctx.Request.Context(), request.Token, request.NewPassword); err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *authcontroller) ListUsers(ctx *gin.Context) {
+	page, err := pageRequest(ctx, userSort, "email")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	users, total, err := c.authService.ListUsers(ctx.Request.Context(), page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, users, page, total)
+}
+
+func (c *authcontroller) CreateUser(ctx *gin.Context) {
+	request := services.NewUser{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	user, err := c.authService.CreateUser(ctx.Request.Context(), request)
+	if err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, dataResponse{Data: user})
+}
+
+func (c *authcontroller) UpdateUser(ctx *gin.Context) {
+	userId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "id is not a valid user id")
+		return
+	}
+	request := services.UserUpdate{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	user, err := c.authService.UpdateUser(ctx.Request.Context(), userId, request)
+	if err != nil {
+		respondAuthError(ctx, err)
+		return
+	}
+	respondOK(ctx, user)
+}
+
+// signedInUser is the id of the user behind the access token
+func signedInUser(ctx *gin.Context) (primitive.ObjectID, bool) {
+	claims := authClaims(ctx)
+	if claims == nil {
+		respondError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "a bearer token is required")
+		return primitive.NilObjectID, false
+	}
+
+	userId, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		respondError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, services.ErrInvalidToken.Error())
+		return userId, false
+	}
+	return userId, true
+}
+
+func respondAuthError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidToken):
+		respondError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, err.Error())
+	case errors.Is(err, services.ErrResetUnavailable):
+		respondError(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error())
+	case errors.Is(err, services.ErrEmailTaken):
+		respondError(ctx, http.StatusConflict, ErrCodeConflict, err.Error())
+	case errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrPasswordReused),
+		errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrScopeRequired),
+		errors.Is(err, services.ErrBranchScope), errors.Is(err, services.ErrNameRequired):
+		respondInvalid(ctx, err)
+	default:
+		respondServiceError(ctx, err)
+	}
+}
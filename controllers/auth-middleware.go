@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/services"
+	"github.com/gin-gonic/gin"
+)
+
+const claimsKey = "auth_claims"
+
+// RequireAuth accepts requests with a valid access token in the
+// Authorization header and keeps its claims for the handlers
+func RequireAuth(auth services.AuthService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.GetHeader("Authorization")
+		token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+		if token == "" || token == header {
+			respondError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "a bearer token is required")
+			return
+		}
+
+		claims, err := auth.ParseAccessToken(token)
+		if err != nil {
+			respondError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, err.Error())
+			return
+		}
+
+		ctx.Set(claimsKey, claims)
+		ctx.Next()
+	}
+}
+
+// RequirePasswordChanged stops users created or reset by an admin until
+// they picked their own password, it runs after RequireAuth. After the
+// change a refreshed token gets through.
+func RequirePasswordChanged(ctx *gin.Context) {
+	if claims := authClaims(ctx); claims != nil && claims.PasswordReset {
+		respondError(ctx, http.StatusForbidden, ErrCodePasswordChange, "change your password first, then refresh the token")
+		return
+	}
+	ctx.Next()
+}
+
+// RequireRole lets only the given roles through, it runs after RequireAuth
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims := authClaims(ctx)
+		for _, role := range roles {
+			if claims != nil && claims.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+		respondError(ctx, http.StatusForbidden, ErrCodeForbidden, "your role doesn't allow this")
+	}
+}
+
+func authClaims(ctx *gin.Context) *services.Claims {
+	value, ok := ctx.Get(claimsKey)
+	if !ok {
+		return nil
+	}
+	claims, _ := value.(*services.Claims)
+	return claims
+}
+
+// requestScope is the company and branch the caller is limited to
+func requestScope(ctx *gin.Context) models.Scope {
+	if claims := authClaims(ctx); claims != nil {
+		return claims.Scope()
+	}
+	return models.Scope{}
+}
+
+// checkVisible takes the result of a ScopeService check and answers 404
+// when the caller's scope doesn't cover the subject
+func checkVisible(ctx *gin.Context, visible bool, err error) bool {
+	if err != nil {
+		respondServiceError(ctx, err)
+		return false
+	}
+	if !visible {
+		respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "not found")
+	}
+	return visible
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aniket0951/testproject/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequirePasswordChanged(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		claims *services.Claims
+		want   int
+	}{
+		{"own password", &services.Claims{Email: "a@mauto.in"}, http.StatusOK},
+		{"password set by an admin", &services.Claims{Email: "a@mauto.in", PasswordReset: true}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/vehicles", func(ctx *gin.Context) {
+				ctx.Set(claimsKey, test.claims)
+			}, RequirePasswordChanged, func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("GET", "/vehicles", nil))
+			if recorder.Code != test.want {
+				t.Errorf("status = %d, want %d", recorder.Code, test.want)
+			}
+		})
+	}
+}
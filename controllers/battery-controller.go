@@ -1,5 +1,103 @@
 package controllers
 
+import (
+	"github.com/aniket0951/testproject/services"
+	"github.com/gin-gonic/gin"
+)
+
 type BatteryController interface {
-	UpdateBatteryStatus()
+	GetBattery(ctx *gin.Context)
+	GetChargingReports(ctx *gin.Context)
+	GetCycleReports(ctx *gin.Context)
+	GetUnreportedCounts(ctx *gin.Context)
+}
+
+type batterycontroller struct {
+	batteryService services.BatteryService
+	scopeService   services.ScopeService
+}
+
+func NewBatteryController(service services.BatteryService, scopes services.ScopeService) BatteryController {
+	return &batterycontroller{
+		batteryService: service,
+		scopeService:   scopes,
+	}
+}
+
+var batteryReportSort = map[string]string{
+	"start_time": "start_time",
+	"end_time":   "end_time",
+	"bms_id":     "bms_id",
+	"created_at": "created_at",
+}
+
+func (c *batterycontroller) GetBattery(ctx *gin.Context) {
+	visible, err := c.scopeService.CanSeeBattery(ctx.Request.Context(), requestScope(ctx), ctx.Param("bms_id"))
+	if !checkVisible(ctx, visible, err) {
+		return
+	}
+
+	battery, err := c.batteryService.GetBattery(ctx.Request.Context(), ctx.Param("bms_id"))
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, battery)
+}
+
+func (c *batterycontroller) GetChargingReports(ctx *gin.Context) {
+	page, err := pageRequest(ctx, batteryReportSort, "-start_time")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	filter, err := reportFilter(ctx, "bms_id")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	if filter.SubjectIds, err = c.scopeService.BmsIds(ctx.Request.Context(), requestScope(ctx)); err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+
+	reports, total, err := c.batteryService.GetChargingReports(ctx.Request.Context(), filter, page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, reports, page, total)
+}
+
+func (c *batterycontroller) GetCycleReports(ctx *gin.Context) {
+	page, err := pageRequest(ctx, batteryReportSort, "-start_time")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	filter, err := reportFilter(ctx, "bms_id")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	if filter.SubjectIds, err = c.scopeService.BmsIds(ctx.Request.Context(), requestScope(ctx)); err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+
+	reports, total, err := c.batteryService.GetCycleReports(ctx.Request.Context(), filter, page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, reports, page, total)
+}
+
+func (c *batterycontroller) GetUnreportedCounts(ctx *gin.Context) {
+	counts, err := c.batteryService.GetUnreportedCounts(ctx.Request.Context())
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, counts)
 }
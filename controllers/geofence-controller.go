@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GeofenceController interface {
+	ListGeofences(ctx *gin.Context)
+	CreateGeofence(ctx *gin.Context)
+	DeleteGeofence(ctx *gin.Context)
+	GetVehicleEvents(ctx *gin.Context)
+	GetBatteryEvents(ctx *gin.Context)
+}
+
+type geofencecontroller struct {
+	geofenceService services.GeofenceService
+	scopeService    services.ScopeService
+}
+
+func NewGeofenceController(service services.GeofenceService, scopes services.ScopeService) GeofenceController {
+	return &geofencecontroller{
+		geofenceService: service,
+		scopeService:    scopes,
+	}
+}
+
+func (c *geofencecontroller) ListGeofences(ctx *gin.Context) {
+	fences, err := c.geofenceService.GetGeofences(ctx.Request.Context())
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, fences)
+}
+
+func (c *geofencecontroller) CreateGeofence(ctx *gin.Context) {
+	fence := models.Geofence{}
+	if err := ctx.ShouldBindJSON(&fence); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	fence, err := c.geofenceService.CreateGeofence(ctx.Request.Context(), fence)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidGeofence) {
+			respondInvalid(ctx, err)
+			return
+		}
+		respondServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, dataResponse{Data: fence})
+}
+
+// DeleteGeofence removes the geofence, its events stay as history
+func (c *geofencecontroller) DeleteGeofence(ctx *gin.Context) {
+	fenceId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "id is not a valid geofence id")
+		return
+	}
+
+	if err := c.geofenceService.DeleteGeofence(ctx.Request.Context(), fenceId); err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *geofencecontroller) GetVehicleEvents(ctx *gin.Context) {
+	visible, err := c.scopeService.CanSeeVehicle(ctx.Request.Context(), requestScope(ctx), ctx.Param("vehicle_no"))
+	if !checkVisible(ctx, visible, err) {
+		return
+	}
+	c.respondEvents(ctx, models.GeofenceSubjectVehicle, ctx.Param("vehicle_no"))
+}
+
+func (c *geofencecontroller) GetBatteryEvents(ctx *gin.Context) {
+	visible, err := c.scopeService.CanSeeBattery(ctx.Request.Context(), requestScope(ctx), ctx.Param("bms_id"))
+	if !checkVisible(ctx, visible, err) {
+		return
+	}
+	c.respondEvents(ctx, models.GeofenceSubjectBattery, ctx.Param("bms_id"))
+}
+
+// respondEvents lists the enter, exit and dwell events of one subject
+// between from and to, by default the last day
+func (c *geofencecontroller) respondEvents(ctx *gin.Context, subjectType, subjectId string) {
+	from, to, err := timeRangeQuery(ctx)
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	events, err := c.geofenceService.GetEvents(ctx.Request.Context(), subjectType, subjectId, from, to)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, events)
+}
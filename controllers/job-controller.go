@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aniket0951/testproject/jobs"
+	"github.com/aniket0951/testproject/models"
+	"github.com/gin-gonic/gin"
+)
+
+type JobController interface {
+	ListJobs(ctx *gin.Context)
+	GetJob(ctx *gin.Context)
+	TriggerJob(ctx *gin.Context)
+	PauseJob(ctx *gin.Context)
+	ResumeJob(ctx *gin.Context)
+	GetJobRuns(ctx *gin.Context)
+	GetLeader(ctx *gin.Context)
+}
+
+type jobcontroller struct {
+	registry jobs.Registry
+}
+
+func NewJobController(registry jobs.Registry) JobController {
+	return &jobcontroller{
+		registry: registry,
+	}
+}
+
+var jobRunSort = map[string]string{
+	"started_at":  "started_at",
+	"duration_ms": "duration_ms",
+}
+
+func (c *jobcontroller) ListJobs(ctx *gin.Context) {
+	statuses, err := c.registry.List(ctx.Request.Context())
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, statuses)
+}
+
+func (c *jobcontroller) GetJob(ctx *gin.Context) {
+	c.respondStatus(ctx, http.StatusOK)
+}
+
+// TriggerJob answers 202 right away, the run shows up in the job status
+func (c *jobcontroller) TriggerJob(ctx *gin.Context) {
+	if err := c.registry.Trigger(ctx.Param("name")); err != nil {
+		respondJobError(ctx, err)
+		return
+	}
+	c.respondStatus(ctx, http.StatusAccepted)
+}
+
+func (c *jobcontroller) PauseJob(ctx *gin.Context) {
+	if err := c.registry.Pause(ctx.Request.Context(), ctx.Param("name")); err != nil {
+		respondJobError(ctx, err)
+		return
+	}
+	c.respondStatus(ctx, http.StatusOK)
+}
+
+func (c *jobcontroller) ResumeJob(ctx *gin.Context) {
+	if err := c.registry.Resume(ctx.Request.Context(), ctx.Param("name")); err != nil {
+		respondJobError(ctx, err)
+		return
+	}
+	c.respondStatus(ctx, http.StatusOK)
+}
+
+// GetJobRuns lists the recorded runs of a job, optionally filtered by status
+// and a from/to range on the start time
+func (c *jobcontroller) GetJobRuns(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if _, err := c.registry.Status(ctx.Request.Context(), name); err != nil {
+		respondJobError(ctx, err)
+		return
+	}
+	page, err := pageRequest(ctx, jobRunSort, "-started_at")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	filter := models.JobRunFilter{Job: name, Status: ctx.Query("status")}
+	if filter.From, err = timeQuery(ctx, "from", time.Time{}); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	if filter.To, err = timeQuery(ctx, "to", time.Time{}); err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+
+	runs, total, err := c.registry.Runs(ctx.Request.Context(), filter, page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, runs, page, total)
+}
+
+// GetLeader shows which replica holds the scheduler lease
+func (c *jobcontroller) GetLeader(ctx *gin.Context) {
+	lock, err := c.registry.Leader(ctx.Request.Context())
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, lock)
+}
+
+func (c *jobcontroller) respondStatus(ctx *gin.Context, code int) {
+	status, err := c.registry.Status(ctx.Request.Context(), ctx.Param("name"))
+	if err != nil {
+		respondJobError(ctx, err)
+		return
+	}
+	ctx.JSON(code, dataResponse{Data: status})
+}
+
+func respondJobError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		respondError(ctx, http.StatusNotFound, ErrCodeNotFound, err.Error())
+	case errors.Is(err, jobs.ErrJobRunning), errors.Is(err, jobs.ErrNotLeader), errors.Is(err, jobs.ErrStopping):
+		respondError(ctx, http.StatusConflict, ErrCodeConflict, err.Error())
+	default:
+		respondServiceError(ctx, err)
+	}
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter wires the api routes, every response uses the json envelopes of
+// api-response.go. Everything under /api/v1 but login, refresh and the
+// password reset needs an access token from authenticate, and everything
+// but logout and the password change a password the user picked.
+func NewRouter(auth AuthController, authenticate gin.HandlerFunc, vehicle VehicleController, battery BatteryController, alert AlertController, rule AlertRuleController, geofence GeofenceController, job JobController) *gin.Engine {
+	router := gin.New()
+	router.Use(requestLog, gin.CustomRecovery(func(ctx *gin.Context, recovered interface{}) {
+		logger.From(ctx.Request.Context()).WithField("panic", recovered).Error("request panicked")
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, "something went wrong")
+	}))
+
+	router.NoRoute(func(ctx *gin.Context) {
+		respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "no such route")
+	})
+	router.GET("/health", func(ctx *gin.Context) {
+		respondOK(ctx, gin.H{"status": "ok"})
+	})
+
+	api := router.Group("/api/v1")
+
+	public := api.Group("/auth")
+	public.POST("/login", auth.Login)
+	public.POST("/refresh", auth.Refresh)
+	public.POST("/password-reset/request", auth.RequestPasswordReset)
+	public.POST("/password-reset/confirm", auth.ConfirmPasswordReset)
+
+	// fleet clients only see their own company, see ScopeService
+	signedIn := api.Group("", authenticate)
+	signedIn.POST("/auth/logout", auth.Logout)
+	signedIn.POST("/auth/password", auth.ChangePassword)
+	// the rest needs a password the user picked
+	signedIn = signedIn.Group("", RequirePasswordChanged)
+
+	vehicles := signedIn.Group("/vehicles")
+	vehicles.GET("", vehicle.ListVehicles)
+	vehicles.GET("/:vehicle_no/track", vehicle.GetVehicleTrack)
+	vehicles.GET("/:vehicle_no/trips", vehicle.GetVehicleTrips)
+	vehicles.GET("/:vehicle_no/state-events", vehicle.GetVehicleStateEvents)
+	vehicles.GET("/:vehicle_no/geofence-events", geofence.GetVehicleEvents)
+
+	signedIn.GET("/batteries/:bms_id", battery.GetBattery)
+	signedIn.GET("/batteries/:bms_id/geofence-events", geofence.GetBatteryEvents)
+
+	reports := signedIn.Group("/reports")
+	reports.GET("/charging", battery.GetChargingReports)
+	reports.GET("/cycles", battery.GetCycleReports)
+	// the counts cover every battery, so they stay internal
+	reports.GET("/unreported", RequireRole(models.RoleAdmin, models.RoleOperator, models.RoleViewer), battery.GetUnreportedCounts)
+
+	alerts := signedIn.Group("/alerts")
+	alerts.GET("/history", vehicle.GetAlertHistory)
+	alerts.GET("/incidents", alert.GetIncidents)
+	alerts.GET("/incidents/:id/events", alert.GetIncidentEvents)
+
+	operators := alerts.Group("", RequireRole(models.RoleAdmin, models.RoleOperator))
+	operators.POST("/incidents/:id/acknowledge", alert.AcknowledgeIncident)
+	operators.POST("/incidents/:id/resolve", alert.ResolveIncident)
+
+	// thresholds are the same for every company, fleet clients don't see them
+	rules := signedIn.Group("/alert-rules", RequireRole(models.RoleAdmin, models.RoleOperator, models.RoleViewer))
+	rules.GET("", rule.ListRules)
+	rules.GET("/active", rule.ActiveRules)
+	rules.GET("/audit", rule.GetRuleAudits)
+	rules.GET("/:id", rule.GetRule)
+	rules.GET("/:id/audit", rule.GetRuleAudits)
+
+	ruleAdmins := rules.Group("", RequireRole(models.RoleAdmin))
+	ruleAdmins.POST("", rule.CreateRule)
+	ruleAdmins.PUT("/:id", rule.UpdateRule)
+	ruleAdmins.DELETE("/:id", rule.DeleteRule)
+
+	// depots, charging stations and restricted zones, shared by every company
+	geofences := signedIn.Group("/geofences", RequireRole(models.RoleAdmin, models.RoleOperator, models.RoleViewer))
+	geofences.GET("", geofence.ListGeofences)
+
+	geofenceAdmins := geofences.Group("", RequireRole(models.RoleAdmin))
+	geofenceAdmins.POST("", geofence.CreateGeofence)
+	geofenceAdmins.DELETE("/:id", geofence.DeleteGeofence)
+
+	jobs := signedIn.Group("/jobs", RequireRole(models.RoleAdmin))
+	jobs.GET("", job.ListJobs)
+	jobs.GET("/leader", job.GetLeader)
+	jobs.GET("/:name", job.GetJob)
+	jobs.GET("/:name/runs", job.GetJobRuns)
+	jobs.POST("/:name/trigger", job.TriggerJob)
+	jobs.POST("/:name/pause", job.PauseJob)
+	jobs.POST("/:name/resume", job.ResumeJob)
+
+	users := signedIn.Group("/users", RequireRole(models.RoleAdmin))
+	users.GET("", auth.ListUsers)
+	users.POST("", auth.CreateUser)
+	users.PATCH("/:id", auth.UpdateUser)
+
+	return router
+}
+
+// requestLog writes one json line per request in place of gin's text log
+func requestLog(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+
+	logger.From(ctx.Request.Context()).WithFields(logger.Fields{
+		"method":      ctx.Request.Method,
+		"path":        ctx.Request.URL.Path,
+		"status":      ctx.Writer.Status(),
+		"duration_ms": time.Since(start).Milliseconds(),
+		"client_ip":   ctx.ClientIP(),
+	}).Info("request")
+}
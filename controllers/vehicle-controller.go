@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/aniket0951/testproject/models"
 	"github.com/aniket0951/testproject/proxyapis"
 	"github.com/aniket0951/testproject/services"
-	"github.com/mashingan/smapping"
+	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,77 +16,214 @@ type VehicleController interface {
 	AddUpdateVehicleInformation()
 	AddVehicleLocationData()
 	TrackVehicleAlert()
+
+	ListVehicles(ctx *gin.Context)
+	GetVehicleTrack(ctx *gin.Context)
+	GetVehicleTrips(ctx *gin.Context)
+	GetVehicleStateEvents(ctx *gin.Context)
+	GetAlertHistory(ctx *gin.Context)
 }
 
 type vehiclecontroller struct {
-	vehicleService services.VehicleServices
+	vehicleService  services.VehicleServices
+	scopeService    services.ScopeService
+	feed            proxyapis.FeedProvider
+	snapshotOptions models.SnapshotOptions
 }
 
-func NewVehicleController(service services.VehicleServices) VehicleController {
+func NewVehicleController(service services.VehicleServices, scopes services.ScopeService, feed proxyapis.FeedProvider, snapshotOptions models.SnapshotOptions) VehicleController {
 	return &vehiclecontroller{
-		vehicleService: service,
+		vehicleService:  service,
+		scopeService:    scopes,
+		feed:            feed,
+		snapshotOptions: snapshotOptions,
 	}
 }
 
 func (c *vehiclecontroller) AddUpdateVehicleInformation() {
-	reqURL := "http://fusioniot.mobilogix.com/webservice?token=getLiveData&user=skroman@mautoafrica.com&pass=Mauto@777"
+	ctx := context.Background()
+	vehicleInfo, err := c.feed.FetchVehicles(ctx)
+	if err != nil || len(vehicleInfo) <= 0 {
+		return
+	}
+
+	for i := range vehicleInfo {
+		vehicleInfo[i].TimeStamp = primitive.NewDateTimeFromTime(time.Now())
+		vehicleInfo[i].CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+		vehicleInfo[i].UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+	}
+	_ = c.vehicleService.AddUpdateVehicleInformation(ctx, vehicleInfo)
 
-	requestChannel := make(chan models.AutoGenerated)
-	proxyapis.GetAllVehicels(reqURL, requestChannel)
+}
 
-	if len(requestChannel) <= 0 {
+func (c *vehiclecontroller) AddVehicleLocationData() {
+	ctx := context.Background()
+	vehicleData, err := c.feed.FetchVehicles(ctx)
+	if err != nil {
 		return
 	}
 
-	var vehicleInfo []models.VehiclesData
+	vehicleLocation := []models.VehicleLocationData{}
+
+	for i := range vehicleData {
+		vehicleLocationToCreate := models.VehicleLocationData{}
+
+		vehicleLocationToCreate.Id = primitive.NewObjectID()
+		vehicleLocationToCreate.CreatedAt = time.Now()
+		vehicleLocationToCreate.UpdatedAt = time.Now()
+		vehicleLocationToCreate.Latitude = vehicleData[i].Latitude
+		vehicleLocationToCreate.Longitude = vehicleData[i].Longitude
+		vehicleLocationToCreate.Location = vehicleData[i].Location
+		vehicleLocationToCreate.VehicleNo = vehicleData[i].VehicleNo
+
+		snapshot := models.ParseVehicleSnapshot(vehicleData[i], vehicleLocationToCreate.CreatedAt, c.snapshotOptions)
+		vehicleLocationToCreate.Speed = snapshot.Speed
+		vehicleLocationToCreate.Heading = snapshot.Angle
+		vehicleLocationToCreate.GPSTime = snapshot.FixTime()
+
+		vehicleLocation = append(vehicleLocation, vehicleLocationToCreate)
+	}
+	c.vehicleService.AddVehicleLocationData(ctx, vehicleLocation)
+}
+
+func (c *vehiclecontroller) TrackVehicleAlert() {
+	// err := c.vehicleService.TrackVehicleAlert()
 
-	for i := range requestChannel {
-		for ik := range i.Root.VehicleData {
+	// fmt.Println("err =>", err)
+}
 
-			singleVehicleInfo := models.VehiclesData{}
+var vehicleSort = map[string]string{
+	"vehicle_no": "vehicleno",
+	"branch":     "branch",
+	"status":     "status",
+	"updated_at": "updatedAt",
+	"timestamp":  "timeStamp",
+}
 
-			_ = smapping.FillStruct(&singleVehicleInfo, smapping.MapFields(&i.Root.VehicleData[ik]))
+var alertHistorySort = map[string]string{
+	"history_timestamp": "history_timestamp",
+	"alert_count":       "alert_count",
+}
 
-			singleVehicleInfo.TimeStamp = primitive.NewDateTimeFromTime(time.Now())
-			singleVehicleInfo.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
-			singleVehicleInfo.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+func (c *vehiclecontroller) ListVehicles(ctx *gin.Context) {
+	page, err := pageRequest(ctx, vehicleSort, "vehicle_no")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
 
-			vehicleInfo = append(vehicleInfo, singleVehicleInfo)
+	filter := models.VehicleFilter{
+		Branch:      ctx.Query("branch"),
+		Company:     ctx.Query("company"),
+		Status:      ctx.Query("status"),
+		VehicleType: ctx.Query("vehicle_type"),
+		VehicleNo:   ctx.Query("vehicle_no"),
+	}
+	// scoped users can narrow their own company down but never leave it
+	if scope := requestScope(ctx); !scope.Unrestricted() {
+		filter.Company = scope.Company
+		if scope.Branch != "" {
+			filter.Branch = scope.Branch
 		}
 	}
-	_ = c.vehicleService.AddUpdateVehicleInformation(vehicleInfo)
 
+	vehicles, total, err := c.vehicleService.ListVehicles(ctx.Request.Context(), filter, page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, vehicles, page, total)
 }
 
-func (c *vehiclecontroller) AddVehicleLocationData() {
-	reqURL := "http://fusioniot.mobilogix.com/webservice?token=getLiveData&user=skroman@mautoafrica.com&pass=Mauto@777"
+func (c *vehiclecontroller) GetVehicleTrack(ctx *gin.Context) {
+	if !c.vehicleVisible(ctx) {
+		return
+	}
+	from, to, err := timeRangeQuery(ctx)
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
 
-	requestChannel := make(chan models.AutoGenerated)
-	go proxyapis.GetAllVehicels(reqURL, requestChannel)
+	var interval time.Duration
+	if value := ctx.Query("interval"); value != "" {
+		if interval, err = time.ParseDuration(value); err != nil || interval < 0 {
+			respondInvalid(ctx, fmt.Errorf("interval %q is not a valid duration", value))
+			return
+		}
+	}
 
-	vehicleLocation := []models.VehicleLocationData{}
+	track, err := c.vehicleService.GetVehicleTrack(ctx.Request.Context(), ctx.Param("vehicle_no"), from, to, interval)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, track)
+}
 
-	for i := range requestChannel {
-		for ik := range i.Root.VehicleData {
+func (c *vehiclecontroller) GetVehicleTrips(ctx *gin.Context) {
+	if !c.vehicleVisible(ctx) {
+		return
+	}
+	from, to, err := timeRangeQuery(ctx)
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
 
-			vehicleLocationToCreate := models.VehicleLocationData{}
+	trips, err := c.vehicleService.GetVehicleTrips(ctx.Request.Context(), ctx.Param("vehicle_no"), from, to)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondOK(ctx, trips)
+}
 
-			vehicleLocationToCreate.Id = primitive.NewObjectID()
-			vehicleLocationToCreate.CreatedAt = time.Now()
-			vehicleLocationToCreate.UpdatedAt = time.Now()
-			vehicleLocationToCreate.Latitude = i.Root.VehicleData[ik].Latitude
-			vehicleLocationToCreate.Longitude = i.Root.VehicleData[ik].Longitude
-			vehicleLocationToCreate.Location = i.Root.VehicleData[ik].Location
-			vehicleLocationToCreate.VehicleNo = i.Root.VehicleData[ik].VehicleNo
+func (c *vehiclecontroller) GetVehicleStateEvents(ctx *gin.Context) {
+	if !c.vehicleVisible(ctx) {
+		return
+	}
+	from, to, err := timeRangeQuery(ctx)
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
 
-			vehicleLocation = append(vehicleLocation, vehicleLocationToCreate)
-		}
+	events, err := c.vehicleService.GetVehicleStateEvents(ctx.Request.Context(), ctx.Param("vehicle_no"), from, to)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
 	}
-	c.vehicleService.AddVehicleLocationData(vehicleLocation)
+	respondOK(ctx, events)
 }
 
-func (c *vehiclecontroller) TrackVehicleAlert() {
-	// err := c.vehicleService.TrackVehicleAlert()
+// GetAlertHistory lists the daily alert history of vehicles and batteries,
+// subject_id matches a vehicle number or a bms id
+func (c *vehiclecontroller) GetAlertHistory(ctx *gin.Context) {
+	page, err := pageRequest(ctx, alertHistorySort, "-history_timestamp")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	filter, err := reportFilter(ctx, "subject_id")
+	if err != nil {
+		respondInvalid(ctx, err)
+		return
+	}
+	if filter.SubjectIds, err = c.scopeService.SubjectIds(ctx.Request.Context(), requestScope(ctx)); err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
 
-	// fmt.Println("err =>", err)
+	history, total, err := c.vehicleService.GetAlertHistory(ctx.Request.Context(), filter, page)
+	if err != nil {
+		respondServiceError(ctx, err)
+		return
+	}
+	respondPage(ctx, history, page, total)
+}
+
+func (c *vehiclecontroller) vehicleVisible(ctx *gin.Context) bool {
+	visible, err := c.scopeService.CanSeeVehicle(ctx.Request.Context(), requestScope(ctx), ctx.Param("vehicle_no"))
+	return checkVisible(ctx, visible, err)
 }
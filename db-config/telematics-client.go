@@ -0,0 +1,282 @@
+package dbconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultConnectAttempts     = 5
+	defaultBaseBackoff         = 500 * time.Millisecond
+	defaultMaxBackoff          = 15 * time.Second
+)
+
+var ErrClientClosed = errors.New("mongo client is closed")
+
+// ManagedClient owns a single pooled mongo.Client. It connects lazily on the
+// first Database call, pings the cluster at most once per HealthCheckInterval
+// and transparently reconnects with exponential backoff when the ping fails.
+type ManagedClient struct {
+	uri      string
+	database string
+
+	HealthCheckInterval time.Duration
+	ConnectAttempts     int
+	BaseBackoff         time.Duration
+	MaxBackoff          time.Duration
+
+	mu        sync.Mutex
+	client    *mongo.Client
+	lastCheck time.Time
+	dial      *dialCall
+	closed    bool
+}
+
+// dialCall is the reconnect every caller waits on while the pool is down
+type dialCall struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	client *mongo.Client
+	err    error
+}
+
+func NewManagedClient(uri, database string) *ManagedClient {
+	return &ManagedClient{
+		uri:                 uri,
+		database:            database,
+		HealthCheckInterval: defaultHealthCheckInterval,
+		ConnectAttempts:     defaultConnectAttempts,
+		BaseBackoff:         defaultBaseBackoff,
+		MaxBackoff:          defaultMaxBackoff,
+	}
+}
+
+// Database returns the configured database on a healthy client
+func (m *ManagedClient) Database(ctx context.Context) (*mongo.Database, error) {
+	client, err := m.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Database(m.database), nil
+}
+
+// Client returns the pooled client, connecting or reconnecting when needed.
+// The health check pings with its own timeout so a caller whose ctx is about
+// to end can't get the shared pool dropped, and a reconnect is dialled once
+// for all callers outside the lock.
+func (m *ManagedClient) Client(ctx context.Context) (*mongo.Client, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	client := m.client
+	fresh := client != nil && time.Since(m.lastCheck) < m.HealthCheckInterval
+	m.mu.Unlock()
+
+	if fresh {
+		return client, nil
+	}
+
+	if client != nil {
+		if err := m.healthCheck(client); err == nil {
+			m.mu.Lock()
+			if m.client == client {
+				m.lastCheck = time.Now()
+			}
+			m.mu.Unlock()
+			return client, nil
+		}
+
+		// the pool is unhealthy, drop it and build a new one
+		m.mu.Lock()
+		if m.client == client {
+			m.client = nil
+		} else {
+			client = nil
+		}
+		m.mu.Unlock()
+		if client != nil {
+			go m.disconnect(client)
+		}
+	}
+
+	return m.dialShared(ctx)
+}
+
+func (m *ManagedClient) healthCheck(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultHealthCheckTimeout)
+	defer cancel()
+
+	return client.Ping(ctx, nil)
+}
+
+// dialShared waits for the reconnect in flight or starts one, ctx only bounds
+// how long this caller waits for it
+func (m *ManagedClient) dialShared(ctx context.Context) (*mongo.Client, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	if m.client != nil {
+		client := m.client
+		m.mu.Unlock()
+		return client, nil
+	}
+
+	call := m.dial
+	if call == nil {
+		dialCtx, cancel := context.WithCancel(context.Background())
+		call = &dialCall{done: make(chan struct{}), cancel: cancel}
+		m.dial = call
+		go m.redial(dialCtx, call)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.client, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *ManagedClient) redial(ctx context.Context, call *dialCall) {
+	defer call.cancel()
+	client, err := m.connectWithBackoff(ctx)
+
+	m.mu.Lock()
+	if err == nil && m.closed {
+		go m.disconnect(client)
+		client, err = nil, ErrClientClosed
+	}
+	if err == nil {
+		m.client = client
+		m.lastCheck = time.Now()
+	}
+	m.dial = nil
+	call.client, call.err = client, err
+	m.mu.Unlock()
+
+	close(call.done)
+}
+
+func (m *ManagedClient) disconnect(client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultHealthCheckTimeout)
+	defer cancel()
+
+	_ = client.Disconnect(ctx)
+}
+
+func (m *ManagedClient) connectWithBackoff(ctx context.Context) (*mongo.Client, error) {
+	var lastErr error
+	backoff := m.BaseBackoff
+
+	for attempt := 1; attempt <= m.ConnectAttempts; attempt++ {
+		client, err := m.connect(ctx)
+		if err == nil {
+			return client, nil
+		}
+		lastErr = err
+
+		if attempt == m.ConnectAttempts {
+			break
+		}
+
+		// full jitter so several replicas don't hammer the cluster together
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connect to %s : %w", m.database, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > m.MaxBackoff {
+			backoff = m.MaxBackoff
+		}
+	}
+
+	return nil, fmt.Errorf("connect to %s after %d attempts : %w", m.database, m.ConnectAttempts, lastErr)
+}
+
+func (m *ManagedClient) connect(ctx context.Context) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(m.uri))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Ping forces a health check against the cluster
+func (m *ManagedClient) Ping(ctx context.Context) error {
+	client, err := m.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.lastCheck = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// Close disconnects the pool, any later call returns ErrClientClosed
+func (m *ManagedClient) Close(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	if m.dial != nil {
+		m.dial.cancel()
+	}
+	if m.client == nil {
+		return nil
+	}
+
+	err := m.client.Disconnect(ctx)
+	m.client = nil
+	return err
+}
+
+var telematicsClient *ManagedClient
+var telematicsOnce sync.Once
+
+// ResolveTelematicsClient returns the shared client for the BMSIngestion
+// cluster. Nothing is dialled until the first Database call.
+func ResolveTelematicsClient() *ManagedClient {
+	telematicsOnce.Do(func() {
+		telematicsClient = NewManagedClient(MongoURI(), TelematicsDatabaseName())
+	})
+
+	return telematicsClient
+}
+
+func CloseTelematicsClient(ctx context.Context) error {
+	if telematicsClient == nil {
+		return nil
+	}
+
+	return telematicsClient.Close(ctx)
+}
@@ -0,0 +1,27 @@
+package helper
+
+// PointInPolygon reports whether point lies inside polygon using ray casting,
+// the polygon may be open or closed (first vertex repeated at the end)
+func PointInPolygon(point Coordinates, polygon []Coordinates) bool {
+	inside := false
+	n := len(polygon)
+	if n < 3 {
+		return false
+	}
+
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Latitude > point.Latitude) != (b.Latitude > point.Latitude) {
+			crossLng := (b.Longitude-a.Longitude)*(point.Latitude-a.Latitude)/(b.Latitude-a.Latitude) + a.Longitude
+			if point.Longitude < crossLng {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// InCircle reports whether point is within radiusMeters of center
+func InCircle(point, center Coordinates, radiusMeters float64) bool {
+	return center.Distance(point)*1000 <= radiusMeters
+}
@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"math"
+	"time"
+)
+
+// reasons a fix is rejected by GPSFilter
+const (
+	GPSRejectInvalid         = "invalid"
+	GPSRejectZero            = "zero"
+	GPSRejectImpossibleSpeed = "impossible_speed"
+	GPSRejectIdleDrift       = "idle_drift"
+)
+
+// GPSFix is one position report as seen by the filter
+type GPSFix struct {
+	Point Coordinates
+	Time  time.Time
+	// IgnitionOff is only true when the device reported the ignition as off,
+	// an unknown ignition state never counts as parked
+	IgnitionOff bool
+}
+
+// GPSFilter decides whether the movement between the last accepted fix and
+// a new one is real, parked devices jitter by tens of metres and bad fixes
+// jump across continents
+type GPSFilter struct {
+	MaxSpeedKmph    float64
+	IdleDriftMeters float64
+}
+
+// ValidPoint rejects out of range coordinates and the (0,0) "no fix" point
+func (f GPSFilter) ValidPoint(point Coordinates) (bool, string) {
+	if math.IsNaN(point.Latitude) || math.IsNaN(point.Longitude) ||
+		point.Latitude < -90 || point.Latitude > 90 ||
+		point.Longitude < -180 || point.Longitude > 180 {
+		return false, GPSRejectInvalid
+	}
+	if math.Abs(point.Latitude) < 1e-6 && math.Abs(point.Longitude) < 1e-6 {
+		return false, GPSRejectZero
+	}
+	return true, ""
+}
+
+// Accept returns the distance in km to add for the move from last to
+// current, or the rejection reason when the move should be ignored
+func (f GPSFilter) Accept(last, current GPSFix) (float64, string) {
+	if ok, reason := f.ValidPoint(current.Point); !ok {
+		return 0, reason
+	}
+
+	distance := last.Point.Distance(current.Point)
+
+	if current.IgnitionOff && distance*1000 < f.IdleDriftMeters {
+		return 0, GPSRejectIdleDrift
+	}
+
+	elapsed := current.Time.Sub(last.Time).Hours()
+	if elapsed <= 0 {
+		// a resent fix, anything beyond jitter would need infinite speed
+		if distance*1000 > f.IdleDriftMeters {
+			return 0, GPSRejectImpossibleSpeed
+		}
+		return 0, ""
+	}
+
+	if f.MaxSpeedKmph > 0 && distance/elapsed > f.MaxSpeedKmph {
+		return 0, GPSRejectImpossibleSpeed
+	}
+
+	return distance, ""
+}
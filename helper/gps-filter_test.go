@@ -0,0 +1,95 @@
+package helper
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGPSFilterAccept(t *testing.T) {
+	filter := GPSFilter{MaxSpeedKmph: 150, IdleDriftMeters: 50}
+	start := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+	last := GPSFix{Point: Coordinates{Latitude: 18.5, Longitude: 73.8}, Time: start}
+
+	// 0.01 degrees of latitude are about 1.11 km, 0.0002 about 22 m
+	tests := []struct {
+		name        string
+		current     GPSFix
+		wantReason  string
+		wantMovedKm float64
+	}{
+		{
+			name:        "normal drive",
+			current:     GPSFix{Point: Coordinates{Latitude: 18.51, Longitude: 73.8}, Time: start.Add(time.Minute)},
+			wantMovedKm: 1.11,
+		},
+		{
+			name:       "jump at impossible speed",
+			current:    GPSFix{Point: Coordinates{Latitude: 19.5, Longitude: 73.8}, Time: start.Add(time.Minute)},
+			wantReason: GPSRejectImpossibleSpeed,
+		},
+		{
+			name:       "parked drift",
+			current:    GPSFix{Point: Coordinates{Latitude: 18.5002, Longitude: 73.8}, Time: start.Add(time.Minute), IgnitionOff: true},
+			wantReason: GPSRejectIdleDrift,
+		},
+		{
+			name:        "small move with ignition on counts",
+			current:     GPSFix{Point: Coordinates{Latitude: 18.5002, Longitude: 73.8}, Time: start.Add(time.Minute)},
+			wantMovedKm: 0.022,
+		},
+		{
+			name:        "towed while parked counts",
+			current:     GPSFix{Point: Coordinates{Latitude: 18.51, Longitude: 73.8}, Time: start.Add(time.Hour), IgnitionOff: true},
+			wantMovedKm: 1.11,
+		},
+		{
+			name:    "resent fix",
+			current: GPSFix{Point: Coordinates{Latitude: 18.5002, Longitude: 73.8}, Time: start},
+		},
+		{
+			name:       "resent fix far away",
+			current:    GPSFix{Point: Coordinates{Latitude: 18.51, Longitude: 73.8}, Time: start},
+			wantReason: GPSRejectImpossibleSpeed,
+		},
+		{
+			name:       "no fix",
+			current:    GPSFix{Point: Coordinates{}, Time: start.Add(time.Minute)},
+			wantReason: GPSRejectZero,
+		},
+		{
+			name:       "out of range",
+			current:    GPSFix{Point: Coordinates{Latitude: 91, Longitude: 73.8}, Time: start.Add(time.Minute)},
+			wantReason: GPSRejectInvalid,
+		},
+		{
+			name:       "not a number",
+			current:    GPSFix{Point: Coordinates{Latitude: math.NaN(), Longitude: 73.8}, Time: start.Add(time.Minute)},
+			wantReason: GPSRejectInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			moved, reason := filter.Accept(last, test.current)
+
+			if reason != test.wantReason {
+				t.Fatalf("reason = %q, want %q", reason, test.wantReason)
+			}
+			if math.Abs(moved-test.wantMovedKm) > 0.01 {
+				t.Errorf("moved = %.3f km, want %.3f km", moved, test.wantMovedKm)
+			}
+		})
+	}
+}
+
+func TestGPSFilterWithoutSpeedLimit(t *testing.T) {
+	filter := GPSFilter{IdleDriftMeters: 50}
+	start := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+	last := GPSFix{Point: Coordinates{Latitude: 18.5, Longitude: 73.8}, Time: start}
+	current := GPSFix{Point: Coordinates{Latitude: 19.5, Longitude: 73.8}, Time: start.Add(time.Minute)}
+
+	if moved, reason := filter.Accept(last, current); reason != "" || moved < 100 {
+		t.Errorf("a zero MaxSpeedKmph should not limit the speed, got %.1f km, %q", moved, reason)
+	}
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+type itemsKey struct{}
+
+// items collects what one run handled
+type items struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func withItems(ctx context.Context) (context.Context, *items) {
+	run := &items{counts: map[string]int64{}}
+	return context.WithValue(ctx, itemsKey{}, run), run
+}
+
+// AddItems counts n handled items of a kind towards the job run of ctx,
+// e.g. AddItems(ctx, "moved", len(moved)). Outside a run it does nothing.
+func AddItems(ctx context.Context, kind string, n int) {
+	run, ok := ctx.Value(itemsKey{}).(*items)
+	if !ok {
+		return
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.counts[kind] += int64(n)
+}
+
+func (run *items) snapshot() map[string]int64 {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if len(run.counts) == 0 {
+		return nil
+	}
+	counts := make(map[string]int64, len(run.counts))
+	for kind, n := range run.counts {
+		counts[kind] = n
+	}
+	return counts
+}
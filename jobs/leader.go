@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+)
+
+// LeaderLock is the job_locks lease the replicas compete for, only the
+// replica holding it runs jobs
+const LeaderLock = "scheduler"
+
+var ErrNotLeader = errors.New("jobs run on the replica holding the scheduler lease")
+
+// Lease identifies this replica in job_locks. The lease is renewed every
+// third of TTL, so a replica that dies is replaced after at most TTL.
+type Lease struct {
+	Owner string
+	TTL   time.Duration
+}
+
+// holdLease keeps renewing the lease, or keeps trying to take it over
+func (r *registry) holdLease() {
+	ticker := time.NewTicker(r.lease.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.renewLease()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *registry) renewLease() {
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+
+	r.mu.Lock()
+	stopping := r.stopping
+	r.mu.Unlock()
+	if stopping {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.lease.TTL/3)
+	defer cancel()
+
+	renewedAt := time.Now()
+	held, err := r.locks.AcquireJobLock(ctx, LeaderLock, r.lease.Owner, r.lease.TTL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		logger.From(ctx).WithField(logger.FieldOwner, r.lease.Owner).WithError(err).Warn("failed to renew the scheduler lease")
+		// still ours until the last renewal runs out, stepping down one
+		// renewal early leaves no gap for a second replica to start jobs
+		held = r.isLeader && time.Now().Add(r.lease.TTL/3).Before(r.leaseUntil)
+	} else if held {
+		r.leaseUntil = renewedAt.Add(r.lease.TTL)
+	}
+	r.setLeader(held)
+}
+
+// setLeader starts or stops running jobs, runs still going when the lease
+// is lost are cancelled before another replica starts them again
+func (r *registry) setLeader(leader bool) {
+	if leader == r.isLeader {
+		return
+	}
+	r.isLeader = leader
+
+	if leader {
+		r.leaderCtx, r.stepDown = context.WithCancel(context.Background())
+		logger.From(context.Background()).WithField(logger.FieldOwner, r.lease.Owner).Info("took the scheduler lease")
+		return
+	}
+	r.stepDown()
+	logger.From(context.Background()).WithField(logger.FieldOwner, r.lease.Owner).Warn("lost the scheduler lease, stopping the jobs")
+}
+
+func (r *registry) Leader(ctx context.Context) (models.JobLock, error) {
+	return r.locks.GetJobLock(ctx, LeaderLock)
+}
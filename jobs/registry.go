@@ -0,0 +1,595 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aniket0951/testproject/config"
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/repositories"
+	"github.com/go-co-op/gocron"
+)
+
+var (
+	ErrJobNotFound = errors.New("no such job")
+	ErrJobRunning  = errors.New("the job is already running")
+	ErrStopping    = errors.New("the scheduler is shutting down")
+)
+
+// Handler is the work of one job run, ctx ends with the job's timeout
+type Handler func(ctx context.Context) error
+
+// Job is a cron job, it runs on Schedule for at most Timeout. Schedule is a
+// cron expression or descriptor like "@every 1h", read in the registry's
+// location. Overlap is config.JobOverlapSkip or config.JobOverlapQueue,
+// skip when empty. A disabled job only runs when triggered by hand.
+type Job struct {
+	Name     string
+	Schedule string
+	Timeout  time.Duration
+	Overlap  string
+	Disabled bool
+	Handler  Handler
+}
+
+// Status is what the registry knows about a job and its last run. Paused
+// comes from job_states and the last run from job_runs, so every replica
+// reports the same.
+type Status struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Timeout  string `json:"timeout"`
+	Overlap  string `json:"overlap"`
+	Enabled  bool   `json:"enabled"`
+	Paused   bool   `json:"paused"`
+	Running  bool   `json:"running"`
+	// a run is queued behind the running one
+	Queued    bool      `json:"queued"`
+	NextRunAt time.Time `json:"next_run_at,omitempty"`
+	// the latest finished run
+	LastRunAt   time.Time `json:"last_run_at,omitempty"`
+	LastTrigger string    `json:"last_trigger,omitempty"`
+	// milliseconds the last run took
+	LastDurationMs int64  `json:"last_duration_ms"`
+	LastResult     string `json:"last_result,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	// item counts of the last run, see AddItems
+	LastItems map[string]int64 `json:"last_items,omitempty"`
+	// runs since the process started, job_runs has the full history
+	Runs     int64 `json:"runs"`
+	Failures int64 `json:"failures"`
+	// runs still going when the next one came up, and the scheduled runs
+	// that were skipped because of it
+	Overruns int64 `json:"overruns"`
+	Skipped  int64 `json:"skipped"`
+}
+
+// Registry runs the cron jobs and lets them be triggered, paused and
+// inspected by name. A job never runs twice at the same time, a scheduled
+// run that finds the previous one still going is skipped or queued to
+// start right after it, depending on the job's Overlap. With several
+// replicas only the one holding the scheduler lease runs jobs.
+type Registry interface {
+	Register(job Job) error
+	// Reschedule applies a new schedule, timeout, overlap and enabled flag
+	// to a registered job, the handler stays. A running job keeps going.
+	Reschedule(job Job) error
+	List(ctx context.Context) ([]Status, error)
+	Status(ctx context.Context, name string) (Status, error)
+	// Runs reads the run history from job_runs
+	Runs(ctx context.Context, filter models.JobRunFilter, page models.PageRequest) ([]models.JobRun, int64, error)
+	// Leader is the scheduler lease, i.e. the replica running the jobs
+	Leader(ctx context.Context) (models.JobLock, error)
+	// Trigger starts a run right away next to the schedule, paused jobs
+	// can still be triggered by hand. It only works on the leader.
+	Trigger(name string) error
+	// Pause skips the scheduled runs until Resume, on every replica
+	Pause(ctx context.Context, name string) error
+	Resume(ctx context.Context, name string) error
+
+	StartAsync()
+	StartBlocking()
+	// Stop ends the schedule and waits for the running jobs until ctx is
+	// done, the runs still going then are cancelled. The lease is released
+	// once every run finished so another replica takes over right away.
+	Stop(ctx context.Context) error
+}
+
+type job struct {
+	Job
+	scheduled *gocron.Job
+	// only the fields kept in memory, Paused is the flag last read from
+	// job_states
+	status Status
+	// the next run came up while this one was going
+	overran bool
+}
+
+func (j *job) queues() bool {
+	return j.Overlap == config.JobOverlapQueue
+}
+
+type registry struct {
+	mu        sync.Mutex
+	scheduler *gocron.Scheduler
+	jobs      map[string]*job
+	runs      repositories.JobRunRepository
+	locks     repositories.JobLockRepository
+	states    repositories.JobStateRepository
+	lease     Lease
+
+	isLeader   bool
+	leaseUntil time.Time
+	// cancelled when the lease is lost
+	leaderCtx context.Context
+	stepDown  context.CancelFunc
+
+	// set by Stop, nothing starts afterwards
+	stopping bool
+	// every run between being marked as running and its last write
+	inflight sync.WaitGroup
+	// ends holdLease
+	done chan struct{}
+	// keeps a renewal from taking the lease back while Stop releases it
+	leaseMu sync.Mutex
+}
+
+func NewRegistry(location *time.Location, runs repositories.JobRunRepository, locks repositories.JobLockRepository, states repositories.JobStateRepository, lease Lease) Registry {
+	return &registry{
+		scheduler: gocron.NewScheduler(location),
+		jobs:      map[string]*job{},
+		runs:      runs,
+		locks:     locks,
+		states:    states,
+		lease:     lease,
+		done:      make(chan struct{}),
+	}
+}
+
+func (r *registry) Register(definition Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := definition.Name
+	if _, ok := r.jobs[name]; ok {
+		return fmt.Errorf("job %q is registered twice", name)
+	}
+	if err := checkJob(&definition); err != nil {
+		return err
+	}
+
+	j := &job{Job: definition, status: Status{Name: name}}
+	if err := r.schedule(j); err != nil {
+		return err
+	}
+	r.jobs[name] = j
+	return nil
+}
+
+func (r *registry) Reschedule(definition Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, ok := r.jobs[definition.Name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if err := checkJob(&definition); err != nil {
+		return err
+	}
+	if definition.Schedule == j.Schedule && definition.Timeout == j.Timeout &&
+		definition.Overlap == j.Overlap && definition.Disabled == j.Disabled {
+		return nil
+	}
+
+	previous := j.scheduled
+	definition.Handler = j.Handler
+	j.Job = definition
+	if err := r.schedule(j); err != nil {
+		return err
+	}
+	r.scheduler.RemoveByReference(previous)
+	logger.From(context.Background()).WithFields(logger.Fields{
+		logger.FieldJob: j.Name,
+		"schedule":      j.Schedule,
+		"enabled":       !j.Disabled,
+	}).Info("rescheduled job")
+	return nil
+}
+
+func checkJob(definition *Job) error {
+	name := definition.Name
+	if definition.Schedule == "" {
+		return fmt.Errorf("job %q needs a schedule", name)
+	}
+	if definition.Timeout <= 0 {
+		return fmt.Errorf("job %q needs a timeout", name)
+	}
+	switch definition.Overlap {
+	case "":
+		definition.Overlap = config.JobOverlapSkip
+	case config.JobOverlapSkip, config.JobOverlapQueue:
+	default:
+		return fmt.Errorf("job %q has an unknown overlap %q", name, definition.Overlap)
+	}
+	return nil
+}
+
+// schedule adds the job to gocron and refreshes its status, r.mu is held
+func (r *registry) schedule(j *job) error {
+	name := j.Name
+	scheduled, err := r.scheduler.Cron(j.Schedule).Do(func() {
+		r.run(name, models.JobTriggerSchedule)
+	})
+	if err != nil {
+		return fmt.Errorf("schedule job %q : %w", name, err)
+	}
+	j.scheduled = scheduled
+	j.status.Schedule = j.Schedule
+	j.status.Timeout = j.Timeout.String()
+	j.status.Overlap = j.Overlap
+	j.status.Enabled = !j.Disabled
+	return nil
+}
+
+func (r *registry) List(ctx context.Context) ([]Status, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.jobs))
+	for name := range r.jobs {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	statuses := make([]Status, 0, len(names))
+	for _, name := range names {
+		status, err := r.Status(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (r *registry) Status(ctx context.Context, name string) (Status, error) {
+	r.mu.Lock()
+	j, ok := r.jobs[name]
+	if !ok {
+		r.mu.Unlock()
+		return Status{}, ErrJobNotFound
+	}
+	status := j.status
+	if !j.Disabled {
+		status.NextRunAt = j.scheduled.NextRun()
+	}
+	r.mu.Unlock()
+
+	state, err := r.states.GetJobState(ctx, name)
+	if err != nil {
+		return Status{}, err
+	}
+	status.Paused = state.Paused
+
+	last, err := r.runs.GetLastJobRun(ctx, name)
+	if err != nil {
+		return Status{}, err
+	}
+	status.LastRunAt = last.StartedAt
+	status.LastTrigger = last.Trigger
+	status.LastDurationMs = last.DurationMs
+	status.LastResult = last.Status
+	status.LastError = last.Error
+	status.LastItems = last.Items
+	return status, nil
+}
+
+func (r *registry) Runs(ctx context.Context, filter models.JobRunFilter, page models.PageRequest) ([]models.JobRun, int64, error) {
+	return r.runs.GetJobRuns(ctx, filter, page)
+}
+
+func (r *registry) Trigger(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, ok := r.jobs[name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if r.stopping {
+		return ErrStopping
+	}
+	if !r.isLeader {
+		return ErrNotLeader
+	}
+	if j.status.Running {
+		return ErrJobRunning
+	}
+
+	j.status.Running = true
+	r.inflight.Add(1)
+	go r.execute(r.leaderCtx, j, models.JobTriggerManual)
+	return nil
+}
+
+func (r *registry) Pause(ctx context.Context, name string) error {
+	return r.setPaused(ctx, name, true)
+}
+
+func (r *registry) Resume(ctx context.Context, name string) error {
+	return r.setPaused(ctx, name, false)
+}
+
+// setPaused stores the flag in job_states, the leader reads it before every
+// scheduled run
+func (r *registry) setPaused(ctx context.Context, name string, paused bool) error {
+	r.mu.Lock()
+	j, ok := r.jobs[name]
+	r.mu.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	if err := r.states.SetJobPaused(ctx, name, paused); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	j.status.Paused = paused
+	r.mu.Unlock()
+	return nil
+}
+
+// paused reads the flag from job_states, the last flag read is kept when
+// mongo can't be reached
+func (r *registry) paused(j *job) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	state, err := r.states.GetJobState(ctx, j.Name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		logger.From(ctx).WithField(logger.FieldJob, j.Name).WithError(err).Warn("failed to read the job state, using the last one read")
+		return j.status.Paused
+	}
+	j.status.Paused = state.Paused
+	return state.Paused
+}
+
+// the lease is tried once before the scheduler starts, so the first
+// scheduled runs already find a leader
+func (r *registry) StartAsync() {
+	r.renewLease()
+	go r.holdLease()
+	r.scheduler.StartAsync()
+}
+
+func (r *registry) StartBlocking() {
+	r.renewLease()
+	go r.holdLease()
+	r.scheduler.StartBlocking()
+}
+
+func (r *registry) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopping {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopping = true
+	r.mu.Unlock()
+
+	close(r.done)
+
+	// gocron's Stop waits for the job functions it started as well
+	drained := make(chan struct{})
+	go func() {
+		r.scheduler.Stop()
+		r.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		// the lease is left to expire, the cancelled runs may still be
+		// writing when the next leader starts them again otherwise
+		r.mu.Lock()
+		if r.isLeader {
+			r.stepDown()
+		}
+		r.mu.Unlock()
+		return fmt.Errorf("jobs still running at the shutdown deadline : %w", ctx.Err())
+	}
+
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+
+	r.mu.Lock()
+	leader := r.isLeader
+	if leader {
+		r.isLeader = false
+		r.stepDown()
+	}
+	r.mu.Unlock()
+	if !leader {
+		return nil
+	}
+	if err := r.locks.ReleaseJobLock(ctx, LeaderLock, r.lease.Owner); err != nil {
+		return err
+	}
+	logger.From(ctx).WithField(logger.FieldOwner, r.lease.Owner).Info("released the scheduler lease")
+	return nil
+}
+
+// run is called by the scheduler
+func (r *registry) run(name, trigger string) {
+	r.mu.Lock()
+	j := r.jobs[name]
+	if j == nil || j.Disabled || !r.isLeader || r.stopping {
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+
+	// another replica may have paused it
+	if r.paused(j) {
+		return
+	}
+
+	r.mu.Lock()
+	if j.Disabled || !r.isLeader || r.stopping {
+		r.mu.Unlock()
+		return
+	}
+	if j.status.Running {
+		j.overran = true
+		if j.queues() {
+			// several runs coming up meanwhile still queue a single one
+			j.status.Queued = true
+			r.mu.Unlock()
+			return
+		}
+		j.status.Skipped++
+		r.mu.Unlock()
+		logger.From(context.Background()).WithField(logger.FieldJob, name).Warn("skipping job, the previous run is still going")
+		return
+	}
+	j.status.Running = true
+	r.inflight.Add(1)
+	leaderCtx := r.leaderCtx
+	r.mu.Unlock()
+
+	r.execute(leaderCtx, j, trigger)
+}
+
+// execute runs the handler of a job already marked as running and records
+// the run in job_runs, leaderCtx ends when the scheduler lease is lost
+func (r *registry) execute(leaderCtx context.Context, j *job, trigger string) {
+	defer r.inflight.Done()
+
+	r.mu.Lock()
+	// Reschedule may change it meanwhile
+	timeout := j.Timeout
+	r.mu.Unlock()
+
+	run := &models.JobRun{
+		Job:       j.Name,
+		Trigger:   trigger,
+		Status:    models.JobRunRunning,
+		Owner:     r.lease.Owner,
+		StartedAt: time.Now().UTC(),
+	}
+	r.storeRun(run, true)
+
+	// every line the handler logs through ctx names the job and the run
+	ctx := logger.With(leaderCtx, logger.Fields{
+		logger.FieldJob:     j.Name,
+		logger.FieldRunID:   run.Id.Hex(),
+		logger.FieldTrigger: trigger,
+	})
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, counts := withItems(ctx)
+	err := runHandler(ctx, j.Handler)
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	lostLease := leaderCtx.Err() != nil
+	cancel()
+
+	run.EndedAt = time.Now().UTC()
+	run.DurationMs = run.EndedAt.Sub(run.StartedAt).Milliseconds()
+	run.Items = counts.snapshot()
+	switch {
+	case timedOut:
+		run.Status = models.JobRunTimeout
+		if err == nil {
+			err = fmt.Errorf("took longer than %s", timeout)
+		}
+		run.Error = err.Error()
+	case lostLease:
+		run.Status = models.JobRunFailed
+		run.Error = "cancelled, the scheduler lease was lost"
+	case err != nil:
+		run.Status = models.JobRunFailed
+		run.Error = err.Error()
+	default:
+		run.Status = models.JobRunSuccess
+	}
+
+	r.mu.Lock()
+	if lostLease && r.stopping {
+		run.Error = "cancelled, the scheduler is shutting down"
+	}
+	run.Overran = j.overran
+	j.overran = false
+	j.status.Runs++
+	if run.Status != models.JobRunSuccess {
+		j.status.Failures++
+	}
+	if run.Overran {
+		j.status.Overruns++
+	}
+	// the queued run takes over the running flag, so nothing starts in
+	// between. Paused was read when the run was queued.
+	queued := j.status.Queued && r.isLeader && !j.Disabled && !j.status.Paused && !r.stopping
+	j.status.Queued = false
+	j.status.Running = queued
+	if queued {
+		r.inflight.Add(1)
+	}
+	nextCtx := r.leaderCtx
+	r.mu.Unlock()
+
+	r.storeRun(run, false)
+	runLog := logger.From(ctx).WithFields(logger.Fields{
+		"status":      run.Status,
+		"duration_ms": run.DurationMs,
+		"items":       run.Items,
+		"overran":     run.Overran,
+	})
+	if run.Status != models.JobRunSuccess {
+		runLog.WithField("error", run.Error).Error("job run failed")
+	} else if run.Overran {
+		runLog.Warn("job run overran into its next scheduled run")
+	} else {
+		runLog.Info("job run finished")
+	}
+
+	if queued {
+		go r.execute(nextCtx, j, models.JobTriggerSchedule)
+	}
+}
+
+// storeRun writes the run to job_runs, losing history is not worth
+// failing the job over
+func (r *registry) storeRun(run *models.JobRun, started bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	if started {
+		err = r.runs.AddJobRun(ctx, run)
+	} else {
+		err = r.runs.SaveJobRun(ctx, run)
+	}
+	if err != nil {
+		logger.From(ctx).WithFields(logger.Fields{
+			logger.FieldJob:   run.Job,
+			logger.FieldRunID: run.Id.Hex(),
+		}).WithError(err).Error("failed to store the job run")
+	}
+}
+
+// runHandler turns a panic into a failed run instead of killing the process
+func runHandler(ctx context.Context, handler Handler) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic : %v", recovered)
+		}
+	}()
+	return handler(ctx)
+}
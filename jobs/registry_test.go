@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aniket0951/testproject/repositories"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase is a throwaway database on the mongod of MONGO_TEST_URI,
+// localhost when unset. The test is skipped when none is reachable.
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		uri = "mongodb://127.0.0.1:27017"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Skipf("no mongod at %s : %v", uri, err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		t.Skipf("no mongod at %s : %v", uri, err)
+	}
+
+	database := client.Database(fmt.Sprintf("mauto_jobs_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		_ = database.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+	return database
+}
+
+// waitFor polls done until it holds or timeout passes
+func waitFor(timeout time.Duration, done func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if done() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return done()
+}
+
+func TestAcquireJobLock(t *testing.T) {
+	locks := repositories.NewJobLockRepository(testDatabase(t))
+	ctx := context.Background()
+	if err := locks.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name  string
+		owner string
+		want  bool
+	}{
+		{"free lease", "replica-a", true},
+		{"held by another owner", "replica-b", false},
+		{"renewed by the owner", "replica-a", true},
+		{"still held by another owner", "replica-b", false},
+	}
+	for _, step := range steps {
+		held, err := locks.AcquireJobLock(ctx, LeaderLock, step.owner, time.Minute)
+		if err != nil {
+			t.Fatalf("%s : %v", step.name, err)
+		}
+		if held != step.want {
+			t.Fatalf("%s : held = %v, want %v", step.name, held, step.want)
+		}
+	}
+
+	// only the owner can give it up
+	if err := locks.ReleaseJobLock(ctx, LeaderLock, "replica-b"); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := locks.AcquireJobLock(ctx, LeaderLock, "replica-b", time.Minute); held {
+		t.Fatal("a release by another owner freed the lease")
+	}
+	if err := locks.ReleaseJobLock(ctx, LeaderLock, "replica-a"); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := locks.AcquireJobLock(ctx, LeaderLock, "replica-b", time.Minute); !held {
+		t.Fatal("the released lease was not taken over")
+	}
+}
+
+func TestRegistryRunsJobsOnOneReplica(t *testing.T) {
+	database := testDatabase(t)
+	runs := repositories.NewJobRunRepository(database)
+	locks := repositories.NewJobLockRepository(database)
+	states := repositories.NewJobStateRepository(database)
+
+	const ttl = 3 * time.Second
+	newReplica := func(owner string, count *atomic.Int64) Registry {
+		registry := NewRegistry(time.UTC, runs, locks, states, Lease{Owner: owner, TTL: ttl})
+		err := registry.Register(Job{
+			Name:     "tick",
+			Schedule: "@every 1s",
+			Timeout:  time.Second,
+			Handler: func(ctx context.Context) error {
+				count.Add(1)
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return registry
+	}
+
+	var firstRuns, secondRuns atomic.Int64
+	first := newReplica("replica-a", &firstRuns)
+	second := newReplica("replica-b", &secondRuns)
+
+	// the lease is tried before the schedule starts, so the first replica
+	// leads
+	first.StartAsync()
+	second.StartAsync()
+	defer second.Stop(context.Background())
+
+	if !waitFor(5*time.Second, func() bool { return firstRuns.Load() >= 2 }) {
+		t.Fatalf("the leader ran the job %d times", firstRuns.Load())
+	}
+	if n := secondRuns.Load(); n != 0 {
+		t.Fatalf("the replica without the lease ran the job %d times", n)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := first.Stop(stopCtx); err != nil {
+		t.Fatal(err)
+	}
+	stoppedAt := firstRuns.Load()
+
+	// the other replica picks the released lease up on its next renewal
+	// and runs the job from its next scheduled run on
+	if !waitFor(ttl+time.Second, func() bool { return secondRuns.Load() > 0 }) {
+		t.Fatalf("the other replica didn't take over within %s", ttl)
+	}
+	lock, err := second.Leader(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Owner != "replica-b" {
+		t.Fatalf("leader = %q, want replica-b", lock.Owner)
+	}
+	if n := firstRuns.Load(); n != stoppedAt {
+		t.Fatalf("the stopped replica kept running the job, %d runs after %d", n, stoppedAt)
+	}
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/aniket0951/testproject/config"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// field names shared by every package, so one job or battery can be
+// followed across the logs
+const (
+	FieldJob       = "job"
+	FieldRunID     = "run_id"
+	FieldTrigger   = "trigger"
+	FieldBmsID     = "bms_id"
+	FieldVehicleNo = "vehicle_no"
+	FieldOwner     = "owner"
+)
+
+// Fields are extra key/values of a log line
+type Fields = logrus.Fields
+
+type ctxKey struct{}
+
+var (
+	base   = newBase()
+	output io.Closer
+)
+
+func newBase() *logrus.Logger {
+	log := logrus.New()
+	log.SetFormatter(&logrus.JSONFormatter{})
+	log.SetOutput(os.Stdout)
+	return log
+}
+
+// Configure sets the level and the output, a configured file is rotated by
+// size and age. Until it is called logs go to stdout at info level.
+func Configure(cfg config.LogConfig) error {
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	base.SetLevel(level)
+
+	if cfg.File == "" {
+		return nil
+	}
+	file := &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.Backups(),
+		MaxAge:     cfg.AgeDays(),
+		Compress:   cfg.IsCompressed(),
+	}
+	base.SetOutput(file)
+	output = file
+	return nil
+}
+
+// Close flushes and closes the log file, later lines go to stdout
+func Close() error {
+	if output == nil {
+		return nil
+	}
+	base.SetOutput(os.Stdout)
+	err := output.Close()
+	output = nil
+	return err
+}
+
+// With returns a ctx whose log lines carry fields on top of the ones ctx
+// already carries, e.g. the job and run id of a cron run
+func With(ctx context.Context, fields Fields) context.Context {
+	return context.WithValue(ctx, ctxKey{}, From(ctx).WithFields(fields))
+}
+
+// From returns the logger with the fields ctx carries
+func From(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(ctxKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(base)
+}
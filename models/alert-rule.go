@@ -0,0 +1,145 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// alert rule sources
+const (
+	AlertSourceVehicle = "vehicle"
+	AlertSourceBattery = "battery"
+)
+
+// alert rule operators, between and outside use MinThreshold and MaxThreshold
+const (
+	AlertOperatorGT      = "gt"
+	AlertOperatorGTE     = "gte"
+	AlertOperatorLT      = "lt"
+	AlertOperatorLTE     = "lte"
+	AlertOperatorEQ      = "eq"
+	AlertOperatorNEQ     = "neq"
+	AlertOperatorBetween = "between"
+	AlertOperatorOutside = "outside"
+	AlertOperatorIsTrue  = "is_true"
+	AlertOperatorIsFalse = "is_false"
+)
+
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+// legacy alert types that keep feeding vehicle_alerts and vehicle_fall_alerts
+const (
+	AlertTypeOverspeed = "overspeed"
+	AlertTypeFall      = "fall"
+)
+
+// alert type of an alert_config rule on the battery_temperature field, there
+// is no built in limit for it
+const AlertTypeBatteryTemperature = "battery_temperature"
+
+// built in alert types raised on feed state transitions
+const (
+	AlertTypeSOS            = "sos"
+	AlertTypeImmobilizer    = "immobilizer"
+	AlertTypeDoorOpenMoving = "door_open_while_moving"
+)
+
+// alert_events is the log of everything that happens to an incident
+const (
+	AlertEventFired        = "fired"
+	AlertEventCleared      = "cleared"
+	AlertEventReopened     = "reopened"
+	AlertEventAcknowledged = "acknowledged"
+	AlertEventResolved     = "resolved"
+)
+
+const (
+	IncidentStatusOpen         = "open"
+	IncidentStatusAcknowledged = "acknowledged"
+	IncidentStatusResolved     = "resolved"
+)
+
+// resolved by the engine when the condition cleared
+const IncidentResolvedBySystem = "system"
+
+// alert_config_audit actions
+const (
+	AlertRuleCreated = "created"
+	AlertRuleUpdated = "updated"
+	AlertRuleDeleted = "deleted"
+)
+
+// AlertRuleAudit records one change of an alert_config document, Before is
+// empty for created and After for deleted rules
+type AlertRuleAudit struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	RuleId    primitive.ObjectID `json:"rule_id" bson:"rule_id"`
+	AlertType string             `json:"alert_type" bson:"alert_type"`
+	Action    string             `json:"action" bson:"action"`
+	Actor     string             `json:"actor" bson:"actor"`
+	Before    *AlertConfig       `json:"before,omitempty" bson:"before,omitempty"`
+	After     *AlertConfig       `json:"after,omitempty" bson:"after,omitempty"`
+	Time      time.Time          `json:"time" bson:"time"`
+}
+
+// AlertIncident is one episode of a rule matching a subject, from the first
+// reading over the limit until the condition clears or someone resolves it
+type AlertIncident struct {
+	Id          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	RuleId      primitive.ObjectID `json:"rule_id" bson:"rule_id"`
+	AlertType   string             `json:"alert_type" bson:"alert_type"`
+	Severity    string             `json:"severity" bson:"severity"`
+	SubjectType string             `json:"subject_type" bson:"subject_type"`
+	SubjectId   string             `json:"subject_id" bson:"subject_id"`
+	Field       string             `json:"field" bson:"field"`
+	Status      string             `json:"status" bson:"status"`
+	StartedAt   time.Time          `json:"started_at" bson:"started_at"`
+	EndedAt     time.Time          `json:"ended_at,omitempty" bson:"ended_at,omitempty"`
+	LastSeenAt  time.Time          `json:"last_seen_at" bson:"last_seen_at"`
+	PeakValue   float64            `json:"peak_value" bson:"peak_value"`
+	LastValue   float64            `json:"last_value" bson:"last_value"`
+	// how often the rule fired again inside the de-dup window of this incident
+	Occurrences    int64     `json:"occurrences" bson:"occurrences"`
+	AcknowledgedBy string    `json:"acknowledged_by,omitempty" bson:"acknowledged_by,omitempty"`
+	AcknowledgedAt time.Time `json:"acknowledged_at,omitempty" bson:"acknowledged_at,omitempty"`
+	ResolvedBy     string    `json:"resolved_by,omitempty" bson:"resolved_by,omitempty"`
+	ResolvedAt     time.Time `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// IncidentFilter narrows GetIncidents, empty values match everything
+type IncidentFilter struct {
+	Status      string
+	SubjectType string
+	SubjectId   string
+	// limits the list to these subjects when not nil
+	SubjectIds []string
+	AlertType  string
+	From       time.Time
+	To         time.Time
+}
+
+// AlertEvent records a rule starting or stopping to match for one subject
+// and every state change of the incident it belongs to
+type AlertEvent struct {
+	Id          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	IncidentId  primitive.ObjectID `json:"incident_id" bson:"incident_id"`
+	RuleId      primitive.ObjectID `json:"rule_id" bson:"rule_id"`
+	AlertType   string             `json:"alert_type" bson:"alert_type"`
+	Severity    string             `json:"severity" bson:"severity"`
+	SubjectType string             `json:"subject_type" bson:"subject_type"`
+	SubjectId   string             `json:"subject_id" bson:"subject_id"`
+	Field       string             `json:"field" bson:"field"`
+	Value       float64            `json:"value" bson:"value"`
+	Event       string             `json:"event" bson:"event"`
+	Actor       string             `json:"actor,omitempty" bson:"actor,omitempty"`
+	Note        string             `json:"note,omitempty" bson:"note,omitempty"`
+	Time        time.Time          `json:"time" bson:"time"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -71,6 +71,9 @@ type BatteryHardwareMain struct {
 	MinMaxSoc                 []int              `json:"min_max_soc" bson:"min_max_soc"`
 	SpeedCal                  []int              `json:"speed_cal" bson:"speed_cal"`
 	ODOMeter                  float64            `json:"odo_meter" bson:"odo_meter"`
+	// set by hand to hand the battery to a fleet client, see models.Scope
+	Company string `json:"company,omitempty" bson:"company,omitempty"`
+	Branch  string `json:"branch,omitempty" bson:"branch,omitempty"`
 }
 
 func (batteryMain *BatteryHardwareMain) FormatSpeed() string {
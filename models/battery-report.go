@@ -0,0 +1,8 @@
+package models
+
+// UnreportedCounts is how many batteries did not report, per hour
+type UnreportedCounts struct {
+	LastHour       map[string]int64          `json:"last_hour"`
+	LastSevenHours []LastSevenHourUnreported `json:"last_seven_hours"`
+	Last24Hours    []Last24HourUnreported    `json:"last_24_hours"`
+}
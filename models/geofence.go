@@ -0,0 +1,133 @@
+package models
+
+import (
+	"time"
+
+	"github.com/aniket0951/testproject/helper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	GeofenceShapePolygon = "polygon"
+	GeofenceShapeCircle  = "circle"
+)
+
+// subjects a geofence is evaluated for
+const (
+	GeofenceSubjectVehicle = "vehicle"
+	GeofenceSubjectBattery = "battery"
+)
+
+const (
+	GeofenceEventEnter = "enter"
+	GeofenceEventExit  = "exit"
+	GeofenceEventDwell = "dwell"
+)
+
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude" bson:"latitude"`
+	Longitude float64 `json:"longitude" bson:"longitude"`
+}
+
+// Geofence is a polygon or circle zone. It applies to the listed vehicles,
+// batteries and branches, a geofence without any assignment applies to all.
+type Geofence struct {
+	Id           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name         string             `json:"name" bson:"name"`
+	Category     string             `json:"category" bson:"category"` // depot, charging_station, restricted ...
+	Shape        string             `json:"shape" bson:"shape"`
+	Polygon      []GeoPoint         `json:"polygon,omitempty" bson:"polygon,omitempty"`
+	Center       GeoPoint           `json:"center" bson:"center"`
+	RadiusMeters float64            `json:"radius_meters" bson:"radius_meters"`
+	VehicleNos   []string           `json:"vehicle_nos,omitempty" bson:"vehicle_nos,omitempty"`
+	BmsIDs       []string           `json:"bms_ids,omitempty" bson:"bms_ids,omitempty"`
+	Branches     []string           `json:"branches,omitempty" bson:"branches,omitempty"`
+	// a dwell event is raised once a subject stayed inside this long, 0 disables it
+	DwellSeconds int64     `json:"dwell_seconds" bson:"dwell_seconds"`
+	Enabled      bool      `json:"enabled" bson:"enabled"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Contains reports whether the point lies inside the geofence
+func (fence *Geofence) Contains(point GeoPoint) bool {
+	p := helper.Coordinates{Latitude: point.Latitude, Longitude: point.Longitude}
+
+	switch fence.Shape {
+	case GeofenceShapeCircle:
+		center := helper.Coordinates{Latitude: fence.Center.Latitude, Longitude: fence.Center.Longitude}
+		return helper.InCircle(p, center, fence.RadiusMeters)
+	case GeofenceShapePolygon:
+		polygon := make([]helper.Coordinates, len(fence.Polygon))
+		for i := range fence.Polygon {
+			polygon[i] = helper.Coordinates{Latitude: fence.Polygon[i].Latitude, Longitude: fence.Polygon[i].Longitude}
+		}
+		return helper.PointInPolygon(p, polygon)
+	default:
+		return false
+	}
+}
+
+// AppliesTo reports whether the geofence is assigned to the subject
+func (fence *Geofence) AppliesTo(subjectType, subjectId, branch string) bool {
+	if len(fence.VehicleNos) == 0 && len(fence.BmsIDs) == 0 && len(fence.Branches) == 0 {
+		return true
+	}
+
+	switch subjectType {
+	case GeofenceSubjectVehicle:
+		if contains(fence.VehicleNos, subjectId) {
+			return true
+		}
+	case GeofenceSubjectBattery:
+		if contains(fence.BmsIDs, subjectId) {
+			return true
+		}
+	}
+	return branch != "" && contains(fence.Branches, branch)
+}
+
+// GeofenceFix is one position of a vehicle or battery to evaluate
+type GeofenceFix struct {
+	SubjectType string
+	SubjectId   string
+	Branch      string
+	Point       GeoPoint
+	Time        time.Time
+}
+
+// GeofenceState remembers whether a subject is inside a geofence between runs
+type GeofenceState struct {
+	Id            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	GeofenceId    primitive.ObjectID `json:"geofence_id" bson:"geofence_id"`
+	SubjectType   string             `json:"subject_type" bson:"subject_type"`
+	SubjectId     string             `json:"subject_id" bson:"subject_id"`
+	Inside        bool               `json:"inside" bson:"inside"`
+	EnteredAt     time.Time          `json:"entered_at" bson:"entered_at"`
+	DwellReported bool               `json:"dwell_reported" bson:"dwell_reported"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type GeofenceEvent struct {
+	Id           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	GeofenceId   primitive.ObjectID `json:"geofence_id" bson:"geofence_id"`
+	GeofenceName string             `json:"geofence_name" bson:"geofence_name"`
+	Category     string             `json:"category" bson:"category"`
+	SubjectType  string             `json:"subject_type" bson:"subject_type"`
+	SubjectId    string             `json:"subject_id" bson:"subject_id"`
+	Event        string             `json:"event" bson:"event"`
+	Point        GeoPoint           `json:"point" bson:"point"`
+	Time         time.Time          `json:"time" bson:"time"`
+	// time spent inside, set on exit and dwell events
+	DwellSeconds int64     `json:"dwell_seconds" bson:"dwell_seconds"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+func contains(values []string, value string) bool {
+	for i := range values {
+		if values[i] == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// JobLock is a lease in job_locks, the owner has to renew it before
+// ExpiresAt or another replica takes it over
+type JobLock struct {
+	Name        string    `json:"name" bson:"_id"`
+	Owner       string    `json:"owner" bson:"owner"`
+	HeartbeatAt time.Time `json:"heartbeat_at" bson:"heartbeat_at"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at"`
+}
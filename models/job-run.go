@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// job_runs statuses
+const (
+	JobRunRunning = "running"
+	JobRunSuccess = "success"
+	JobRunFailed  = "failed"
+	// the run went past its timeout
+	JobRunTimeout = "timeout"
+)
+
+// what started a run
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// JobRun is one run of a cron job. It is stored as running when the job
+// starts, a run that stays running never finished, e.g. the process died.
+type JobRun struct {
+	Id      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Job     string             `json:"job" bson:"job"`
+	Trigger string             `json:"trigger" bson:"trigger"`
+	Status  string             `json:"status" bson:"status"`
+	// the replica that ran it, see JobLock
+	Owner      string    `json:"owner" bson:"owner"`
+	StartedAt  time.Time `json:"started_at" bson:"started_at"`
+	EndedAt    time.Time `json:"ended_at,omitempty" bson:"ended_at,omitempty"`
+	DurationMs int64     `json:"duration_ms" bson:"duration_ms"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	// what the job handled, e.g. {"moved": 120}
+	Items map[string]int64 `json:"items,omitempty" bson:"items,omitempty"`
+	// the run was still going when the next one came up, which had to be
+	// skipped or queued
+	Overran bool `json:"overran" bson:"overran"`
+}
+
+// JobRunFilter narrows GetJobRuns, empty values match everything
+type JobRunFilter struct {
+	Job    string
+	Status string
+	From   time.Time
+	To     time.Time
+}
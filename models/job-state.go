@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// JobState is what an admin changed about a job in job_states, shared by
+// every replica so it survives a restart and a new leader
+type JobState struct {
+	Name      string    `json:"name" bson:"_id"`
+	Paused    bool      `json:"paused" bson:"paused"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
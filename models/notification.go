@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// notification_outbox statuses
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// Notification is one rendered message waiting in notification_outbox, it is
+// retried until it is sent or runs out of attempts
+type Notification struct {
+	Id          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Route       string             `json:"route" bson:"route"`
+	Channel     string             `json:"channel" bson:"channel"`
+	Recipients  []string           `json:"recipients" bson:"recipients"`
+	Subject     string             `json:"subject" bson:"subject"`
+	Body        string             `json:"body" bson:"body"`
+	IncidentId  primitive.ObjectID `json:"incident_id" bson:"incident_id"`
+	AlertType   string             `json:"alert_type" bson:"alert_type"`
+	Severity    string             `json:"severity" bson:"severity"`
+	Event       string             `json:"event" bson:"event"`
+	SubjectType string             `json:"subject_type" bson:"subject_type"`
+	SubjectId   string             `json:"subject_id" bson:"subject_id"`
+	Value       float64            `json:"value" bson:"value"`
+	AlertTime   time.Time          `json:"alert_time" bson:"alert_time"`
+
+	Status        string    `json:"status" bson:"status"`
+	Attempts      int       `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	SentAt        time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	CreatedAt     time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" bson:"updated_at"`
+}
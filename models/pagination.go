@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// PageRequest selects one page of a list, Sort is a stored field name
+type PageRequest struct {
+	Page     int64
+	Limit    int64
+	Sort     string
+	SortDesc bool
+}
+
+func (page PageRequest) Skip() int64 {
+	if page.Page <= 1 {
+		return 0
+	}
+	return (page.Page - 1) * page.Limit
+}
+
+// PageMeta describes the page that was returned
+type PageMeta struct {
+	Page  int64 `json:"page"`
+	Limit int64 `json:"limit"`
+	Total int64 `json:"total"`
+}
+
+// VehicleFilter narrows ListVehicles, empty values match everything
+type VehicleFilter struct {
+	Branch      string
+	Company     string
+	Status      string
+	VehicleType string
+	// prefix of the vehicle number
+	VehicleNo string
+}
+
+// ReportFilter narrows the battery and alert history lists
+type ReportFilter struct {
+	SubjectId string
+	// limits the list to these subjects when not nil, scoped users get the
+	// vehicles and batteries of their company here
+	SubjectIds []string
+	AlertType  string
+	From       time.Time
+	To         time.Time
+}
@@ -4,18 +4,50 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// user roles, stored in UserType
+const (
+	RoleAdmin       = "admin"
+	RoleOperator    = "operator"
+	RoleViewer      = "viewer"
+	RoleFleetClient = "fleet-client"
+)
+
+// User is an api account. Password is the bcrypt hash and Token the hash of
+// the refresh token issued last, neither ever leaves the server.
 type User struct {
 	Id              primitive.ObjectID `json:"id,omitempty" bson:"_id"`
 	Name            string             `json:"name" bson:"name" validate:"required"`
 	Email           string             `json:"email,omitempty" bson:"email"`
 	ProfilePic      string             `json:"profile_pic" bson:"avtar"`
 	UserType        string             `json:"user_type" bson:"user_type"`
-	Password        string             `json:"password" bson:"password"`
-	IsPasswordReset bool               `json:",omitempty" bson:"is_pass_reset" default:"false"`
-	OldPassword     string             `json:",omitempty"`
-	Token           string             `json:"token,omitempty" bson:"token"`
-	CreatedAt       primitive.DateTime `json:"createdAt" bson:"createdAt"`
-	UpdatedAt       primitive.DateTime `bson:"updatedAt" json:"updatedAt"`
+	Password        string             `json:"-" bson:"password"`
+	IsPasswordReset bool               `json:"is_password_reset" bson:"is_pass_reset" default:"false"`
+	OldPassword     string             `json:"-"`
+	Token           string             `json:"-" bson:"token"`
+	// a user with a company only sees that company's vehicles and batteries,
+	// a branch narrows it further
+	Company           string             `json:"company,omitempty" bson:"company,omitempty"`
+	Branch            string             `json:"branch,omitempty" bson:"branch,omitempty"`
+	Disabled          bool               `json:"disabled" bson:"disabled"`
+	PasswordChangedAt primitive.DateTime `json:"password_changed_at" bson:"password_changed_at"`
+	ResetToken        string             `json:"-" bson:"reset_token,omitempty"`
+	ResetExpiresAt    primitive.DateTime `json:"-" bson:"reset_expires_at,omitempty"`
+	CreatedAt         primitive.DateTime `json:"createdAt" bson:"createdAt"`
+	UpdatedAt         primitive.DateTime `bson:"updatedAt" json:"updatedAt"`
+}
+
+func (user *User) Scope() Scope {
+	return Scope{Company: user.Company, Branch: user.Branch}
+}
+
+// Scope limits what a user sees, the empty scope sees everything
+type Scope struct {
+	Company string `json:"company,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+}
+
+func (scope Scope) Unrestricted() bool {
+	return scope.Company == "" && scope.Branch == ""
 }
 
 type TestModel struct {
@@ -53,10 +53,30 @@ type VehiclesData struct {
 	Power             string             `json:"Power,omitempty" bson:"power"`
 	DistanceTraveled  float64            `json:"DistanceTraveled" bson:"distance_traveled"`
 	Location          string             `json:"Location,omitempty" bson:"location"`
+	Snapshot          *VehicleSnapshot   `json:"snapshot,omitempty" bson:"snapshot,omitempty"`
+	LastGoodFix       *GPSPoint          `json:"last_good_fix,omitempty" bson:"last_good_fix,omitempty"`
+	GPSRejections     GPSRejectionCounts `json:"gps_rejections" bson:"gps_rejections"`
 	TimeStamp         primitive.DateTime `json:"timeStamp" bson:"timeStamp"`
 	CreatedAt         primitive.DateTime `bson:"createdAt" json:"createdAt"`
 	UpdatedAt         primitive.DateTime `bson:"updatedAt" json:"updatedAt"`
 }
+
+// GPSPoint is the last position that passed the noise filter, distance is
+// always measured from here so a rejected fix can't become the next origin
+type GPSPoint struct {
+	Latitude  float64   `json:"latitude" bson:"latitude"`
+	Longitude float64   `json:"longitude" bson:"longitude"`
+	Time      time.Time `json:"time" bson:"time"`
+}
+
+// GPSRejectionCounts counts the fixes the noise filter dropped per reason
+type GPSRejectionCounts struct {
+	Invalid         int64 `json:"invalid" bson:"invalid"`
+	Zero            int64 `json:"zero" bson:"zero"`
+	ImpossibleSpeed int64 `json:"impossible_speed" bson:"impossible_speed"`
+	IdleDrift       int64 `json:"idle_drift" bson:"idle_drift"`
+}
+
 type AutoGenerated struct {
 	Root struct {
 		VehicleData []struct {
@@ -144,6 +164,9 @@ type VehicleLocationData struct {
 	Latitude  string             `json:"Latitude,omitempty" bson:"latitude"`
 	Longitude string             `json:"Longitude,omitempty" bson:"longitude"`
 	Location  string             `json:"Location,omitempty" bson:"location"`
+	Speed     float64            `json:"speed" bson:"speed"`
+	Heading   float64            `json:"heading" bson:"heading"`
+	GPSTime   time.Time          `json:"gps_time" bson:"gps_time"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 }
@@ -193,6 +216,8 @@ type VehicleFallAlertHistory struct {
 	HistoryTimestamp primitive.DateTime `json:"history_timestamp" bson:"history_timestamp"`
 }
 
+// AlertConfig is one alert rule. Documents written before the rule engine
+// only carry alert_type and the limits, see services.NormalizeAlertConfig.
 type AlertConfig struct {
 	Id          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	AlertType   string             `json:"alert_type" bson:"alert_type"`
@@ -200,8 +225,27 @@ type AlertConfig struct {
 	Limit       int64              `json:"limit" bson:"limit"`
 	MaxLimit    int64              `json:"max_limit" bson:"max_limit"`
 	MinLimit    int64              `json:"min_limit" bson:"min_limit"`
-	CreatedAt   primitive.DateTime `json:"createdAt" bson:"created_at"`
-	UpdatedAt   primitive.DateTime `json:"updatedAt" bson:"updated_at"`
+
+	Source       string  `json:"source,omitempty" bson:"source,omitempty"`
+	Field        string  `json:"field,omitempty" bson:"field,omitempty"`
+	Operator     string  `json:"operator,omitempty" bson:"operator,omitempty"`
+	Threshold    float64 `json:"threshold" bson:"threshold"`
+	MinThreshold float64 `json:"min_threshold" bson:"min_threshold"`
+	MaxThreshold float64 `json:"max_threshold" bson:"max_threshold"`
+	// the condition has to hold this long before the alert fires
+	DurationSeconds int64 `json:"duration_seconds" bson:"duration_seconds"`
+	// an active alert only clears once the value is this far back on the good side
+	Hysteresis     float64 `json:"hysteresis" bson:"hysteresis"`
+	Severity       string  `json:"severity,omitempty" bson:"severity,omitempty"`
+	OnlyWhenMoving bool    `json:"only_when_moving" bson:"only_when_moving"`
+	Disabled       bool    `json:"disabled" bson:"disabled"`
+	// set on the overspeed and fall rules the engine adds when alert_config
+	// has none, never stored
+	BuiltIn bool `json:"built_in" bson:"-"`
+
+	UpdatedBy string             `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
+	CreatedAt primitive.DateTime `json:"createdAt" bson:"created_at"`
+	UpdatedAt primitive.DateTime `json:"updatedAt" bson:"updated_at"`
 }
 
 type VehicleDistanceTravel struct {
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VehicleSnapshot is the typed view of one feed record. It is built once by
+// ParseVehicleSnapshot and stored next to the raw strings of VehiclesData so
+// alerts and distance maths never have to convert (and silently zero) again.
+type VehicleSnapshot struct {
+	Speed             float64           `json:"speed" bson:"speed"`
+	Angle             float64           `json:"angle" bson:"angle"`
+	Latitude          float64           `json:"latitude" bson:"latitude"`
+	Longitude         float64           `json:"longitude" bson:"longitude"`
+	Odometer          float64           `json:"odometer" bson:"odometer"`
+	Temperature       float64           `json:"temperature" bson:"temperature"`
+	ExternalVolt      float64           `json:"external_volt" bson:"external_volt"`
+	BatteryPercentage float64           `json:"battery_percentage" bson:"battery_percentage"`
+	Ignition          bool              `json:"ignition" bson:"ignition"`
+	Power             bool              `json:"power" bson:"power"`
+	AC                bool              `json:"ac" bson:"ac"`
+	SOS               bool              `json:"sos" bson:"sos"`
+	Immobilized       bool              `json:"immobilized" bson:"immobilized"`
+	Door1             bool              `json:"door1" bson:"door1"`
+	Door2             bool              `json:"door2" bson:"door2"`
+	Door3             bool              `json:"door3" bson:"door3"`
+	Door4             bool              `json:"door4" bson:"door4"`
+	Running           bool              `json:"running" bson:"running"`
+	GPSTime           time.Time         `json:"gps_time" bson:"gps_time"`
+	DeviceTime        time.Time         `json:"device_time" bson:"device_time"`
+	ReceivedAt        time.Time         `json:"received_at" bson:"received_at"`
+	ParseErrors       []FieldParseError `json:"parse_errors,omitempty" bson:"parse_errors,omitempty"`
+}
+
+// snapshot field names, used in FieldParseError.Field and Valid
+const (
+	FieldSpeed             = "speed"
+	FieldAngle             = "angle"
+	FieldLatitude          = "latitude"
+	FieldLongitude         = "longitude"
+	FieldOdometer          = "odometer"
+	FieldTemperature       = "temperature"
+	FieldExternalVolt      = "external_volt"
+	FieldBatteryPercentage = "battery_percentage"
+	FieldIgnition          = "ignition"
+	FieldPower             = "power"
+	FieldAC                = "ac"
+	FieldSOS               = "sos"
+	FieldImmobilized       = "immobilized"
+	FieldDoor1             = "door1"
+	FieldDoor2             = "door2"
+	FieldDoor3             = "door3"
+	FieldDoor4             = "door4"
+	FieldGPSTime           = "gps_time"
+	FieldDeviceTime        = "device_time"
+)
+
+const (
+	ParseReasonMissing = "missing"
+	ParseReasonInvalid = "invalid"
+)
+
+type FieldParseError struct {
+	Field  string `json:"field" bson:"field"`
+	Value  string `json:"value" bson:"value"`
+	Reason string `json:"reason" bson:"reason"`
+}
+
+func (e FieldParseError) Error() string {
+	return fmt.Sprintf("%s %s : %q", e.Field, e.Reason, e.Value)
+}
+
+// Valid reports whether field was present and parsed cleanly
+func (snapshot *VehicleSnapshot) Valid(field string) bool {
+	for i := range snapshot.ParseErrors {
+		if snapshot.ParseErrors[i].Field == field {
+			return false
+		}
+	}
+	return true
+}
+
+// InvalidFields only returns the values that were present but unparsable,
+// missing values are normal for some device models
+func (snapshot *VehicleSnapshot) InvalidFields() []FieldParseError {
+	invalid := []FieldParseError{}
+	for i := range snapshot.ParseErrors {
+		if snapshot.ParseErrors[i].Reason == ParseReasonInvalid {
+			invalid = append(invalid, snapshot.ParseErrors[i])
+		}
+	}
+	return invalid
+}
+
+// HasPosition is true when both coordinates parsed
+func (snapshot *VehicleSnapshot) HasPosition() bool {
+	return snapshot.Valid(FieldLatitude) && snapshot.Valid(FieldLongitude)
+}
+
+// SnapshotOptions tells the parser how the feed writes its timestamps. The
+// feed sends local wall clock time without an offset, Location says whose.
+type SnapshotOptions struct {
+	Location    *time.Location
+	TimeLayouts []string
+}
+
+var DefaultTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"02-01-2006 15:04:05",
+	"2006/01/02 15:04:05",
+	"02/01/2006 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+}
+
+// DefaultSnapshotOptions reads feed times as UTC
+func DefaultSnapshotOptions() SnapshotOptions {
+	return SnapshotOptions{
+		Location:    time.UTC,
+		TimeLayouts: DefaultTimeLayouts,
+	}
+}
+
+type snapshotParser struct {
+	options SnapshotOptions
+	errors  []FieldParseError
+}
+
+// timestamp parses a feed wall clock time in the feed location and returns it in UTC
+func (p *snapshotParser) timestamp(field, value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		p.errors = append(p.errors, FieldParseError{Field: field, Value: value, Reason: ParseReasonMissing})
+		return time.Time{}
+	}
+
+	location := p.options.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	for _, layout := range p.options.TimeLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, location); err == nil {
+			return parsed.UTC()
+		}
+	}
+
+	p.errors = append(p.errors, FieldParseError{Field: field, Value: value, Reason: ParseReasonInvalid})
+	return time.Time{}
+}
+
+func (p *snapshotParser) float(field, value string) float64 {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if value == "" {
+		p.errors = append(p.errors, FieldParseError{Field: field, Value: value, Reason: ParseReasonMissing})
+		return 0
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.errors = append(p.errors, FieldParseError{Field: field, Value: value, Reason: ParseReasonInvalid})
+		return 0
+	}
+	return parsed
+}
+
+// flag understands the on/off spellings used across device models
+func (p *snapshotParser) flag(field, value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "on", "true", "yes", "open", "opened", "immobilize", "immobilized", "active":
+		return true
+	case "0", "off", "false", "no", "close", "closed", "mobilize", "mobilized", "inactive":
+		return false
+	case "", "na", "n/a", "-":
+		p.errors = append(p.errors, FieldParseError{Field: field, Value: value, Reason: ParseReasonMissing})
+		return false
+	default:
+		p.errors = append(p.errors, FieldParseError{Field: field, Value: value, Reason: ParseReasonInvalid})
+		return false
+	}
+}
+
+// ParseVehicleSnapshot converts the raw feed strings into typed values,
+// every value that is missing or unparsable is listed in ParseErrors
+func ParseVehicleSnapshot(vehicle VehiclesData, receivedAt time.Time, options SnapshotOptions) VehicleSnapshot {
+	if len(options.TimeLayouts) == 0 {
+		options.TimeLayouts = DefaultTimeLayouts
+	}
+	p := snapshotParser{options: options}
+
+	snapshot := VehicleSnapshot{
+		Speed:             p.float(FieldSpeed, vehicle.Speed),
+		Angle:             p.float(FieldAngle, vehicle.Angle),
+		Latitude:          p.float(FieldLatitude, vehicle.Latitude),
+		Longitude:         p.float(FieldLongitude, vehicle.Longitude),
+		Odometer:          p.float(FieldOdometer, vehicle.Odometer),
+		Temperature:       p.float(FieldTemperature, vehicle.Temperature),
+		ExternalVolt:      p.float(FieldExternalVolt, vehicle.ExternalVolt),
+		BatteryPercentage: p.float(FieldBatteryPercentage, vehicle.BatteryPercentage),
+		Ignition:          p.flag(FieldIgnition, vehicle.IGN),
+		Power:             p.flag(FieldPower, vehicle.Power),
+		AC:                p.flag(FieldAC, vehicle.AC),
+		SOS:               p.flag(FieldSOS, vehicle.SOS),
+		Immobilized:       p.flag(FieldImmobilized, vehicle.ImmobilizeState),
+		Door1:             p.flag(FieldDoor1, vehicle.Door1),
+		Door2:             p.flag(FieldDoor2, vehicle.Door2),
+		Door3:             p.flag(FieldDoor3, vehicle.Door3),
+		Door4:             p.flag(FieldDoor4, vehicle.Door4),
+		Running:           strings.EqualFold(strings.TrimSpace(vehicle.Status), "RUNNING"),
+		GPSTime:           p.timestamp(FieldGPSTime, vehicle.GPSActualTime),
+		DeviceTime:        p.timestamp(FieldDeviceTime, vehicle.Datetime),
+		ReceivedAt:        receivedAt.UTC(),
+	}
+	snapshot.ParseErrors = p.errors
+
+	return snapshot
+}
+
+// FixTime is when the position was taken, falling back to the device clock
+// and then to when we received the record
+func (snapshot *VehicleSnapshot) FixTime() time.Time {
+	switch {
+	case snapshot.Valid(FieldGPSTime):
+		return snapshot.GPSTime
+	case snapshot.Valid(FieldDeviceTime):
+		return snapshot.DeviceTime
+	default:
+		return snapshot.ReceivedAt
+	}
+}
+
+// TypedSnapshot returns the stored snapshot, documents written before the
+// snapshot existed are parsed on the fly with UTC as the feed location
+func (vehicle *VehiclesData) TypedSnapshot() VehicleSnapshot {
+	if vehicle.Snapshot != nil {
+		return *vehicle.Snapshot
+	}
+	return ParseVehicleSnapshot(*vehicle, vehicle.UpdatedAt.Time(), DefaultSnapshotOptions())
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVehicleSnapshotValues(t *testing.T) {
+	vehicle := VehiclesData{
+		Speed:             " 42.5 ",
+		Angle:             "270",
+		Latitude:          "18.5204",
+		Longitude:         "73.8567",
+		Odometer:          "1200.4",
+		Temperature:       "31",
+		ExternalVolt:      "12.6",
+		BatteryPercentage: "87%",
+		IGN:               "ON",
+		Power:             "1",
+		AC:                "off",
+		SOS:               "0",
+		ImmobilizeState:   "Mobilized",
+		Door1:             "Open",
+		Door2:             "closed",
+		Door3:             "0",
+		Door4:             "0",
+		Status:            "running",
+		GPSActualTime:     "2023-05-02 10:15:00",
+		Datetime:          "02-05-2023 10:15:30",
+	}
+	ist := time.FixedZone("IST", 5*3600+1800)
+	receivedAt := time.Date(2023, 5, 2, 5, 0, 0, 0, time.UTC)
+
+	snapshot := ParseVehicleSnapshot(vehicle, receivedAt, SnapshotOptions{Location: ist})
+
+	if len(snapshot.ParseErrors) != 0 {
+		t.Fatalf("unexpected parse errors %v", snapshot.ParseErrors)
+	}
+	if snapshot.Speed != 42.5 || snapshot.Angle != 270 || snapshot.BatteryPercentage != 87 {
+		t.Errorf("speed, angle, battery = %v, %v, %v", snapshot.Speed, snapshot.Angle, snapshot.BatteryPercentage)
+	}
+	if !snapshot.Ignition || !snapshot.Power || snapshot.AC || snapshot.Immobilized || !snapshot.Door1 || snapshot.Door2 {
+		t.Errorf("flags parsed wrong %+v", snapshot)
+	}
+	if !snapshot.Running {
+		t.Error("status running should set Running")
+	}
+	if want := time.Date(2023, 5, 2, 4, 45, 0, 0, time.UTC); !snapshot.GPSTime.Equal(want) || snapshot.GPSTime.Location() != time.UTC {
+		t.Errorf("gps time = %v, want %v in UTC", snapshot.GPSTime, want)
+	}
+	if want := time.Date(2023, 5, 2, 4, 45, 30, 0, time.UTC); !snapshot.DeviceTime.Equal(want) {
+		t.Errorf("device time = %v, want %v", snapshot.DeviceTime, want)
+	}
+	if !snapshot.FixTime().Equal(snapshot.GPSTime) {
+		t.Error("fix time should be the gps time")
+	}
+}
+
+func TestParseVehicleSnapshotErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		vehicle VehiclesData
+		field   string
+		reason  string
+	}{
+		{"missing speed", VehiclesData{Speed: " "}, FieldSpeed, ParseReasonMissing},
+		{"invalid speed", VehiclesData{Speed: "fast"}, FieldSpeed, ParseReasonInvalid},
+		{"invalid latitude", VehiclesData{Latitude: "18,52"}, FieldLatitude, ParseReasonInvalid},
+		{"na ignition", VehiclesData{IGN: "NA"}, FieldIgnition, ParseReasonMissing},
+		{"unknown door state", VehiclesData{Door1: "ajar"}, FieldDoor1, ParseReasonInvalid},
+		{"missing gps time", VehiclesData{}, FieldGPSTime, ParseReasonMissing},
+		{"unknown time layout", VehiclesData{GPSActualTime: "May 2 2023"}, FieldGPSTime, ParseReasonInvalid},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := ParseVehicleSnapshot(test.vehicle, time.Now(), DefaultSnapshotOptions())
+
+			if snapshot.Valid(test.field) {
+				t.Fatalf("%s should not be valid", test.field)
+			}
+			for _, parseErr := range snapshot.ParseErrors {
+				if parseErr.Field == test.field && parseErr.Reason != test.reason {
+					t.Errorf("%s reason = %s, want %s", test.field, parseErr.Reason, test.reason)
+				}
+			}
+
+			invalid := false
+			for _, parseErr := range snapshot.InvalidFields() {
+				invalid = invalid || parseErr.Field == test.field
+			}
+			if invalid != (test.reason == ParseReasonInvalid) {
+				t.Errorf("InvalidFields lists %s = %v", test.field, invalid)
+			}
+		})
+	}
+}
+
+func TestVehicleSnapshotFixTime(t *testing.T) {
+	receivedAt := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		vehicle VehiclesData
+		want    time.Time
+	}{
+		{"gps time", VehiclesData{GPSActualTime: "2023-05-02 09:00:00", Datetime: "2023-05-02 09:01:00"}, time.Date(2023, 5, 2, 9, 0, 0, 0, time.UTC)},
+		{"device time without gps time", VehiclesData{Datetime: "2023-05-02 09:01:00"}, time.Date(2023, 5, 2, 9, 1, 0, 0, time.UTC)},
+		{"received when both are missing", VehiclesData{}, receivedAt},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := ParseVehicleSnapshot(test.vehicle, receivedAt, DefaultSnapshotOptions())
+			if got := snapshot.FixTime(); !got.Equal(test.want) {
+				t.Errorf("FixTime() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// state change events of the vehicle_state_events collection
+const (
+	VehicleStateSOSPressed       = "sos_pressed"
+	VehicleStateSOSReleased      = "sos_released"
+	VehicleStateImmobilized      = "immobilized"
+	VehicleStateMobilized        = "mobilized"
+	VehicleStateDoorOpened       = "door_opened"
+	VehicleStateDoorClosed       = "door_closed"
+	VehicleStateDoorOpenedMoving = "door_opened_while_moving"
+	VehicleStateACOn             = "ac_on"
+	VehicleStateACOff            = "ac_off"
+)
+
+// VehicleStateEvent is one flag of the feed changing between two refreshes
+type VehicleStateEvent struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VehicleNo string             `json:"vehicle_no" bson:"vehicle_no"`
+	Event     string             `json:"event" bson:"event"`
+	Field     string             `json:"field" bson:"field"`
+	From      bool               `json:"from" bson:"from"`
+	To        bool               `json:"to" bson:"to"`
+	Moving    bool               `json:"moving" bson:"moving"`
+	Speed     float64            `json:"speed" bson:"speed"`
+	Latitude  float64            `json:"latitude" bson:"latitude"`
+	Longitude float64            `json:"longitude" bson:"longitude"`
+	Time      time.Time          `json:"time" bson:"time"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
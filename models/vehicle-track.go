@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VehicleTrackPoint is one fix in the vehicle_tracks time-series collection,
+// VehicleNo is the series meta field and Time the GPS time of the fix
+type VehicleTrackPoint struct {
+	Id            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VehicleNo     string             `json:"vehicle_no" bson:"vehicle_no"`
+	Time          time.Time          `json:"time" bson:"time"`
+	Latitude      float64            `json:"latitude" bson:"latitude"`
+	Longitude     float64            `json:"longitude" bson:"longitude"`
+	Speed         float64            `json:"speed" bson:"speed"`
+	Heading       float64            `json:"heading" bson:"heading"`
+	Odometer      float64            `json:"odometer" bson:"odometer"`
+	Ignition      bool               `json:"ignition" bson:"ignition"`
+	IgnitionKnown bool               `json:"ignition_known" bson:"ignition_known"`
+	Running       bool               `json:"running" bson:"running"`
+	Location      string             `json:"location,omitempty" bson:"location,omitempty"`
+	ReceivedAt    time.Time          `json:"received_at" bson:"received_at"`
+}
+
+// NewVehicleTrackPoint builds the track point of a parsed feed record, the
+// caller checks snapshot.HasPosition first
+func NewVehicleTrackPoint(vehicle VehiclesData, snapshot VehicleSnapshot) VehicleTrackPoint {
+	return VehicleTrackPoint{
+		VehicleNo:     vehicle.VehicleNo,
+		Time:          snapshot.FixTime(),
+		Latitude:      snapshot.Latitude,
+		Longitude:     snapshot.Longitude,
+		Speed:         snapshot.Speed,
+		Heading:       snapshot.Angle,
+		Odometer:      snapshot.Odometer,
+		Ignition:      snapshot.Ignition,
+		IgnitionKnown: snapshot.Valid(FieldIgnition),
+		Running:       snapshot.Running,
+		Location:      vehicle.Location,
+		ReceivedAt:    snapshot.ReceivedAt,
+	}
+}
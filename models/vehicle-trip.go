@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TripStatusOpen   = "open"
+	TripStatusClosed = "closed"
+)
+
+type TripLocation struct {
+	Latitude  float64 `json:"latitude" bson:"latitude"`
+	Longitude float64 `json:"longitude" bson:"longitude"`
+	Location  string  `json:"location,omitempty" bson:"location,omitempty"`
+}
+
+// TripFix is the last fix folded into an open trip, the next fix is
+// measured against it
+type TripFix struct {
+	Time      time.Time `json:"time" bson:"time"`
+	Latitude  float64   `json:"latitude" bson:"latitude"`
+	Longitude float64   `json:"longitude" bson:"longitude"`
+	Speed     float64   `json:"speed" bson:"speed"`
+}
+
+// VehicleTrip is one ignition on (or moving) stretch of a vehicle in the
+// vehicle_trips collection, an open trip is still being extended
+type VehicleTrip struct {
+	Id              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VehicleNo       string             `json:"vehicle_no" bson:"vehicle_no"`
+	Status          string             `json:"status" bson:"status"`
+	StartTime       time.Time          `json:"start_time" bson:"start_time"`
+	EndTime         time.Time          `json:"end_time" bson:"end_time"`
+	StartLocation   TripLocation       `json:"start_location" bson:"start_location"`
+	EndLocation     TripLocation       `json:"end_location" bson:"end_location"`
+	DistanceKm      float64            `json:"distance_km" bson:"distance_km"`
+	DurationSeconds int64              `json:"duration_seconds" bson:"duration_seconds"`
+	IdleSeconds     int64              `json:"idle_seconds" bson:"idle_seconds"`
+	MaxSpeed        float64            `json:"max_speed" bson:"max_speed"`
+	AvgSpeed        float64            `json:"avg_speed" bson:"avg_speed"`
+	AlertCount      int64              `json:"alert_count" bson:"alert_count"`
+	PointCount      int64              `json:"point_count" bson:"point_count"`
+	LastFix         TripFix            `json:"-" bson:"last_fix"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,168 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aniket0951/testproject/config"
+	sendinblue "github.com/sendinblue/APIv3-go-library/v2/lib"
+)
+
+type smtpNotifier struct {
+	email config.EmailConfig
+	// bounds the whole conversation with the server
+	timeout time.Duration
+}
+
+func NewSMTPNotifier(email config.EmailConfig, timeout time.Duration) Notifier {
+	return &smtpNotifier{email: email, timeout: timeout}
+}
+
+func (n *smtpNotifier) Channel() string {
+	return config.ChannelEmail
+}
+
+// Send hands the mail to the smtp server, it gives up at the ctx deadline or
+// after the notifier's timeout, whichever comes first
+func (n *smtpNotifier) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if n.email.SMTPUser != "" {
+		auth = smtp.PlainAuth("", n.email.SMTPUser, n.email.SMTPPassword, n.email.SMTPHost)
+	}
+
+	from := n.email.From
+	if n.email.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", mime.QEncoding.Encode("utf-8", n.email.FromName), n.email.From)
+	}
+
+	mail := strings.Join([]string{
+		"From: " + from,
+		"To: " + strings.Join(msg.Recipients, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	if n.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.timeout)
+		defer cancel()
+	}
+	return n.sendMail(ctx, auth, msg.Recipients, []byte(mail))
+}
+
+// sendMail is smtp.SendMail on a connection that is closed once ctx ends,
+// so a stalled server can't hold the caller
+func (n *smtpNotifier) sendMail(ctx context.Context, auth smtp.Auth, recipients []string, mail []byte) error {
+	addr := net.JoinHostPort(n.email.SMTPHost, strconv.Itoa(n.email.SMTPPort))
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	// a cancelled ctx without a deadline still ends the conversation
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, n.email.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Hello("localhost"); err != nil {
+		return err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.email.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server %s doesn't support AUTH", addr)
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.email.From); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(mail); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+type sendinblueNotifier struct {
+	email  config.EmailConfig
+	client *sendinblue.APIClient
+}
+
+func NewSendinblueNotifier(email config.EmailConfig, httpClient *http.Client) Notifier {
+	cfg := sendinblue.NewConfiguration()
+	cfg.AddDefaultHeader("api-key", email.SendinblueAPIKey)
+	cfg.HTTPClient = httpClient
+
+	return &sendinblueNotifier{
+		email:  email,
+		client: sendinblue.NewAPIClient(cfg),
+	}
+}
+
+func (n *sendinblueNotifier) Channel() string {
+	return config.ChannelEmail
+}
+
+func (n *sendinblueNotifier) Send(ctx context.Context, msg Message) error {
+	to := make([]sendinblue.SendSmtpEmailTo, len(msg.Recipients))
+	for i := range msg.Recipients {
+		to[i] = sendinblue.SendSmtpEmailTo{Email: msg.Recipients[i]}
+	}
+
+	_, _, err := n.client.TransactionalEmailsApi.SendTransacEmail(ctx, sendinblue.SendSmtpEmail{
+		Sender:      &sendinblue.SendSmtpEmailSender{Name: n.email.FromName, Email: n.email.From},
+		To:          to,
+		Subject:     msg.Subject,
+		TextContent: msg.Body,
+	})
+	return err
+}
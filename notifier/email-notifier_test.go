@@ -0,0 +1,63 @@
+package notifier
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aniket0951/testproject/config"
+)
+
+func TestSMTPNotifierStalledServer(t *testing.T) {
+	// accepts the connection but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	email := config.EmailConfig{SMTPHost: host, SMTPPort: portNumber, From: "alerts@mauto.in"}
+	msg := Message{Recipients: []string{"oncall@mauto.in"}, Subject: "test", Body: "test"}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+	}{
+		{"notifier timeout", 200 * time.Millisecond, func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(context.Background())
+		}},
+		{"ctx deadline", time.Minute, func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 200*time.Millisecond)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := test.ctx()
+			defer cancel()
+
+			started := time.Now()
+			err := NewSMTPNotifier(email, test.timeout).Send(ctx, msg)
+			if err == nil {
+				t.Fatal("want an error from a server that never answers")
+			}
+			if took := time.Since(started); took > 2*time.Second {
+				t.Errorf("send took %s", took)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aniket0951/testproject/config"
+)
+
+// Message is one rendered notification for the recipients of a channel
+type Message struct {
+	Recipients []string
+	Subject    string
+	Body       string
+	// the alert behind the message, webhooks post it along as json
+	Data interface{}
+}
+
+// Notifier delivers messages through one channel
+type Notifier interface {
+	Channel() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// New builds a notifier for every channel that has a route
+func New(cfg config.NotificationConfig) (map[string]Notifier, error) {
+	client := &http.Client{Timeout: cfg.TimeoutDuration()}
+	notifiers := map[string]Notifier{}
+
+	for _, route := range cfg.Routes {
+		if _, ok := notifiers[route.Channel]; ok {
+			continue
+		}
+
+		switch route.Channel {
+		case config.ChannelWebhook:
+			notifiers[route.Channel] = NewWebhookNotifier(cfg.Webhook, client)
+		case config.ChannelEmail:
+			switch cfg.Email.Provider {
+			case config.EmailProviderSendinblue:
+				notifiers[route.Channel] = NewSendinblueNotifier(cfg.Email, client)
+			default:
+				notifiers[route.Channel] = NewSMTPNotifier(cfg.Email, cfg.TimeoutDuration())
+			}
+		case config.ChannelSMS:
+			notifiers[route.Channel] = NewSMSNotifier(cfg.SMS, client)
+		default:
+			return nil, fmt.Errorf("notification channel %q is not supported", route.Channel)
+		}
+	}
+
+	return notifiers, nil
+}
@@ -0,0 +1,56 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aniket0951/testproject/config"
+)
+
+// smsNotifier talks to a plain http sms gateway, one request per number
+type smsNotifier struct {
+	sms    config.SMSConfig
+	client *http.Client
+}
+
+func NewSMSNotifier(sms config.SMSConfig, client *http.Client) Notifier {
+	return &smsNotifier{
+		sms:    sms,
+		client: client,
+	}
+}
+
+func (n *smsNotifier) Channel() string {
+	return config.ChannelSMS
+}
+
+type smsPayload struct {
+	To      string `json:"to"`
+	Sender  string `json:"sender,omitempty"`
+	Message string `json:"message"`
+}
+
+func (n *smsNotifier) Send(ctx context.Context, msg Message) error {
+	for _, number := range msg.Recipients {
+		payload, err := json.Marshal(smsPayload{To: number, Sender: n.sms.Sender, Message: msg.Body})
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.sms.URL, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if n.sms.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+n.sms.APIKey)
+		}
+
+		if err := do(n.client, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
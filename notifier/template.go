@@ -0,0 +1,86 @@
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/aniket0951/testproject/config"
+)
+
+// DefaultTemplateKey names the template used for alert types without their own
+const DefaultTemplateKey = "default"
+
+var defaultTemplate = config.NotificationTemplate{
+	Subject: `[{{.Severity}}] {{.AlertType}} {{.Event}} for {{.SubjectType}} {{.SubjectId}}`,
+	Body:    `{{.AlertType}} {{.Event}} for {{.SubjectType}} {{.SubjectId}} at {{.Time.Format "02 Jan 2006 15:04:05 MST"}}, {{.Field}} = {{.Value}}`,
+}
+
+// TemplateData is what message templates can refer to
+type TemplateData struct {
+	AlertType   string
+	Severity    string
+	Event       string
+	SubjectType string
+	SubjectId   string
+	Field       string
+	Value       float64
+	Time        time.Time
+}
+
+type compiled struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// Templates renders the subject and body of alert notifications
+type Templates struct {
+	templates map[string]compiled
+}
+
+// NewTemplates parses the configured templates, a missing default falls back
+// to the built in one
+func NewTemplates(configured map[string]config.NotificationTemplate) (*Templates, error) {
+	all := map[string]config.NotificationTemplate{DefaultTemplateKey: defaultTemplate}
+	for key, tmpl := range configured {
+		// a template may only override the subject or the body
+		if tmpl.Subject == "" {
+			tmpl.Subject = defaultTemplate.Subject
+		}
+		if tmpl.Body == "" {
+			tmpl.Body = defaultTemplate.Body
+		}
+		all[key] = tmpl
+	}
+
+	templates := &Templates{templates: map[string]compiled{}}
+	for key, tmpl := range all {
+		subject, err := template.New(key + ".subject").Parse(tmpl.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("notification template %s subject : %w", key, err)
+		}
+		body, err := template.New(key + ".body").Parse(tmpl.Body)
+		if err != nil {
+			return nil, fmt.Errorf("notification template %s body : %w", key, err)
+		}
+		templates.templates[key] = compiled{subject: subject, body: body}
+	}
+	return templates, nil
+}
+
+func (t *Templates) Render(data TemplateData) (string, string, error) {
+	tmpl, ok := t.templates[data.AlertType]
+	if !ok {
+		tmpl = t.templates[DefaultTemplateKey]
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
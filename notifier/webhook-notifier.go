@@ -0,0 +1,89 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aniket0951/testproject/config"
+)
+
+type webhookNotifier struct {
+	webhook config.WebhookConfig
+	client  *http.Client
+}
+
+func NewWebhookNotifier(webhook config.WebhookConfig, client *http.Client) Notifier {
+	return &webhookNotifier{
+		webhook: webhook,
+		client:  client,
+	}
+}
+
+func (n *webhookNotifier) Channel() string {
+	return config.ChannelWebhook
+}
+
+type webhookPayload struct {
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Alert   interface{} `json:"alert,omitempty"`
+}
+
+// Send posts the message to every recipient url, or the configured url when
+// the route names none
+func (n *webhookNotifier) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(webhookPayload{Subject: msg.Subject, Body: msg.Body, Alert: msg.Data})
+	if err != nil {
+		return err
+	}
+
+	urls := msg.Recipients
+	if len(urls) == 0 {
+		urls = []string{n.webhook.URL}
+	}
+
+	for _, url := range urls {
+		if err := n.post(ctx, url, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *webhookNotifier) post(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.webhook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.webhook.Secret))
+		mac.Write(payload)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	return do(n.client, req)
+}
+
+// do sends the request and turns a non 2xx answer into an error
+func do(client *http.Client, req *http.Request) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s answered %d : %s", req.URL.Host, res.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package proxyapis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aniket0951/testproject/config"
+	"github.com/aniket0951/testproject/models"
+)
+
+// FeedProvider is a telematics vendor feed. Every implementation maps its own
+// payload onto models.VehiclesData so services never see the vendor shape,
+// failures are returned as *FetchError so callers can branch with errors.Is.
+type FeedProvider interface {
+	Name() string
+	FetchVehicles(ctx context.Context) ([]models.VehiclesData, error)
+}
+
+// NewFeedProvider picks the implementation configured in feed.provider
+func NewFeedProvider(feed config.FeedConfig) (FeedProvider, error) {
+	switch feed.Provider {
+	case "", config.FeedProviderMobilogix:
+		return NewMobilogixProvider(feed), nil
+	default:
+		return nil, fmt.Errorf("unknown feed provider %q", feed.Provider)
+	}
+}
@@ -0,0 +1,52 @@
+package proxyapis
+
+import (
+	"context"
+
+	"github.com/aniket0951/testproject/config"
+	"github.com/aniket0951/testproject/models"
+	"github.com/mashingan/smapping"
+)
+
+type mobilogixProvider struct {
+	feed    config.FeedConfig
+	fetcher *Fetcher
+}
+
+func NewMobilogixProvider(feed config.FeedConfig) FeedProvider {
+	return &mobilogixProvider{
+		feed:    feed,
+		fetcher: NewFetcher(feed),
+	}
+}
+
+func (p *mobilogixProvider) Name() string {
+	return config.FeedProviderMobilogix
+}
+
+func (p *mobilogixProvider) FetchVehicles(ctx context.Context) ([]models.VehiclesData, error) {
+	reqURL := p.feed.LiveDataURL()
+
+	var responseData models.AutoGenerated
+	if err := p.fetcher.GetJSON(ctx, reqURL, &responseData); err != nil {
+		return nil, err
+	}
+
+	// Mobilogix answers 200 with an empty (or single placeholder) vehicle
+	// list when the account polls more often than its limit allows
+	if len(responseData.Root.VehicleData) <= 1 {
+		return nil, &FetchError{Kind: ErrRateLimited, URL: p.feed.BaseURL, StatusCode: 200}
+	}
+
+	vehicleData := make([]models.VehiclesData, 0, len(responseData.Root.VehicleData))
+
+	for i := range responseData.Root.VehicleData {
+		temp := models.VehiclesData{}
+		if err := smapping.FillStruct(&temp, smapping.MapFields(responseData.Root.VehicleData[i])); err != nil {
+			return nil, &FetchError{Kind: ErrDecode, URL: p.feed.BaseURL, StatusCode: 200, Err: err}
+		}
+		vehicleData = append(vehicleData, temp)
+	}
+
+	return vehicleData, nil
+}
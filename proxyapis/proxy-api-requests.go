@@ -1,36 +1,191 @@
 package proxyapis
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
 
-	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/config"
 )
 
-type ProxyAPIRequest interface {
-	GetAllVehicels(apiendpoint string) models.AutoGenerated
+// every FetchError matches exactly one of these with errors.Is
+var (
+	ErrNetwork     = errors.New("feed network error")
+	ErrHTTPStatus  = errors.New("feed http status error")
+	ErrDecode      = errors.New("feed decode error")
+	ErrRateLimited = errors.New("feed rate limited (API time limit exceed)")
+)
+
+type FetchError struct {
+	Kind       error
+	URL        string
+	StatusCode int
+	Attempts   int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	msg := e.Kind.Error()
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	if e.Attempts > 1 {
+		msg += fmt.Sprintf(" after %d attempts", e.Attempts)
+	}
+	if e.Err != nil {
+		msg += " : " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FetchError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Fetcher is a small JSON over HTTP client with a per request timeout,
+// retries with jittered exponential backoff and a cap on the body size
+type Fetcher struct {
+	client       *http.Client
+	maxRetries   int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	maxBodyBytes int64
+}
+
+func NewFetcher(feed config.FeedConfig) *Fetcher {
+	return &Fetcher{
+		client:       &http.Client{Timeout: feed.TimeoutDuration()},
+		maxRetries:   feed.Retries(),
+		baseBackoff:  feed.RetryBackoffDuration(),
+		maxBackoff:   feed.MaxRetryBackoffDuration(),
+		maxBodyBytes: feed.MaxResponseBytes,
+	}
+}
+
+// GetJSON fetches url and decodes the body into out. Network failures, 429
+// and 5xx responses are retried, anything else is returned straight away.
+func (f *Fetcher) GetJSON(ctx context.Context, url string, out interface{}) error {
+	var lastErr *FetchError
+	backoff := f.baseBackoff
+
+	for attempt := 1; attempt <= f.maxRetries+1; attempt++ {
+		retryAfter, err := f.getOnce(ctx, url, out)
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+		lastErr.Attempts = attempt
+		if !retryable(err) || attempt > f.maxRetries {
+			break
+		}
+
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > f.maxBackoff {
+			wait = f.maxBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return &FetchError{Kind: ErrNetwork, URL: redactQuery(url), Attempts: attempt, Err: ctx.Err()}
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > f.maxBackoff {
+			backoff = f.maxBackoff
+		}
+	}
+
+	return lastErr
 }
 
-func GetAllVehicels(apiendpoint string, channel chan models.AutoGenerated) {
-	resp, err := http.Get(apiendpoint)
+func (f *Fetcher) getOnce(ctx context.Context, rawURL string, out interface{}) (time.Duration, *FetchError) {
+	// the feed credentials travel in the query string, keep them out of errors
+	url := redactQuery(rawURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
-		channel <- models.AutoGenerated{}
+		return 0, &FetchError{Kind: ErrNetwork, URL: url, Err: errors.New("invalid request url")}
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			return
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
 		}
+		return 0, &FetchError{Kind: ErrNetwork, URL: url, Err: err}
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
 	}(resp.Body)
-	body, err := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return parseRetryAfter(resp.Header.Get("Retry-After")), &FetchError{Kind: ErrRateLimited, URL: url, StatusCode: resp.StatusCode}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, &FetchError{Kind: ErrHTTPStatus, URL: url, StatusCode: resp.StatusCode}
+	}
+
+	// read one byte more than allowed to tell a full body from a cut one
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.maxBodyBytes+1))
+	if err != nil {
+		return 0, &FetchError{Kind: ErrNetwork, URL: url, StatusCode: resp.StatusCode, Err: err}
+	}
+	if int64(len(body)) > f.maxBodyBytes {
+		return 0, &FetchError{Kind: ErrDecode, URL: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("response larger than %d bytes", f.maxBodyBytes)}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return 0, &FetchError{Kind: ErrDecode, URL: url, StatusCode: resp.StatusCode, Err: err}
+	}
+
+	return 0, nil
+}
+
+func retryable(err *FetchError) bool {
+	switch err.Kind {
+	case ErrNetwork, ErrRateLimited:
+		return true
+	case ErrHTTPStatus:
+		return err.StatusCode >= 500
+	default:
+		return false
+	}
+}
+
+func redactQuery(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
 	if err != nil {
-		channel <- models.AutoGenerated{}
+		return ""
+	}
+	parsed.RawQuery = ""
+	return parsed.String()
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
 	}
-	content := string(body)
-	var jsonMap models.AutoGenerated
-	_ = json.Unmarshal([]byte(content), &jsonMap)
-	channel <- jsonMap
-	close(channel)
+	return 0
 }
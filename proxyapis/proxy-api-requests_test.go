@@ -0,0 +1,229 @@
+package proxyapis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testFetcher retries fast so the tests don't wait on real backoffs
+func testFetcher(maxRetries int) *Fetcher {
+	return &Fetcher{
+		client:       &http.Client{Timeout: 2 * time.Second},
+		maxRetries:   maxRetries,
+		baseBackoff:  time.Millisecond,
+		maxBackoff:   10 * time.Millisecond,
+		maxBodyBytes: 64,
+	}
+}
+
+type response struct {
+	status     int
+	body       string
+	retryAfter string
+}
+
+// replay answers the n-th request with responses[n], the last one repeats
+func replay(t *testing.T, responses ...response) (*httptest.Server, *int64) {
+	t.Helper()
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&hits, 1) - 1
+		if n >= int64(len(responses)) {
+			n = int64(len(responses)) - 1
+		}
+		resp := responses[n]
+		if resp.retryAfter != "" {
+			w.Header().Set("Retry-After", resp.retryAfter)
+		}
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestFetcherGetJSON(t *testing.T) {
+	ok := response{status: http.StatusOK, body: `{"name":"MH12AB1234"}`}
+
+	tests := []struct {
+		name      string
+		responses []response
+		wantKind  error
+		wantHits  int64
+		// attempts and status code of the returned FetchError
+		wantAttempts int
+		wantStatus   int
+	}{
+		{"first try", []response{ok}, nil, 1, 0, 0},
+		{"5xx is retried", []response{{status: 503}, {status: 502}, ok}, nil, 3, 0, 0},
+		{"5xx until the retries run out", []response{{status: 500}}, ErrHTTPStatus, 3, 3, 500},
+		{"4xx is not retried", []response{{status: 404}}, ErrHTTPStatus, 1, 1, 404},
+		{"429 is retried", []response{{status: 429}, ok}, nil, 2, 0, 0},
+		{"429 until the retries run out", []response{{status: 429}}, ErrRateLimited, 3, 3, 429},
+		{"invalid json is not retried", []response{{status: 200, body: `{"name":`}}, ErrDecode, 1, 1, 200},
+		{"body at the size limit", []response{{status: 200, body: `{"name":"` + strings.Repeat("a", 53) + `"}`}}, nil, 1, 0, 0},
+		{"body over the size limit", []response{{status: 200, body: `{"name":"` + strings.Repeat("a", 54) + `"}`}}, ErrDecode, 1, 1, 200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, hits := replay(t, test.responses...)
+
+			var out struct{ Name string }
+			err := testFetcher(2).GetJSON(context.Background(), server.URL, &out)
+
+			if got := atomic.LoadInt64(hits); got != test.wantHits {
+				t.Errorf("requests = %d, want %d", got, test.wantHits)
+			}
+			if test.wantKind == nil {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if out.Name == "" {
+					t.Error("body was not decoded")
+				}
+				return
+			}
+
+			var fetchErr *FetchError
+			if !errors.As(err, &fetchErr) {
+				t.Fatalf("err = %v, want a *FetchError", err)
+			}
+			for _, kind := range []error{ErrNetwork, ErrHTTPStatus, ErrDecode, ErrRateLimited} {
+				if got := errors.Is(err, kind); got != (kind == test.wantKind) {
+					t.Errorf("errors.Is(err, %v) = %v", kind, got)
+				}
+			}
+			if fetchErr.Attempts != test.wantAttempts || fetchErr.StatusCode != test.wantStatus {
+				t.Errorf("attempts, status = %d, %d, want %d, %d", fetchErr.Attempts, fetchErr.StatusCode, test.wantAttempts, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFetcherNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	var out struct{}
+	err := testFetcher(1).GetJSON(context.Background(), url, &out)
+
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || !errors.Is(err, ErrNetwork) {
+		t.Fatalf("err = %v, want a network FetchError", err)
+	}
+	if fetchErr.Attempts != 2 {
+		t.Errorf("attempts = %d, network errors should be retried", fetchErr.Attempts)
+	}
+}
+
+func TestFetcherRedactsQuery(t *testing.T) {
+	server, _ := replay(t, response{status: 500})
+	url := server.URL + "/GetVehicleData?user=mauto&password=s3cret"
+
+	var out struct{}
+	err := testFetcher(0).GetJSON(context.Background(), url, &out)
+
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("err = %v, want a *FetchError", err)
+	}
+	if strings.Contains(err.Error(), "s3cret") || strings.Contains(fetchErr.URL, "s3cret") {
+		t.Errorf("the password leaked into %q / %q", err.Error(), fetchErr.URL)
+	}
+	if fetchErr.URL != server.URL+"/GetVehicleData" {
+		t.Errorf("url = %q, want the url without its query", fetchErr.URL)
+	}
+}
+
+func TestFetcherRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackoff time.Duration
+		minWait    time.Duration
+		maxWait    time.Duration
+	}{
+		{"waits as long as asked", 2 * time.Second, time.Second, 1900 * time.Millisecond},
+		{"capped by the max backoff", 50 * time.Millisecond, 0, 500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, _ := replay(t, response{status: 429, retryAfter: "1"}, response{status: 200, body: `{}`})
+			fetcher := testFetcher(1)
+			fetcher.maxBackoff = test.maxBackoff
+
+			started := time.Now()
+			var out struct{}
+			if err := fetcher.GetJSON(context.Background(), server.URL, &out); err != nil {
+				t.Fatal(err)
+			}
+			if took := time.Since(started); took < test.minWait || took > test.maxWait {
+				t.Errorf("took %s, want between %s and %s", took, test.minWait, test.maxWait)
+			}
+		})
+	}
+}
+
+func TestFetcherJitteredBackoff(t *testing.T) {
+	server, _ := replay(t, response{status: 503})
+	fetcher := testFetcher(4)
+	fetcher.baseBackoff = 20 * time.Millisecond
+	fetcher.maxBackoff = 40 * time.Millisecond
+
+	// the waits are random up to 20, 40, 40 and 40 ms
+	started := time.Now()
+	var out struct{}
+	_ = fetcher.GetJSON(context.Background(), server.URL, &out)
+	if took := time.Since(started); took > 140*time.Millisecond+500*time.Millisecond {
+		t.Errorf("took %s, the backoff should stay below 140ms in total", took)
+	}
+}
+
+func TestFetcherCancelledWhileWaiting(t *testing.T) {
+	server, _ := replay(t, response{status: 503})
+	fetcher := testFetcher(3)
+	fetcher.baseBackoff = time.Minute
+	fetcher.maxBackoff = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	var out struct{}
+	err := fetcher.GetJSON(ctx, server.URL, &out)
+	if !errors.Is(err, ErrNetwork) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a network error wrapping the ctx error", err)
+	}
+	if took := time.Since(started); took > 2*time.Second {
+		t.Errorf("took %s, the backoff should end with ctx", took)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"5", 5 * time.Second, 5 * time.Second},
+		{"0", 0, 0},
+		{"-3", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", test.value, got, test.min, test.max)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AlertRepository interface {
+	EnsureIndexes(ctx context.Context) error
+
+	GetAlertConfigs(ctx context.Context) ([]models.AlertConfig, error)
+	GetAlertConfigById(ctx context.Context, ruleId primitive.ObjectID) (models.AlertConfig, error)
+	AddAlertConfig(ctx context.Context, config *models.AlertConfig) error
+	SaveAlertConfig(ctx context.Context, config *models.AlertConfig) error
+	DeleteAlertConfig(ctx context.Context, ruleId primitive.ObjectID) error
+	AddAlertRuleAudit(ctx context.Context, audit models.AlertRuleAudit) error
+	// GetAlertRuleAudits lists the changes of one rule, or of every rule for
+	// the zero id
+	GetAlertRuleAudits(ctx context.Context, ruleId primitive.ObjectID, page models.PageRequest) ([]models.AlertRuleAudit, int64, error)
+	AddAlertEvents(ctx context.Context, events []models.AlertEvent) error
+	GetIncidentEvents(ctx context.Context, incidentId primitive.ObjectID) ([]models.AlertEvent, error)
+
+	// FindLatestIncident returns the newest incident of the rule for the
+	// subject, mongo.ErrNoDocuments when there is none
+	FindLatestIncident(ctx context.Context, ruleId primitive.ObjectID, alertType, subjectType, subjectId string) (models.AlertIncident, error)
+	GetIncidentById(ctx context.Context, incidentId primitive.ObjectID) (models.AlertIncident, error)
+	SaveIncident(ctx context.Context, incident *models.AlertIncident) error
+	// GetLiveIncidents returns every open or acknowledged incident
+	GetLiveIncidents(ctx context.Context) ([]models.AlertIncident, error)
+	GetIncidents(ctx context.Context, filter models.IncidentFilter, page models.PageRequest) ([]models.AlertIncident, int64, error)
+}
+
+type alertrepository struct {
+	alertConfigCollection    *mongo.Collection
+	alertRuleAuditCollection *mongo.Collection
+	alertEventCollection     *mongo.Collection
+	alertIncidentCollection  *mongo.Collection
+}
+
+func NewAlertRepository(db CollectionProvider) AlertRepository {
+	return &alertrepository{
+		alertConfigCollection:    db.Collection("alert_config"),
+		alertRuleAuditCollection: db.Collection("alert_config_audit"),
+		alertEventCollection:     db.Collection("alert_events"),
+		alertIncidentCollection:  db.Collection("alert_incidents"),
+	}
+}
+
+func (db *alertrepository) EnsureIndexes(ctx context.Context) error {
+	_, err := db.alertIncidentCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				bson.E{Key: "subject_type", Value: 1},
+				bson.E{Key: "subject_id", Value: 1},
+				bson.E{Key: "alert_type", Value: 1},
+				bson.E{Key: "started_at", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "status", Value: 1},
+				bson.E{Key: "started_at", Value: -1},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.alertEventCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "incident_id", Value: 1},
+			bson.E{Key: "time", Value: 1},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.alertRuleAuditCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "rule_id", Value: 1},
+			bson.E{Key: "time", Value: -1},
+		},
+	})
+	return err
+}
+
+func (db *alertrepository) GetAlertConfigs(ctx context.Context) ([]models.AlertConfig, error) {
+	cursor, err := db.alertConfigCollection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []models.AlertConfig{}
+	if err := cursor.All(ctx, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+func (db *alertrepository) GetAlertConfigById(ctx context.Context, ruleId primitive.ObjectID) (models.AlertConfig, error) {
+	config := models.AlertConfig{}
+	err := db.alertConfigCollection.FindOne(ctx, bson.D{bson.E{Key: "_id", Value: ruleId}}).Decode(&config)
+	return config, err
+}
+
+func (db *alertrepository) AddAlertConfig(ctx context.Context, config *models.AlertConfig) error {
+	config.Id = primitive.NewObjectID()
+	config.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	config.UpdatedAt = config.CreatedAt
+
+	_, err := db.alertConfigCollection.InsertOne(ctx, config)
+	return err
+}
+
+func (db *alertrepository) SaveAlertConfig(ctx context.Context, config *models.AlertConfig) error {
+	config.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	res, err := db.alertConfigCollection.ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: config.Id}}, config)
+	if err == nil && res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return err
+}
+
+func (db *alertrepository) DeleteAlertConfig(ctx context.Context, ruleId primitive.ObjectID) error {
+	res, err := db.alertConfigCollection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: ruleId}})
+	if err == nil && res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return err
+}
+
+func (db *alertrepository) AddAlertRuleAudit(ctx context.Context, audit models.AlertRuleAudit) error {
+	audit.Id = primitive.NewObjectID()
+	_, err := db.alertRuleAuditCollection.InsertOne(ctx, audit)
+	return err
+}
+
+func (db *alertrepository) GetAlertRuleAudits(ctx context.Context, ruleId primitive.ObjectID, page models.PageRequest) ([]models.AlertRuleAudit, int64, error) {
+	query := bson.D{}
+	if !ruleId.IsZero() {
+		query = append(query, bson.E{Key: "rule_id", Value: ruleId})
+	}
+
+	audits := []models.AlertRuleAudit{}
+	total, err := findPage(ctx, db.alertRuleAuditCollection, query, page, &audits)
+	return audits, total, err
+}
+
+func (db *alertrepository) AddAlertEvents(ctx context.Context, events []models.AlertEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(events))
+	for i := range events {
+		events[i].CreatedAt = time.Now().UTC()
+		docs[i] = events[i]
+	}
+
+	_, err := db.alertEventCollection.InsertMany(ctx, docs)
+	return err
+}
+
+func (db *alertrepository) GetIncidentEvents(ctx context.Context, incidentId primitive.ObjectID) ([]models.AlertEvent, error) {
+	filter := bson.D{
+		bson.E{Key: "incident_id", Value: incidentId},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "time", Value: 1}})
+
+	cursor, err := db.alertEventCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AlertEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (db *alertrepository) FindLatestIncident(ctx context.Context, ruleId primitive.ObjectID, alertType, subjectType, subjectId string) (models.AlertIncident, error) {
+	filter := bson.D{
+		bson.E{Key: "subject_type", Value: subjectType},
+		bson.E{Key: "subject_id", Value: subjectId},
+		bson.E{Key: "alert_type", Value: alertType},
+		bson.E{Key: "rule_id", Value: ruleId},
+	}
+	opts := options.FindOne().SetSort(bson.D{bson.E{Key: "started_at", Value: -1}})
+
+	incident := models.AlertIncident{}
+	err := db.alertIncidentCollection.FindOne(ctx, filter, opts).Decode(&incident)
+	return incident, err
+}
+
+func (db *alertrepository) GetIncidentById(ctx context.Context, incidentId primitive.ObjectID) (models.AlertIncident, error) {
+	incident := models.AlertIncident{}
+	err := db.alertIncidentCollection.FindOne(ctx, bson.D{bson.E{Key: "_id", Value: incidentId}}).Decode(&incident)
+	return incident, err
+}
+
+// SaveIncident inserts a new incident or replaces the stored one
+func (db *alertrepository) SaveIncident(ctx context.Context, incident *models.AlertIncident) error {
+	incident.UpdatedAt = time.Now().UTC()
+
+	if incident.Id.IsZero() {
+		incident.Id = primitive.NewObjectID()
+		incident.CreatedAt = incident.UpdatedAt
+		_, err := db.alertIncidentCollection.InsertOne(ctx, incident)
+		return err
+	}
+
+	_, err := db.alertIncidentCollection.ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: incident.Id}}, incident)
+	return err
+}
+
+func (db *alertrepository) GetLiveIncidents(ctx context.Context) ([]models.AlertIncident, error) {
+	filter := bson.D{
+		bson.E{Key: "status", Value: bson.D{bson.E{Key: "$ne", Value: models.IncidentStatusResolved}}},
+	}
+
+	cursor, err := db.alertIncidentCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	incidents := []models.AlertIncident{}
+	if err := cursor.All(ctx, &incidents); err != nil {
+		return nil, err
+	}
+	return incidents, nil
+}
+
+func (db *alertrepository) GetIncidents(ctx context.Context, filter models.IncidentFilter, page models.PageRequest) ([]models.AlertIncident, int64, error) {
+	query := bson.D{}
+	if filter.Status != "" {
+		query = append(query, bson.E{Key: "status", Value: filter.Status})
+	}
+	if filter.SubjectType != "" {
+		query = append(query, bson.E{Key: "subject_type", Value: filter.SubjectType})
+	}
+	if match := subjectMatch(filter.SubjectId, filter.SubjectIds); match != nil {
+		query = append(query, bson.E{Key: "subject_id", Value: match})
+	}
+	if filter.AlertType != "" {
+		query = append(query, bson.E{Key: "alert_type", Value: filter.AlertType})
+	}
+
+	startedAt := bson.D{}
+	if !filter.From.IsZero() {
+		startedAt = append(startedAt, bson.E{Key: "$gte", Value: filter.From})
+	}
+	if !filter.To.IsZero() {
+		startedAt = append(startedAt, bson.E{Key: "$lte", Value: filter.To})
+	}
+	if len(startedAt) > 0 {
+		query = append(query, bson.E{Key: "started_at", Value: startedAt})
+	}
+
+	incidents := []models.AlertIncident{}
+	total, err := findPage(ctx, db.alertIncidentCollection, query, page, &incidents)
+	return incidents, total, err
+}
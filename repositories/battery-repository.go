@@ -3,11 +3,8 @@ package repositories
 import (
 	"context"
 
-	"fmt"
-
 	"time"
 
-	dbconfig "github.com/aniket0951/testproject/db-config"
 	"github.com/aniket0951/testproject/models"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,47 +13,47 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	batterySevenHourUnreportedConnection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_seven_hour_unreported")
-	batteryS24HourUnreportedConnection   = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_twenty_four_hour_unreported")
-	chargingReportTempConnection         = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "charging_temp_report")
-	chargingReportHistoryConnection      = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "charging_report_history")
-)
-
 type BatteryRepository interface {
-	Init() (context.Context, context.CancelFunc)
-	GetOfflineBattery() ([]models.BatteryHardwareMain, error)
-	GetIdleBattery() ([]models.BatteryHardwareMain, error)
-	GetMoveBattery() ([]models.BatteryHardwareMain, error)
-	GetBatteryCount() (int64, error)
+	GetOfflineBattery(ctx context.Context) ([]models.BatteryHardwareMain, error)
+	GetIdleBattery(ctx context.Context) ([]models.BatteryHardwareMain, error)
+	GetMoveBattery(ctx context.Context) ([]models.BatteryHardwareMain, error)
+	GetBatteryCount(ctx context.Context) (int64, error)
 
-	UpdateBatteryOfflineStatus([]models.BatteryHardwareMain) error
-	UpdateBatteryIdleStatus([]models.BatteryHardwareMain) error
-	UpdateBatteryMoveStatus([]models.BatteryHardwareMain) error
+	UpdateBatteryOfflineStatus(ctx context.Context, batteryData []models.BatteryHardwareMain) error
+	UpdateBatteryIdleStatus(ctx context.Context, batteryData []models.BatteryHardwareMain) error
+	UpdateBatteryMoveStatus(ctx context.Context, batteryData []models.BatteryHardwareMain) error
 
 	// battery distance calculater or ODO meter
-	GetBatteryDistanceTravelled() ([]models.BatteryDistanceTravelled, error)
-	UpdateBatteryDistanceTravelled([]models.UpdateBatteryDistanceTravelled) error
-	DeleteTodayDistanceTravelled() error
+	GetBatteryDistanceTravelled(ctx context.Context) ([]models.BatteryDistanceTravelled, error)
+	UpdateBatteryDistanceTravelled(ctx context.Context, batteryData []models.UpdateBatteryDistanceTravelled) error
+	DeleteTodayDistanceTravelled(ctx context.Context) error
 
 	// hourly reported and unreported count
-	GetLastSevenHourUnreported() ([]models.LastSevenHourUnreported, error)
-	GetLast1hoursUnreportedData() (map[string]int64, error)
-	GetLast7hoursUnreportedData() ([]models.LastSevenHourUnreported, error)
-	GetLast24hoursUnreportedData() ([]models.Last24HourUnreportedSpecificData, error)
-	InsertLastSevenHourUnreported(data models.LastSevenHourUnreported) error
-	DeleteLastSevenHourUnreported() error
-	InsertLast24HourUnreported(models.Last24HourUnreported) error
-	DeleteAllLast24HourUnreported() error
+	GetLastSevenHourUnreported(ctx context.Context) ([]models.LastSevenHourUnreported, error)
+	GetLast1hoursUnreportedData(ctx context.Context) (map[string]int64, error)
+	GetLast7hoursUnreportedData(ctx context.Context) ([]models.LastSevenHourUnreported, error)
+	GetLast24hoursUnreportedData(ctx context.Context) ([]models.Last24HourUnreportedSpecificData, error)
+	InsertLastSevenHourUnreported(ctx context.Context, data models.LastSevenHourUnreported) error
+	DeleteLastSevenHourUnreported(ctx context.Context) error
+	InsertLast24HourUnreported(ctx context.Context, data models.Last24HourUnreported) error
+	DeleteAllLast24HourUnreported(ctx context.Context) error
 
 	//Charging Reports
-	CheckChargingCycleStartOrNot(bmsId string) models.StartChargingReport
-	StartChargingReport([]models.StartChargingReport) error
-	EndChargingReport([]models.EndChargingReport) error
-	GetCurrentCycleEnd() ([]models.ChargingReport, error)
-	CreateChargingReportHistory(batteryData []models.ChargingReport) error
-	UpdateBatteryCurrentInMain(oldCurrentData []models.UpdateOldCurrent) error
-	DeleteChargingTempReport(bmsIDs []string) error
+	CheckChargingCycleStartOrNot(ctx context.Context, bmsId string) models.StartChargingReport
+	StartChargingReport(ctx context.Context, batteryData []models.StartChargingReport) error
+	EndChargingReport(ctx context.Context, batteryData []models.EndChargingReport) error
+	GetCurrentCycleEnd(ctx context.Context) ([]models.ChargingReport, error)
+	CreateChargingReportHistory(ctx context.Context, batteryData []models.ChargingReport) error
+	UpdateBatteryCurrentInMain(ctx context.Context, oldCurrentData []models.UpdateOldCurrent) error
+	DeleteChargingTempReport(ctx context.Context, bmsIDs []string) error
+
+	// api queries
+	GetBatteryByBmsID(ctx context.Context, bmsID string) (models.BatteryHardwareMain, error)
+	GetChargingReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.ChargingReport, int64, error)
+	GetCycleReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.CreateCycleBasedReport, int64, error)
+	GetLast24HourUnreported(ctx context.Context) ([]models.Last24HourUnreported, error)
+	// GetScopeBmsIds returns the bms ids of the batteries in the scope
+	GetScopeBmsIds(ctx context.Context, scope models.Scope) ([]string, error)
 }
 
 type batteryRepository struct {
@@ -67,26 +64,25 @@ type batteryRepository struct {
 	battery24HourUnreportedCollection    *mongo.Collection
 	chargingReportTempCollection         *mongo.Collection
 	chargingReportHistoryCollection      *mongo.Collection
+	batteryCycleHistoryCollection        *mongo.Collection
+	telematics                           TelematicsProvider
 }
 
-func NewBatteryRepository() BatteryRepository {
+func NewBatteryRepository(db CollectionProvider, telematics TelematicsProvider) BatteryRepository {
 	return &batteryRepository{
-		batteryMainConnection:                batteryMainCollection,
-		batteryReportingConnection:           batteryReportingCollection,
-		batteryDistanceTravelledConnection:   batteryDistanceTravelledCollection,
-		batterySevenHourUnreportedCollection: batterySevenHourUnreportedConnection,
-		battery24HourUnreportedCollection:    batteryS24HourUnreportedConnection,
-		chargingReportTempCollection:         chargingReportTempConnection,
-		chargingReportHistoryCollection:      chargingReportHistoryConnection,
+		batteryMainConnection:                db.Collection("battery_main"),
+		batteryReportingConnection:           db.Collection("battery_reporting"),
+		batteryDistanceTravelledConnection:   db.Collection("battery_distance_travelled"),
+		batterySevenHourUnreportedCollection: db.Collection("battery_seven_hour_unreported"),
+		battery24HourUnreportedCollection:    db.Collection("battery_twenty_four_hour_unreported"),
+		chargingReportTempCollection:         db.Collection("charging_temp_report"),
+		chargingReportHistoryCollection:      db.Collection("charging_report_history"),
+		batteryCycleHistoryCollection:        db.Collection("battery_cycle_history"),
+		telematics:                           telematics,
 	}
 }
 
-func (db *batteryRepository) Init() (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Second)
-	return ctx, cancel
-}
-
-func (db *batteryRepository) GetOfflineBattery() ([]models.BatteryHardwareMain, error) {
+func (db *batteryRepository) GetOfflineBattery(ctx context.Context) ([]models.BatteryHardwareMain, error) {
 	currentTime := time.Now()
 	last30Min := currentTime.Add(-30 * time.Minute)
 
@@ -100,9 +96,6 @@ func (db *batteryRepository) GetOfflineBattery() ([]models.BatteryHardwareMain,
 		},
 	}
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	cursor, curErr := db.batteryMainConnection.Aggregate(ctx, filter)
 
 	if curErr != nil {
@@ -111,13 +104,13 @@ func (db *batteryRepository) GetOfflineBattery() ([]models.BatteryHardwareMain,
 
 	var batteryData []models.BatteryHardwareMain
 
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
+	if err := cursor.All(ctx, &batteryData); err != nil {
 		return nil, err
 	}
 	return batteryData, nil
 }
 
-func (db *batteryRepository) UpdateBatteryOfflineStatus(batteryData []models.BatteryHardwareMain) error {
+func (db *batteryRepository) UpdateBatteryOfflineStatus(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	operation := []mongo.WriteModel{}
 
 	for i := range batteryData {
@@ -140,9 +133,6 @@ func (db *batteryRepository) UpdateBatteryOfflineStatus(batteryData []models.Bat
 		bulkOption := options.BulkWriteOptions{}
 		bulkOption.SetOrdered(true)
 
-		ctx, cancel := db.Init()
-		defer cancel()
-
 		_, err := db.batteryMainConnection.BulkWrite(ctx, operation)
 		//fmt.Println("Offline update result : ", res)
 		return err
@@ -150,7 +140,7 @@ func (db *batteryRepository) UpdateBatteryOfflineStatus(batteryData []models.Bat
 	return nil
 }
 
-func (db *batteryRepository) GetIdleBattery() ([]models.BatteryHardwareMain, error) {
+func (db *batteryRepository) GetIdleBattery(ctx context.Context) ([]models.BatteryHardwareMain, error) {
 	currentTime := primitive.NewDateTimeFromTime(time.Now())
 	last30Min := currentTime.Time().Add(-30 * time.Minute)
 
@@ -165,9 +155,6 @@ func (db *batteryRepository) GetIdleBattery() ([]models.BatteryHardwareMain, err
 		},
 	}
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	cursor, curErr := db.batteryMainConnection.Aggregate(ctx, filter)
 
 	if curErr != nil {
@@ -176,7 +163,7 @@ func (db *batteryRepository) GetIdleBattery() ([]models.BatteryHardwareMain, err
 
 	var batteryData []models.BatteryHardwareMain
 
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
+	if err := cursor.All(ctx, &batteryData); err != nil {
 		return nil, err
 	}
 
@@ -185,9 +172,7 @@ func (db *batteryRepository) GetIdleBattery() ([]models.BatteryHardwareMain, err
 	return batteryData, nil
 }
 
-func (db *batteryRepository) UpdateBatteryIdleStatus(batteryData []models.BatteryHardwareMain) error {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) UpdateBatteryIdleStatus(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 
 	operation := []mongo.WriteModel{}
 
@@ -210,11 +195,11 @@ func (db *batteryRepository) UpdateBatteryIdleStatus(batteryData []models.Batter
 	bulkOption.SetOrdered(true)
 
 	res, err := db.batteryMainConnection.BulkWrite(ctx, operation)
-	fmt.Println("Update Idle Result : ", res)
+	logBulkWrite(ctx, "updated battery idle status", res)
 
 	return err
 }
-func (db *batteryRepository) GetMoveBattery() ([]models.BatteryHardwareMain, error) {
+func (db *batteryRepository) GetMoveBattery(ctx context.Context) ([]models.BatteryHardwareMain, error) {
 	currentTime := primitive.NewDateTimeFromTime(time.Now())
 	last30Min := currentTime.Time().Add(-30 * time.Minute)
 
@@ -232,9 +217,6 @@ func (db *batteryRepository) GetMoveBattery() ([]models.BatteryHardwareMain, err
 		},
 	}
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	cursor, curErr := db.batteryMainConnection.Aggregate(ctx, filter)
 
 	if curErr != nil {
@@ -242,14 +224,14 @@ func (db *batteryRepository) GetMoveBattery() ([]models.BatteryHardwareMain, err
 	}
 
 	var batteryData []models.BatteryHardwareMain
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
+	if err := cursor.All(ctx, &batteryData); err != nil {
 		return nil, err
 	}
 
 	return batteryData, nil
 }
 
-func (db *batteryRepository) UpdateBatteryMoveStatus(batteryData []models.BatteryHardwareMain) error {
+func (db *batteryRepository) UpdateBatteryMoveStatus(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	if len(batteryData) > 0 {
 		operation := []mongo.WriteModel{}
 
@@ -272,19 +254,14 @@ func (db *batteryRepository) UpdateBatteryMoveStatus(batteryData []models.Batter
 		bulkOption := options.BulkWriteOptions{}
 		bulkOption.SetOrdered(true)
 
-		ctx, cancel := db.Init()
-		defer cancel()
-
 		res, err := db.batteryMainConnection.BulkWrite(ctx, operation)
-		fmt.Println("Move update result : ", res)
+		logBulkWrite(ctx, "updated battery move status", res)
 		return err
 	}
 	return nil
 }
 
-func (db *batteryRepository) GetBatteryDistanceTravelled() ([]models.BatteryDistanceTravelled, error) {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) GetBatteryDistanceTravelled(ctx context.Context) ([]models.BatteryDistanceTravelled, error) {
 
 	cursor, curErr := db.batteryDistanceTravelledConnection.Find(ctx, bson.M{})
 
@@ -294,14 +271,14 @@ func (db *batteryRepository) GetBatteryDistanceTravelled() ([]models.BatteryDist
 
 	var batteryData []models.BatteryDistanceTravelled
 
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
+	if err := cursor.All(ctx, &batteryData); err != nil {
 		return nil, err
 	}
 
 	return batteryData, nil
 }
 
-func (db *batteryRepository) UpdateBatteryDistanceTravelled(batteryData []models.UpdateBatteryDistanceTravelled) error {
+func (db *batteryRepository) UpdateBatteryDistanceTravelled(ctx context.Context, batteryData []models.UpdateBatteryDistanceTravelled) error {
 	operation := []mongo.WriteModel{}
 
 	for i := range batteryData {
@@ -323,9 +300,6 @@ func (db *batteryRepository) UpdateBatteryDistanceTravelled(batteryData []models
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	_, err := db.batteryMainConnection.BulkWrite(ctx, operation)
 	_, reportingErr := db.batteryReportingConnection.BulkWrite(ctx, operation)
 	if reportingErr != nil {
@@ -334,18 +308,13 @@ func (db *batteryRepository) UpdateBatteryDistanceTravelled(batteryData []models
 	return err
 }
 
-func (db *batteryRepository) DeleteTodayDistanceTravelled() error {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) DeleteTodayDistanceTravelled(ctx context.Context) error {
 
 	_, err := db.batteryDistanceTravelledConnection.DeleteMany(ctx, bson.M{})
 	return err
 }
 
-func (db *batteryRepository) GetLastSevenHourUnreported() ([]models.LastSevenHourUnreported, error) {
-
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) GetLastSevenHourUnreported(ctx context.Context) ([]models.LastSevenHourUnreported, error) {
 
 	cursor, curErr := db.batterySevenHourUnreportedCollection.Find(ctx, bson.M{})
 
@@ -355,7 +324,7 @@ func (db *batteryRepository) GetLastSevenHourUnreported() ([]models.LastSevenHou
 
 	var batteryData []models.LastSevenHourUnreported
 
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
+	if err := cursor.All(ctx, &batteryData); err != nil {
 		return nil, err
 	}
 
@@ -363,33 +332,29 @@ func (db *batteryRepository) GetLastSevenHourUnreported() ([]models.LastSevenHou
 }
 
 // delete last record for only maintain a 7 hour
-func (db *batteryRepository) DeleteLastSevenHourUnreported() error {
-
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) DeleteLastSevenHourUnreported(ctx context.Context) error {
 
 	_, err := db.batterySevenHourUnreportedCollection.DeleteMany(ctx, bson.M{})
 	return err
 }
 
-func (db *batteryRepository) InsertLastSevenHourUnreported(data models.LastSevenHourUnreported) error {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) InsertLastSevenHourUnreported(ctx context.Context, data models.LastSevenHourUnreported) error {
 
 	_, err := db.batterySevenHourUnreportedCollection.InsertOne(ctx, data)
 	return err
 }
 
-func (db *batteryRepository) GetLast1hoursUnreportedData() (map[string]int64, error) {
-	ConnectToMDB()
-	var remote = "telematics"
-	rawDataCollection := Mclient.Database(remote).Collection("bms_rawdata")
+func (db *batteryRepository) GetLast1hoursUnreportedData(ctx context.Context) (map[string]int64, error) {
+	rawDataCollection, err := db.rawDataCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
 	ref := 1
 	mp := map[string]int64{}
 	currentTime := time.Now()
 
 	from := currentTime.Add(time.Hour * time.Duration(-ref))
-	data, _ := QueryHelper(from, currentTime, rawDataCollection)
+	data, _ := QueryHelper(ctx, from, currentTime, rawDataCollection)
 	ref++
 	hourFormat := currentTime.Format("15:04:05")
 	mp[hourFormat] = data
@@ -397,10 +362,11 @@ func (db *batteryRepository) GetLast1hoursUnreportedData() (map[string]int64, er
 	return mp, nil
 }
 
-func (db *batteryRepository) GetLast7hoursUnreportedData() ([]models.LastSevenHourUnreported, error) {
-	ConnectToMDB()
-	var remote = "telematics"
-	rawDataCollection := Mclient.Database(remote).Collection("bms_rawdata")
+func (db *batteryRepository) GetLast7hoursUnreportedData(ctx context.Context) ([]models.LastSevenHourUnreported, error) {
+	rawDataCollection, err := db.rawDataCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
 	ref := 1
 	//mp := map[string]int64{}
 	batteryData := []models.LastSevenHourUnreported{}
@@ -408,7 +374,7 @@ func (db *batteryRepository) GetLast7hoursUnreportedData() ([]models.LastSevenHo
 	for ref <= 7 {
 		if ref == 1 {
 			from := currentTime.Add(time.Hour * time.Duration(-ref))
-			data, _ := QueryHelper(from, currentTime, rawDataCollection)
+			data, _ := QueryHelper(ctx, from, currentTime, rawDataCollection)
 			ref++
 			hourFormat := currentTime.Format("15:04:05")
 			temp := models.LastSevenHourUnreported{
@@ -422,7 +388,7 @@ func (db *batteryRepository) GetLast7hoursUnreportedData() ([]models.LastSevenHo
 			toint := ref - 1
 			from := currentTime.Add(time.Duration(-ref) * time.Hour)
 			to := currentTime.Add(time.Duration(-toint) * time.Hour)
-			data, _ := QueryHelper(from, to, rawDataCollection)
+			data, _ := QueryHelper(ctx, from, to, rawDataCollection)
 			hourFormat := to.Format("15:04:05")
 			temp := models.LastSevenHourUnreported{
 				Time:            hourFormat,
@@ -438,7 +404,18 @@ func (db *batteryRepository) GetLast7hoursUnreportedData() ([]models.LastSevenHo
 	return batteryData, nil
 }
 
-func QueryHelper(from, to time.Time, rawDataCollection *mongo.Collection) (int64, error) {
+// bms_rawdata lives on the telematics cluster
+func (db *batteryRepository) rawDataCollection(ctx context.Context) (*mongo.Collection, error) {
+
+	telematicsDB, err := db.telematics.Database(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return telematicsDB.Collection("bms_rawdata"), nil
+}
+
+func QueryHelper(ctx context.Context, from, to time.Time, rawDataCollection *mongo.Collection) (int64, error) {
 
 	filter := []bson.M{
 		{
@@ -459,31 +436,32 @@ func QueryHelper(from, to time.Time, rawDataCollection *mongo.Collection) (int64
 		},
 	}
 
-	cursor, curErr := rawDataCollection.Aggregate(context.TODO(), filter)
+	cursor, curErr := rawDataCollection.Aggregate(ctx, filter)
 	if curErr != nil {
 		return 0, curErr
 	}
 
 	var bdata []bson.M
 
-	if err := cursor.All(context.TODO(), &bdata); err != nil {
+	if err := cursor.All(ctx, &bdata); err != nil {
 		return 0, err
 	}
 
 	return int64(len(bdata)), nil
 }
 
-func (db *batteryRepository) GetLast24hoursUnreportedData() ([]models.Last24HourUnreportedSpecificData, error) {
-	ConnectToMDB()
-	var remote = "telematics"
-	rawDataCollection := Mclient.Database(remote).Collection("bms_rawdata")
+func (db *batteryRepository) GetLast24hoursUnreportedData(ctx context.Context) ([]models.Last24HourUnreportedSpecificData, error) {
+	rawDataCollection, err := db.rawDataCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
 	ref := 1
 	batteryData := []models.Last24HourUnreportedSpecificData{}
 	currentTime := time.Now().UTC()
 	for ref <= 24 {
 		if ref == 1 {
 			from := currentTime.Add(time.Hour * time.Duration(-ref))
-			data, _ := QueryHelperFor24HourUnreported(from, currentTime, rawDataCollection)
+			data, _ := QueryHelperFor24HourUnreported(ctx, from, currentTime, rawDataCollection)
 			ref++
 			hourFormat := currentTime.Format("15:04:05")
 			temp := models.Last24HourUnreportedSpecificData{
@@ -498,7 +476,7 @@ func (db *batteryRepository) GetLast24hoursUnreportedData() ([]models.Last24Hour
 			toint := ref - 1
 			from := currentTime.Add(time.Duration(-ref) * time.Hour)
 			to := currentTime.Add(time.Duration(-toint) * time.Hour)
-			data, _ := QueryHelperFor24HourUnreported(from, to, rawDataCollection)
+			data, _ := QueryHelperFor24HourUnreported(ctx, from, to, rawDataCollection)
 			hourFormat := to.Format("15:04:05")
 			temp := models.Last24HourUnreportedSpecificData{
 				Time:    hourFormat,
@@ -515,7 +493,7 @@ func (db *batteryRepository) GetLast24hoursUnreportedData() ([]models.Last24Hour
 	return batteryData, nil
 }
 
-func QueryHelperFor24HourUnreported(from, to time.Time, rawDataCollection *mongo.Collection) ([]bson.M, error) {
+func QueryHelperFor24HourUnreported(ctx context.Context, from, to time.Time, rawDataCollection *mongo.Collection) ([]bson.M, error) {
 
 	filter := []bson.M{
 		{
@@ -536,37 +514,31 @@ func QueryHelperFor24HourUnreported(from, to time.Time, rawDataCollection *mongo
 		},
 	}
 
-	cursor, curErr := rawDataCollection.Aggregate(context.TODO(), filter)
+	cursor, curErr := rawDataCollection.Aggregate(ctx, filter)
 	if curErr != nil {
 		return nil, curErr
 	}
 
 	var bdata []bson.M
 
-	if err := cursor.All(context.TODO(), &bdata); err != nil {
+	if err := cursor.All(ctx, &bdata); err != nil {
 		return nil, err
 	}
 
 	return bdata, nil
 }
 
-func (db *batteryRepository) GetBatteryCount() (int64, error) {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) GetBatteryCount(ctx context.Context) (int64, error) {
 	return db.batteryMainConnection.EstimatedDocumentCount(ctx)
 }
 
-func (db *batteryRepository) InsertLast24HourUnreported(data models.Last24HourUnreported) error {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) InsertLast24HourUnreported(ctx context.Context, data models.Last24HourUnreported) error {
 
 	_, err := db.battery24HourUnreportedCollection.InsertOne(ctx, data)
 	return err
 }
 
-func (db *batteryRepository) DeleteAllLast24HourUnreported() error {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) DeleteAllLast24HourUnreported(ctx context.Context) error {
 
 	_, err := db.battery24HourUnreportedCollection.DeleteMany(ctx, bson.M{})
 	return err
@@ -575,29 +547,24 @@ func (db *batteryRepository) DeleteAllLast24HourUnreported() error {
 // charging reports
 
 // check charging cycle already started for bmsID
-func (db *batteryRepository) CheckChargingCycleStartOrNot(bmsId string) models.StartChargingReport {
+func (db *batteryRepository) CheckChargingCycleStartOrNot(ctx context.Context, bmsId string) models.StartChargingReport {
 	filter := bson.D{
 		bson.E{Key: "bms_id", Value: bmsId},
 	}
 
-	ctx, cancel := db.Init()
-	defer cancel()
 	var startChargingReport models.StartChargingReport
 	db.chargingReportTempCollection.FindOne(ctx, filter).Decode(&startChargingReport)
 	return startChargingReport
 }
 
 // get all end cycle from temp
-func (db *batteryRepository) GetCurrentCycleEnd() ([]models.ChargingReport, error) {
+func (db *batteryRepository) GetCurrentCycleEnd(ctx context.Context) ([]models.ChargingReport, error) {
 
 	filter := bson.D{
 		bson.E{Key: "is_start", Value: true},
 		bson.E{Key: "is_end", Value: true},
 	}
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	cursor, curErr := db.chargingReportTempCollection.Find(ctx, filter)
 
 	if curErr != nil {
@@ -606,7 +573,7 @@ func (db *batteryRepository) GetCurrentCycleEnd() ([]models.ChargingReport, erro
 
 	var chargingReports []models.ChargingReport
 
-	if err := cursor.All(context.TODO(), &chargingReports); err != nil {
+	if err := cursor.All(ctx, &chargingReports); err != nil {
 		return nil, err
 	}
 
@@ -614,7 +581,7 @@ func (db *batteryRepository) GetCurrentCycleEnd() ([]models.ChargingReport, erro
 }
 
 // making a start charging report
-func (db *batteryRepository) StartChargingReport(batteryData []models.StartChargingReport) error {
+func (db *batteryRepository) StartChargingReport(ctx context.Context, batteryData []models.StartChargingReport) error {
 	var operations []mongo.WriteModel
 
 	for i := range batteryData {
@@ -643,14 +610,12 @@ func (db *batteryRepository) StartChargingReport(batteryData []models.StartCharg
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	_, err := db.chargingReportTempCollection.BulkWrite(context.TODO(), operations)
+	_, err := db.chargingReportTempCollection.BulkWrite(ctx, operations)
 	return err
 }
 
 // making a end charging report
-func (db *batteryRepository) EndChargingReport(batteryData []models.EndChargingReport) error {
-	ctx, cancel := db.Init()
-	defer cancel()
+func (db *batteryRepository) EndChargingReport(ctx context.Context, batteryData []models.EndChargingReport) error {
 
 	operation := []mongo.WriteModel{}
 
@@ -683,22 +648,19 @@ func (db *batteryRepository) EndChargingReport(batteryData []models.EndChargingR
 }
 
 // delete all charging temp report
-func (db *batteryRepository) DeleteChargingTempReport(bmsIDs []string) error {
+func (db *batteryRepository) DeleteChargingTempReport(ctx context.Context, bmsIDs []string) error {
 	filter := bson.D{
 		bson.E{Key: "bms_id", Value: bson.D{
 			bson.E{Key: "$in", Value: bmsIDs},
 		}},
 	}
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	_, err := db.chargingReportTempCollection.DeleteMany(ctx, filter)
 	return err
 }
 
 // create a charging report history after complete one cycle temp to history
-func (db *batteryRepository) CreateChargingReportHistory(batteryData []models.ChargingReport) error {
+func (db *batteryRepository) CreateChargingReportHistory(ctx context.Context, batteryData []models.ChargingReport) error {
 	operation := []mongo.WriteModel{}
 
 	for i := range batteryData {
@@ -712,15 +674,12 @@ func (db *batteryRepository) CreateChargingReportHistory(batteryData []models.Ch
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	_, err := db.chargingReportHistoryCollection.BulkWrite(ctx, operation)
 	return err
 }
 
 // update old battery current in battery main to refer a start or end cycle
-func (db *batteryRepository) UpdateBatteryCurrentInMain(oldCurrentData []models.UpdateOldCurrent) error {
+func (db *batteryRepository) UpdateBatteryCurrentInMain(ctx context.Context, oldCurrentData []models.UpdateOldCurrent) error {
 	operation := []mongo.WriteModel{}
 
 	for i := range oldCurrentData {
@@ -746,10 +705,60 @@ func (db *batteryRepository) UpdateBatteryCurrentInMain(oldCurrentData []models.
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	ctx, cancel := db.Init()
-	defer cancel()
-
 	_, err := db.batteryMainConnection.BulkWrite(ctx, operation)
 
 	return err
 }
+
+func (db *batteryRepository) GetBatteryByBmsID(ctx context.Context, bmsID string) (models.BatteryHardwareMain, error) {
+	battery := models.BatteryHardwareMain{}
+	err := db.batteryMainConnection.FindOne(ctx, bson.D{bson.E{Key: "bms_id", Value: bmsID}}).Decode(&battery)
+	return battery, err
+}
+
+func (db *batteryRepository) GetChargingReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.ChargingReport, int64, error) {
+	query := batteryReportQuery(filter, "start_time")
+
+	reports := []models.ChargingReport{}
+	total, err := findPage(ctx, db.chargingReportHistoryCollection, query, page, &reports)
+	return reports, total, err
+}
+
+func (db *batteryRepository) GetCycleReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.CreateCycleBasedReport, int64, error) {
+	query := batteryReportQuery(filter, "start_time")
+
+	reports := []models.CreateCycleBasedReport{}
+	total, err := findPage(ctx, db.batteryCycleHistoryCollection, query, page, &reports)
+	return reports, total, err
+}
+
+func (db *batteryRepository) GetLast24HourUnreported(ctx context.Context) ([]models.Last24HourUnreported, error) {
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "utc_time", Value: 1}})
+
+	cursor, err := db.battery24HourUnreportedCollection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	unreported := []models.Last24HourUnreported{}
+	if err := cursor.All(ctx, &unreported); err != nil {
+		return nil, err
+	}
+	return unreported, nil
+}
+
+func batteryReportQuery(filter models.ReportFilter, timeField string) bson.D {
+	query := bson.D{}
+	if match := subjectMatch(filter.SubjectId, filter.SubjectIds); match != nil {
+		query = append(query, bson.E{Key: "bms_id", Value: match})
+	}
+	return timeRange(query, timeField, filter)
+}
+
+func (db *batteryRepository) GetScopeBmsIds(ctx context.Context, scope models.Scope) ([]string, error) {
+	values, err := db.batteryMainConnection.Distinct(ctx, "bms_id", scopeQuery(scope))
+	if err != nil {
+		return nil, err
+	}
+	return distinctStrings(values), nil
+}
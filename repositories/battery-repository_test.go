@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/models"
+)
+
+func TestBatteryRepositoryCounts(t *testing.T) {
+	database := testDatabase(t)
+	batteries := NewBatteryRepository(database, nil)
+	vehicles := NewVehicleRepository(database, nil, nil, helper.GPSFilter{})
+	ctx := context.Background()
+
+	// battery_main is written by the vehicle repository and read here
+	err := vehicles.AddBatteryToMain(ctx, []models.BatteryHardwareMain{{BmsID: "BMS1"}, {BmsID: "BMS2"}, {BmsID: "BMS1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := batteries.GetBatteryCount(ctx); err != nil || count != 2 {
+		t.Fatalf("battery count = %d, %v, want 2", count, err)
+	}
+
+	for _, unreported := range []int64{3, 5} {
+		row := models.LastSevenHourUnreported{UnreportedCount: unreported}
+		if err := batteries.InsertLastSevenHourUnreported(ctx, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := batteries.GetLastSevenHourUnreported(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].UnreportedCount+rows[1].UnreportedCount != 8 {
+		t.Fatalf("unreported rows = %+v, want 3 and 5", rows)
+	}
+
+	if err := batteries.DeleteLastSevenHourUnreported(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := batteries.GetLastSevenHourUnreported(ctx); err != nil || len(rows) != 0 {
+		t.Fatalf("rows after delete = %+v, %v", rows, err)
+	}
+}
@@ -0,0 +1,23 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/aniket0951/testproject/logger"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// logBulkWrite logs the counts of a bulk write at debug level, res is nil
+// when the write failed and the caller reports the error
+func logBulkWrite(ctx context.Context, message string, res *mongo.BulkWriteResult) {
+	if res == nil {
+		return
+	}
+	logger.From(ctx).WithFields(logger.Fields{
+		"inserted": res.InsertedCount,
+		"matched":  res.MatchedCount,
+		"modified": res.ModifiedCount,
+		"upserted": res.UpsertedCount,
+		"deleted":  res.DeletedCount,
+	}).Debug(message)
+}
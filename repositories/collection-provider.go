@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CollectionProvider hands out collections by name. *mongo.Database satisfies
+// it, so production passes dbconfig.ResolveDatabase() while tests pass a
+// database on a throwaway mongod. Collection returns a concrete
+// *mongo.Collection, so the repositories always need a real mongod.
+type CollectionProvider interface {
+	Collection(name string, opts ...*options.CollectionOptions) *mongo.Collection
+}
+
+// TelematicsProvider hands out the telematics database, connecting lazily and
+// reconnecting when the pool went bad. dbconfig.ManagedClient satisfies it.
+type TelematicsProvider interface {
+	Database(ctx context.Context) (*mongo.Database, error)
+}
@@ -0,0 +1,191 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GeofenceRepository interface {
+	EnsureIndexes(ctx context.Context) error
+
+	CreateGeofence(ctx context.Context, fence *models.Geofence) error
+	GetGeofences(ctx context.Context) ([]models.Geofence, error)
+	GetEnabledGeofences(ctx context.Context) ([]models.Geofence, error)
+	DeleteGeofence(ctx context.Context, fenceId primitive.ObjectID) error
+
+	GetStates(ctx context.Context, subjectType string) ([]models.GeofenceState, error)
+	SaveStates(ctx context.Context, states []models.GeofenceState) error
+
+	AddEvents(ctx context.Context, events []models.GeofenceEvent) error
+	GetEvents(ctx context.Context, subjectType, subjectId string, from, to time.Time) ([]models.GeofenceEvent, error)
+}
+
+type geofencerepository struct {
+	geofenceCollection      *mongo.Collection
+	geofenceStateCollection *mongo.Collection
+	geofenceEventCollection *mongo.Collection
+}
+
+func NewGeofenceRepository(db CollectionProvider) GeofenceRepository {
+	return &geofencerepository{
+		geofenceCollection:      db.Collection("geofences"),
+		geofenceStateCollection: db.Collection("geofence_states"),
+		geofenceEventCollection: db.Collection("geofence_events"),
+	}
+}
+
+func (db *geofencerepository) EnsureIndexes(ctx context.Context) error {
+	_, err := db.geofenceStateCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "geofence_id", Value: 1},
+			bson.E{Key: "subject_type", Value: 1},
+			bson.E{Key: "subject_id", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.geofenceEventCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "subject_type", Value: 1},
+			bson.E{Key: "subject_id", Value: 1},
+			bson.E{Key: "time", Value: -1},
+		},
+	})
+	return err
+}
+
+func (db *geofencerepository) CreateGeofence(ctx context.Context, fence *models.Geofence) error {
+	fence.Id = primitive.NewObjectID()
+	fence.CreatedAt = time.Now().UTC()
+	fence.UpdatedAt = fence.CreatedAt
+
+	_, err := db.geofenceCollection.InsertOne(ctx, fence)
+	return err
+}
+
+func (db *geofencerepository) GetGeofences(ctx context.Context) ([]models.Geofence, error) {
+	return db.findGeofences(ctx, bson.D{})
+}
+
+func (db *geofencerepository) GetEnabledGeofences(ctx context.Context) ([]models.Geofence, error) {
+	return db.findGeofences(ctx, bson.D{bson.E{Key: "enabled", Value: true}})
+}
+
+func (db *geofencerepository) findGeofences(ctx context.Context, filter bson.D) ([]models.Geofence, error) {
+	cursor, err := db.geofenceCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	fences := []models.Geofence{}
+	if err := cursor.All(ctx, &fences); err != nil {
+		return nil, err
+	}
+	return fences, nil
+}
+
+// DeleteGeofence removes the geofence together with its states, the events
+// stay as history
+func (db *geofencerepository) DeleteGeofence(ctx context.Context, fenceId primitive.ObjectID) error {
+	res, err := db.geofenceCollection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: fenceId}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	_, err = db.geofenceStateCollection.DeleteMany(ctx, bson.D{bson.E{Key: "geofence_id", Value: fenceId}})
+	return err
+}
+
+func (db *geofencerepository) GetStates(ctx context.Context, subjectType string) ([]models.GeofenceState, error) {
+	cursor, err := db.geofenceStateCollection.Find(ctx, bson.D{bson.E{Key: "subject_type", Value: subjectType}})
+	if err != nil {
+		return nil, err
+	}
+
+	states := []models.GeofenceState{}
+	if err := cursor.All(ctx, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (db *geofencerepository) SaveStates(ctx context.Context, states []models.GeofenceState) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	var operations []mongo.WriteModel
+	for i := range states {
+		states[i].UpdatedAt = time.Now().UTC()
+
+		operation := mongo.NewUpdateOneModel()
+		operation.SetFilter(bson.D{
+			bson.E{Key: "geofence_id", Value: states[i].GeofenceId},
+			bson.E{Key: "subject_type", Value: states[i].SubjectType},
+			bson.E{Key: "subject_id", Value: states[i].SubjectId},
+		})
+		operation.SetUpdate(bson.D{
+			bson.E{Key: "$set", Value: bson.D{
+				bson.E{Key: "inside", Value: states[i].Inside},
+				bson.E{Key: "entered_at", Value: states[i].EnteredAt},
+				bson.E{Key: "dwell_reported", Value: states[i].DwellReported},
+				bson.E{Key: "updated_at", Value: states[i].UpdatedAt},
+			}},
+		})
+		operation.SetUpsert(true)
+		operations = append(operations, operation)
+	}
+
+	_, err := db.geofenceStateCollection.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (db *geofencerepository) AddEvents(ctx context.Context, events []models.GeofenceEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(events))
+	for i := range events {
+		events[i].CreatedAt = time.Now().UTC()
+		docs[i] = events[i]
+	}
+
+	_, err := db.geofenceEventCollection.InsertMany(ctx, docs)
+	return err
+}
+
+func (db *geofencerepository) GetEvents(ctx context.Context, subjectType, subjectId string, from, to time.Time) ([]models.GeofenceEvent, error) {
+	filter := bson.D{
+		bson.E{Key: "subject_type", Value: subjectType},
+		bson.E{Key: "subject_id", Value: subjectId},
+		bson.E{Key: "time", Value: bson.D{
+			bson.E{Key: "$gte", Value: from},
+			bson.E{Key: "$lte", Value: to},
+		}},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "time", Value: -1}})
+
+	cursor, err := db.geofenceEventCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.GeofenceEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
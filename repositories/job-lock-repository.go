@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type JobLockRepository interface {
+	EnsureIndexes(ctx context.Context) error
+
+	// AcquireJobLock takes the lease when it is free or expired and renews it
+	// when owner already holds it. It returns false while someone else does.
+	AcquireJobLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// ReleaseJobLock gives the lease up if owner still holds it
+	ReleaseJobLock(ctx context.Context, name, owner string) error
+	GetJobLock(ctx context.Context, name string) (models.JobLock, error)
+}
+
+type joblockrepository struct {
+	jobLockCollection *mongo.Collection
+}
+
+func NewJobLockRepository(db CollectionProvider) JobLockRepository {
+	return &joblockrepository{
+		jobLockCollection: db.Collection("job_locks"),
+	}
+}
+
+// EnsureIndexes lets mongo clean up leases nobody renews
+func (db *joblockrepository) EnsureIndexes(ctx context.Context) error {
+	_, err := db.jobLockCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (db *joblockrepository) AcquireJobLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.D{
+		bson.E{Key: "_id", Value: name},
+		bson.E{Key: "$or", Value: bson.A{
+			bson.D{bson.E{Key: "owner", Value: owner}},
+			bson.D{bson.E{Key: "expires_at", Value: bson.D{bson.E{Key: "$lte", Value: now}}}},
+		}},
+	}
+	update := bson.D{bson.E{Key: "$set", Value: bson.D{
+		bson.E{Key: "owner", Value: owner},
+		bson.E{Key: "heartbeat_at", Value: now},
+		bson.E{Key: "expires_at", Value: now.Add(ttl)},
+	}}}
+
+	// a lease held by someone else doesn't match, so the upsert runs into
+	// the existing _id
+	_, err := db.jobLockCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (db *joblockrepository) ReleaseJobLock(ctx context.Context, name, owner string) error {
+	filter := bson.D{
+		bson.E{Key: "_id", Value: name},
+		bson.E{Key: "owner", Value: owner},
+	}
+	_, err := db.jobLockCollection.DeleteOne(ctx, filter)
+	return err
+}
+
+func (db *joblockrepository) GetJobLock(ctx context.Context, name string) (models.JobLock, error) {
+	lock := models.JobLock{}
+	err := db.jobLockCollection.FindOne(ctx, bson.D{bson.E{Key: "_id", Value: name}}).Decode(&lock)
+	return lock, err
+}
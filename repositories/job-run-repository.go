@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongo error codes for an index that exists with other options and for
+// dropping one that doesn't exist
+const (
+	indexOptionsConflictCode = 85
+	indexNotFoundCode        = 27
+)
+
+const jobRunExpiryIndex = "ended_at_ttl"
+
+type JobRunRepository interface {
+	// EnsureIndexes also expires finished runs older than retention,
+	// 0 keeps them forever
+	EnsureIndexes(ctx context.Context, retention time.Duration) error
+
+	AddJobRun(ctx context.Context, run *models.JobRun) error
+	// SaveJobRun replaces the run, or inserts it when AddJobRun failed
+	SaveJobRun(ctx context.Context, run *models.JobRun) error
+	GetJobRuns(ctx context.Context, filter models.JobRunFilter, page models.PageRequest) ([]models.JobRun, int64, error)
+	// GetLastJobRun returns the latest finished run of a job, a zero run
+	// when it never finished one
+	GetLastJobRun(ctx context.Context, job string) (models.JobRun, error)
+}
+
+type jobrunrepository struct {
+	jobRunCollection *mongo.Collection
+}
+
+func NewJobRunRepository(db CollectionProvider) JobRunRepository {
+	return &jobrunrepository{
+		jobRunCollection: db.Collection("job_runs"),
+	}
+}
+
+func (db *jobrunrepository) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := db.jobRunCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "job", Value: 1},
+			bson.E{Key: "started_at", Value: -1},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return db.ensureExpiry(ctx, retention)
+}
+
+// ensureExpiry keeps the ttl index on ended_at in line with retention, runs
+// still going have no ended_at and are never expired
+func (db *jobrunrepository) ensureExpiry(ctx context.Context, retention time.Duration) error {
+	var cmdErr mongo.CommandError
+	if retention <= 0 {
+		_, err := db.jobRunCollection.Indexes().DropOne(ctx, jobRunExpiryIndex)
+		if errors.As(err, &cmdErr) && cmdErr.Code == indexNotFoundCode {
+			return nil
+		}
+		return err
+	}
+
+	seconds := int32(retention.Seconds())
+	_, err := db.jobRunCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "ended_at", Value: 1}},
+		Options: options.Index().SetName(jobRunExpiryIndex).SetExpireAfterSeconds(seconds),
+	})
+	if !errors.As(err, &cmdErr) || cmdErr.Code != indexOptionsConflictCode {
+		return err
+	}
+
+	// the retention changed since the index was created
+	return db.jobRunCollection.Database().RunCommand(ctx, bson.D{
+		bson.E{Key: "collMod", Value: db.jobRunCollection.Name()},
+		bson.E{Key: "index", Value: bson.D{
+			bson.E{Key: "name", Value: jobRunExpiryIndex},
+			bson.E{Key: "expireAfterSeconds", Value: seconds},
+		}},
+	}).Err()
+}
+
+func (db *jobrunrepository) AddJobRun(ctx context.Context, run *models.JobRun) error {
+	run.Id = primitive.NewObjectID()
+	_, err := db.jobRunCollection.InsertOne(ctx, run)
+	return err
+}
+
+func (db *jobrunrepository) SaveJobRun(ctx context.Context, run *models.JobRun) error {
+	_, err := db.jobRunCollection.ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: run.Id}}, run, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (db *jobrunrepository) GetJobRuns(ctx context.Context, filter models.JobRunFilter, page models.PageRequest) ([]models.JobRun, int64, error) {
+	query := bson.D{}
+	if filter.Job != "" {
+		query = append(query, bson.E{Key: "job", Value: filter.Job})
+	}
+	if filter.Status != "" {
+		query = append(query, bson.E{Key: "status", Value: filter.Status})
+	}
+	query = timeRange(query, "started_at", models.ReportFilter{From: filter.From, To: filter.To})
+
+	runs := []models.JobRun{}
+	total, err := findPage(ctx, db.jobRunCollection, query, page, &runs)
+	return runs, total, err
+}
+
+func (db *jobrunrepository) GetLastJobRun(ctx context.Context, job string) (models.JobRun, error) {
+	filter := bson.D{
+		bson.E{Key: "job", Value: job},
+		bson.E{Key: "status", Value: bson.D{bson.E{Key: "$ne", Value: models.JobRunRunning}}},
+	}
+	opts := options.FindOne().SetSort(bson.D{bson.E{Key: "started_at", Value: -1}})
+
+	run := models.JobRun{}
+	err := db.jobRunCollection.FindOne(ctx, filter, opts).Decode(&run)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.JobRun{}, nil
+	}
+	return run, err
+}
@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type JobStateRepository interface {
+	// GetJobState returns the state of a job, a job nobody changed yet
+	// isn't paused
+	GetJobState(ctx context.Context, name string) (models.JobState, error)
+	SetJobPaused(ctx context.Context, name string, paused bool) error
+}
+
+type jobstaterepository struct {
+	jobStateCollection *mongo.Collection
+}
+
+func NewJobStateRepository(db CollectionProvider) JobStateRepository {
+	return &jobstaterepository{
+		jobStateCollection: db.Collection("job_states"),
+	}
+}
+
+func (db *jobstaterepository) GetJobState(ctx context.Context, name string) (models.JobState, error) {
+	state := models.JobState{}
+	err := db.jobStateCollection.FindOne(ctx, bson.D{bson.E{Key: "_id", Value: name}}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.JobState{Name: name}, nil
+	}
+	return state, err
+}
+
+func (db *jobstaterepository) SetJobPaused(ctx context.Context, name string, paused bool) error {
+	update := bson.D{bson.E{Key: "$set", Value: bson.D{
+		bson.E{Key: "paused", Value: paused},
+		bson.E{Key: "updated_at", Value: time.Now().UTC()},
+	}}}
+	_, err := db.jobStateCollection.UpdateOne(ctx, bson.D{bson.E{Key: "_id", Value: name}}, update, options.Update().SetUpsert(true))
+	return err
+}
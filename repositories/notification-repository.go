@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NotificationRepository interface {
+	EnsureIndexes(ctx context.Context) error
+
+	AddNotifications(ctx context.Context, notifications []models.Notification) error
+	// GetDueNotifications returns pending notifications whose next attempt is due, oldest first
+	GetDueNotifications(ctx context.Context, now time.Time, limit int64) ([]models.Notification, error)
+	SaveNotification(ctx context.Context, notification *models.Notification) error
+}
+
+type notificationrepository struct {
+	outboxCollection *mongo.Collection
+}
+
+func NewNotificationRepository(db CollectionProvider) NotificationRepository {
+	return &notificationrepository{
+		outboxCollection: db.Collection("notification_outbox"),
+	}
+}
+
+func (db *notificationrepository) EnsureIndexes(ctx context.Context) error {
+	_, err := db.outboxCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "status", Value: 1},
+			bson.E{Key: "next_attempt_at", Value: 1},
+		},
+	})
+	return err
+}
+
+func (db *notificationrepository) AddNotifications(ctx context.Context, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(notifications))
+	for i := range notifications {
+		notifications[i].Id = primitive.NewObjectID()
+		notifications[i].CreatedAt = time.Now().UTC()
+		notifications[i].UpdatedAt = notifications[i].CreatedAt
+		docs[i] = notifications[i]
+	}
+
+	_, err := db.outboxCollection.InsertMany(ctx, docs)
+	return err
+}
+
+func (db *notificationrepository) GetDueNotifications(ctx context.Context, now time.Time, limit int64) ([]models.Notification, error) {
+	filter := bson.D{
+		bson.E{Key: "status", Value: models.NotificationPending},
+		bson.E{Key: "next_attempt_at", Value: bson.D{bson.E{Key: "$lte", Value: now}}},
+	}
+	opts := options.Find().
+		SetSort(bson.D{bson.E{Key: "next_attempt_at", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := db.outboxCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (db *notificationrepository) SaveNotification(ctx context.Context, notification *models.Notification) error {
+	notification.UpdatedAt = time.Now().UTC()
+
+	_, err := db.outboxCollection.ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: notification.Id}}, notification)
+	return err
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// findPage counts the matches of filter and decodes the requested page of
+// them into results, which has to be a pointer to a slice
+func findPage(ctx context.Context, collection *mongo.Collection, filter interface{}, page models.PageRequest, results interface{}) (int64, error) {
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := options.Find().SetSkip(page.Skip()).SetLimit(page.Limit)
+	if page.Sort != "" {
+		order := 1
+		if page.SortDesc {
+			order = -1
+		}
+		// _id keeps the order stable between pages when the sort field ties
+		opts.SetSort(bson.D{bson.E{Key: page.Sort, Value: order}, bson.E{Key: "_id", Value: order}})
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	return total, cursor.All(ctx, results)
+}
+
+// timeRange appends a $gte/$lte condition on field for the set bounds
+func timeRange(filter bson.D, field string, report models.ReportFilter) bson.D {
+	bounds := bson.D{}
+	if !report.From.IsZero() {
+		bounds = append(bounds, bson.E{Key: "$gte", Value: report.From})
+	}
+	if !report.To.IsZero() {
+		bounds = append(bounds, bson.E{Key: "$lte", Value: report.To})
+	}
+	if len(bounds) > 0 {
+		filter = append(filter, bson.E{Key: field, Value: bounds})
+	}
+	return filter
+}
+
+// subjectMatch is the value that matches a single requested subject within
+// the allowed ones, nil when neither is set. A subject outside allowed
+// matches nothing.
+func subjectMatch(subjectId string, allowed []string) interface{} {
+	if allowed == nil {
+		if subjectId == "" {
+			return nil
+		}
+		return subjectId
+	}
+	if subjectId == "" {
+		return bson.D{bson.E{Key: "$in", Value: allowed}}
+	}
+	for _, id := range allowed {
+		if id == subjectId {
+			return subjectId
+		}
+	}
+	return bson.D{bson.E{Key: "$in", Value: bson.A{}}}
+}
+
+// scopeQuery matches the documents of the scope's company and branch
+func scopeQuery(scope models.Scope) bson.D {
+	query := bson.D{}
+	if scope.Company != "" {
+		query = append(query, bson.E{Key: "company", Value: scope.Company})
+	}
+	if scope.Branch != "" {
+		query = append(query, bson.E{Key: "branch", Value: scope.Branch})
+	}
+	return query
+}
+
+func distinctStrings(values []interface{}) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok && s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
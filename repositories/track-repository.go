@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const VehicleTrackCollection = "vehicle_tracks"
+
+// mongo error code for "collection already exists"
+const namespaceExistsCode = 48
+
+type TrackRepository interface {
+	InsertTrackPoints(ctx context.Context, points []models.VehicleTrackPoint) error
+	// GetVehicleTrack returns the fixes of vehicleNo in [from, to] oldest first,
+	// with interval > 0 only the first fix of every interval bucket is kept
+	GetVehicleTrack(ctx context.Context, vehicleNo string, from, to time.Time, interval time.Duration) ([]models.VehicleTrackPoint, error)
+}
+
+type trackrepository struct {
+	trackCollection *mongo.Collection
+}
+
+func NewTrackRepository(db CollectionProvider) TrackRepository {
+	return &trackrepository{
+		trackCollection: db.Collection(VehicleTrackCollection),
+	}
+}
+
+// EnsureVehicleTrackCollection creates vehicle_tracks as a time-series
+// collection (MongoDB 5.0+), fixes older than retention are expired by mongo.
+// An existing collection is left as it is.
+func EnsureVehicleTrackCollection(ctx context.Context, db *mongo.Database, retention time.Duration) error {
+	timeSeries := options.TimeSeries().
+		SetTimeField("time").
+		SetMetaField("vehicle_no").
+		SetGranularity("minutes")
+
+	opts := options.CreateCollection().SetTimeSeriesOptions(timeSeries)
+	if retention > 0 {
+		opts.SetExpireAfterSeconds(int64(retention.Seconds()))
+	}
+
+	err := db.CreateCollection(ctx, VehicleTrackCollection, opts)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceExistsCode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(VehicleTrackCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "vehicle_no", Value: 1},
+			bson.E{Key: "time", Value: 1},
+		},
+	})
+	return err
+}
+
+func (db *trackrepository) InsertTrackPoints(ctx context.Context, points []models.VehicleTrackPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(points))
+	for i := range points {
+		docs[i] = points[i]
+	}
+
+	// one bad point must not drop the rest of the batch
+	_, err := db.trackCollection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+func (db *trackrepository) GetVehicleTrack(ctx context.Context, vehicleNo string, from, to time.Time, interval time.Duration) ([]models.VehicleTrackPoint, error) {
+	match := bson.D{
+		bson.E{Key: "vehicle_no", Value: vehicleNo},
+		bson.E{Key: "time", Value: bson.D{
+			bson.E{Key: "$gte", Value: from},
+			bson.E{Key: "$lte", Value: to},
+		}},
+	}
+
+	points := []models.VehicleTrackPoint{}
+
+	if interval < time.Second {
+		opts := options.Find().SetSort(bson.D{bson.E{Key: "time", Value: 1}})
+		cursor, err := db.trackCollection.Find(ctx, match, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(ctx, &points); err != nil {
+			return nil, err
+		}
+		return points, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{bson.E{Key: "$match", Value: match}},
+		bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "time", Value: 1}}}},
+		bson.D{bson.E{Key: "$group", Value: bson.D{
+			bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$dateTrunc", Value: bson.D{
+				bson.E{Key: "date", Value: "$time"},
+				bson.E{Key: "unit", Value: "second"},
+				bson.E{Key: "binSize", Value: int64(interval.Seconds())},
+			}}}},
+			bson.E{Key: "point", Value: bson.D{bson.E{Key: "$first", Value: "$$ROOT"}}},
+		}}},
+		bson.D{bson.E{Key: "$replaceRoot", Value: bson.D{bson.E{Key: "newRoot", Value: "$point"}}}},
+		bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "time", Value: 1}}}},
+	}
+
+	cursor, err := db.trackCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
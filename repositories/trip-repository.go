@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TripRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	GetOpenTrips(ctx context.Context) ([]models.VehicleTrip, error)
+	SaveTrip(ctx context.Context, trip *models.VehicleTrip) error
+	DeleteTrip(ctx context.Context, tripId primitive.ObjectID) error
+	IncrementOpenTripAlerts(ctx context.Context, vehicleNo string) error
+	// GetTrips returns the trips of vehicleNo that overlap [from, to], newest first
+	GetTrips(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleTrip, error)
+}
+
+type triprepository struct {
+	tripCollection *mongo.Collection
+}
+
+func NewTripRepository(db CollectionProvider) TripRepository {
+	return &triprepository{
+		tripCollection: db.Collection("vehicle_trips"),
+	}
+}
+
+func (db *triprepository) EnsureIndexes(ctx context.Context) error {
+	_, err := db.tripCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				bson.E{Key: "vehicle_no", Value: 1},
+				bson.E{Key: "start_time", Value: -1},
+			},
+		},
+		{
+			// a vehicle has at most one open trip
+			Keys: bson.D{bson.E{Key: "vehicle_no", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{bson.E{Key: "status", Value: models.TripStatusOpen}}),
+		},
+	})
+	return err
+}
+
+func (db *triprepository) GetOpenTrips(ctx context.Context) ([]models.VehicleTrip, error) {
+	filter := bson.D{
+		bson.E{Key: "status", Value: models.TripStatusOpen},
+	}
+
+	cursor, err := db.tripCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	trips := []models.VehicleTrip{}
+	if err := cursor.All(ctx, &trips); err != nil {
+		return nil, err
+	}
+	return trips, nil
+}
+
+// SaveTrip inserts a new trip or replaces the stored one
+func (db *triprepository) SaveTrip(ctx context.Context, trip *models.VehicleTrip) error {
+	trip.UpdatedAt = time.Now().UTC()
+
+	if trip.Id.IsZero() {
+		trip.Id = primitive.NewObjectID()
+		trip.CreatedAt = trip.UpdatedAt
+		_, err := db.tripCollection.InsertOne(ctx, trip)
+		return err
+	}
+
+	filter := bson.D{
+		bson.E{Key: "_id", Value: trip.Id},
+	}
+	_, err := db.tripCollection.ReplaceOne(ctx, filter, trip)
+	return err
+}
+
+func (db *triprepository) DeleteTrip(ctx context.Context, tripId primitive.ObjectID) error {
+	filter := bson.D{
+		bson.E{Key: "_id", Value: tripId},
+	}
+	_, err := db.tripCollection.DeleteOne(ctx, filter)
+	return err
+}
+
+func (db *triprepository) IncrementOpenTripAlerts(ctx context.Context, vehicleNo string) error {
+	filter := bson.D{
+		bson.E{Key: "vehicle_no", Value: vehicleNo},
+		bson.E{Key: "status", Value: models.TripStatusOpen},
+	}
+	update := bson.D{
+		bson.E{Key: "$inc", Value: bson.D{bson.E{Key: "alert_count", Value: 1}}},
+	}
+
+	_, err := db.tripCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (db *triprepository) GetTrips(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleTrip, error) {
+	filter := bson.D{
+		bson.E{Key: "vehicle_no", Value: vehicleNo},
+		bson.E{Key: "start_time", Value: bson.D{bson.E{Key: "$lte", Value: to}}},
+		bson.E{Key: "$or", Value: bson.A{
+			bson.D{bson.E{Key: "end_time", Value: bson.D{bson.E{Key: "$gte", Value: from}}}},
+			bson.D{bson.E{Key: "status", Value: models.TripStatusOpen}},
+		}},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "start_time", Value: -1}})
+
+	cursor, err := db.tripCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	trips := []models.VehicleTrip{}
+	if err := cursor.All(ctx, &trips); err != nil {
+		return nil, err
+	}
+	return trips, nil
+}
@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UserRepository interface {
+	EnsureIndexes(ctx context.Context) error
+
+	// AddUser inserts the user, a taken email fails with a mongo duplicate
+	// key error
+	AddUser(ctx context.Context, user *models.User) error
+	SaveUser(ctx context.Context, user *models.User) error
+	GetUserById(ctx context.Context, userId primitive.ObjectID) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	GetUserByResetToken(ctx context.Context, tokenHash string) (models.User, error)
+	ListUsers(ctx context.Context, page models.PageRequest) ([]models.User, int64, error)
+	CountUsers(ctx context.Context) (int64, error)
+}
+
+type userrepository struct {
+	userCollection *mongo.Collection
+}
+
+func NewUserRepository(db CollectionProvider) UserRepository {
+	return &userrepository{
+		userCollection: db.Collection("users"),
+	}
+}
+
+func (db *userrepository) EnsureIndexes(ctx context.Context) error {
+	_, err := db.userCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{bson.E{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{bson.E{Key: "reset_token", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	return err
+}
+
+func (db *userrepository) AddUser(ctx context.Context, user *models.User) error {
+	user.Id = primitive.NewObjectID()
+	user.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	user.UpdatedAt = user.CreatedAt
+
+	_, err := db.userCollection.InsertOne(ctx, user)
+	return err
+}
+
+func (db *userrepository) SaveUser(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	filter := bson.D{bson.E{Key: "_id", Value: user.Id}}
+	_, err := db.userCollection.ReplaceOne(ctx, filter, user)
+	return err
+}
+
+func (db *userrepository) GetUserById(ctx context.Context, userId primitive.ObjectID) (models.User, error) {
+	return db.findUser(ctx, bson.D{bson.E{Key: "_id", Value: userId}})
+}
+
+func (db *userrepository) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return db.findUser(ctx, bson.D{bson.E{Key: "email", Value: email}})
+}
+
+func (db *userrepository) GetUserByResetToken(ctx context.Context, tokenHash string) (models.User, error) {
+	return db.findUser(ctx, bson.D{bson.E{Key: "reset_token", Value: tokenHash}})
+}
+
+func (db *userrepository) findUser(ctx context.Context, filter bson.D) (models.User, error) {
+	var user models.User
+	err := db.userCollection.FindOne(ctx, filter).Decode(&user)
+	return user, err
+}
+
+func (db *userrepository) ListUsers(ctx context.Context, page models.PageRequest) ([]models.User, int64, error) {
+	users := []models.User{}
+	total, err := findPage(ctx, db.userCollection, bson.D{}, page, &users)
+	return users, total, err
+}
+
+func (db *userrepository) CountUsers(ctx context.Context) (int64, error) {
+	return db.userCollection.CountDocuments(ctx, bson.D{})
+}
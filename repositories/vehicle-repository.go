@@ -2,20 +2,15 @@ package repositories
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"reflect"
+	"regexp"
 	"strconv"
 	"sync"
 	"time"
 
-	dbconfig "github.com/aniket0951/testproject/db-config"
 	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/logger"
 	"github.com/aniket0951/testproject/models"
 	"github.com/aniket0951/testproject/proxyapis"
 	"github.com/mashingan/smapping"
@@ -26,70 +21,63 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var vehicleCollection *mongo.Collection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "vehicle_info")
-var vehicleLocationCollection *mongo.Collection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "vehicles")
-var vehicleAlertCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "vehicle_alerts")
-var vehicleAlertHistoryCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "alert_history")
-var alertMasterConfigCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "alert_config")
-var vehicleFallAlertCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "vehicle_fall_alerts")
-var testCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "test_collection")
-var vehicleDistanceTravelCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "vehicle_distance_travel")
-var batteryTempCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_temp")
-var batteryMainCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_main")
-var batteryReportingCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_reporting")
-var bmsTempCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "bms_temperature_alert")
-var batteryDistanceTravelledCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_distance_travelled")
-var batteryCycleTempReportCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_cycle_temp_report")
-var batteryCycleHistoryCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_cycle_history")
-var batteryCycleLocationCollection = dbconfig.GetCollection(dbconfig.ResolveClientDB(), "battery_cycle_location")
-
-var Mclient *mongo.Client
-
 type VehicleRepository interface {
-	GetAllVehicles() ([]models.VehiclesData, error)
-	AddUpdateVehicleInformation(vehicleInfo models.VehiclesData)
-	RefreshVehicleData() ([]models.VehiclesData, error)
-	UpdateVehicleData(vehicle models.VehiclesData) error
-	AddVehicleLocationData(vehicleLocation models.VehicleLocationData)
-	GetVehicleAlertById(vehicleId string) (models.VehicleAlerts, error)
-	GetVehicleFallAlertById(vehicleId string) (models.VehicleFallAlerts, error)
-	GetOverSpeedAlerts() ([]models.VehicleAlerts, error)
-	GetAllVehicleFallAlerts() ([]models.VehicleFallAlerts, error)
-
-	TrackVehicleAlert() ([]models.VehiclesData, error)
-	UpdateVehicleAlert(vehicleData models.VehicleAlerts) error
-	UpdateVehicleFallAlert(vehicleData models.VehicleFallAlerts) error
-	CreateOverSpeedAlertHistory(vehicleAlerts []models.VehicleAlerts) error
-	CreateVehicleFallAlertHistory(vehicleAlerts []models.VehicleFallAlerts) error
-	CreateDistanceTravelHistory(vehicleData []models.VehiclesData) error
-	CreateBatteryTemperatureHistory(batteryTemperature []models.BatteryTemperatureAlert) error
-	GetBatteryTemperatureData() ([]models.BatteryTemperatureAlert, error)
+	GetAllVehicles(ctx context.Context) ([]models.VehiclesData, error)
+	AddUpdateVehicleInformation(ctx context.Context, vehicleInfo models.VehiclesData)
+	RefreshVehicleData(ctx context.Context) ([]models.VehiclesData, error)
+	UpdateVehicleData(ctx context.Context, vehicle models.VehiclesData) error
+	AddVehicleLocationData(ctx context.Context, vehicleLocation models.VehicleLocationData)
+	ListVehicles(ctx context.Context, filter models.VehicleFilter, page models.PageRequest) ([]models.VehiclesData, int64, error)
+	// GetAlertHistory lists alert_history, which mixes overspeed, fall and
+	// battery temperature documents
+	GetAlertHistory(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]bson.M, int64, error)
+	// GetScopeVehicleNumbers returns the vehicle numbers in the scope
+	GetScopeVehicleNumbers(ctx context.Context, scope models.Scope) ([]string, error)
+	AddVehicleStateEvents(ctx context.Context, events []models.VehicleStateEvent) error
+	GetVehicleStateEvents(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleStateEvent, error)
+	GetVehicleAlertById(ctx context.Context, vehicleId string) (models.VehicleAlerts, error)
+	GetVehicleFallAlertById(ctx context.Context, vehicleId string) (models.VehicleFallAlerts, error)
+	GetOverSpeedAlerts(ctx context.Context) ([]models.VehicleAlerts, error)
+	GetAllVehicleFallAlerts(ctx context.Context) ([]models.VehicleFallAlerts, error)
+
+	TrackVehicleAlert(ctx context.Context) ([]models.VehiclesData, error)
+	UpdateVehicleAlert(ctx context.Context, vehicleData models.VehicleAlerts) error
+	UpdateVehicleFallAlert(ctx context.Context, vehicleData models.VehicleFallAlerts) error
+	CreateOverSpeedAlertHistory(ctx context.Context, vehicleAlerts []models.VehicleAlerts) error
+	CreateVehicleFallAlertHistory(ctx context.Context, vehicleAlerts []models.VehicleFallAlerts) error
+	CreateDistanceTravelHistory(ctx context.Context, vehicleData []models.VehiclesData) error
+	CreateBatteryTemperatureHistory(ctx context.Context, batteryTemperature []models.BatteryTemperatureAlert) error
+	GetBatteryTemperatureData(ctx context.Context) ([]models.BatteryTemperatureAlert, error)
 
 	// ResetDistanceTravel()
-	DeleteTodayAlert(alertId primitive.ObjectID) error
-	DeleteTodayFallAlert(alertId primitive.ObjectID) error
-	DeleteBatteryTemperatureAlert(batteryTempAlert []string) error
-
-	GetAlertLimit(alertType string) (models.AlertConfig, error)
-
-	BatteryTempToMain() error
-	AddBatteryToMain(batteryData []models.BatteryHardwareMain) error
-	DeleteBatteryTempData(batteryData []string) error
-	UpdateBMSReporting(batteryData []string) error
-	UpdateBMSDistanceTravelled([]models.BatteryHardwareMain) error
+	DeleteTodayAlert(ctx context.Context, alertId primitive.ObjectID) error
+	DeleteTodayFallAlert(ctx context.Context, alertId primitive.ObjectID) error
+	DeleteBatteryTemperatureAlert(ctx context.Context, batteryTempAlert []string) error
+
+	// BatteryTempToMain moves the complete battery_temp records to battery_main
+	// and returns the records it moved
+	BatteryTempToMain(ctx context.Context) ([]models.BatteryHardwareMain, error)
+	AddBatteryToMain(ctx context.Context, batteryData []models.BatteryHardwareMain) error
+	DeleteBatteryTempData(ctx context.Context, batteryData []string) error
+	UpdateBMSReporting(ctx context.Context, batteryData []string) error
+	UpdateBMSDistanceTravelled(ctx context.Context, batteryData []models.BatteryHardwareMain) error
 
 	//battery cycle
-	CheckForBatteryCycle() ([]models.BatteryHardwareMain, error)
-	UpdateBatteryCycle(batteryData []models.BatteryHardwareMain) error
-	AddTestData() error
+	CheckForBatteryCycle(ctx context.Context) ([]models.BatteryHardwareMain, error)
+	UpdateBatteryCycle(ctx context.Context, batteryData []models.BatteryHardwareMain) error
+	AddTestData(ctx context.Context) error
 }
 
+// ErrStaleFix is returned by UpdateVehicleData when the feed sends a fix
+// older than the one already stored, the record is not written
+var ErrStaleFix = errors.New("stale gps fix")
+
 type vehiclerepository struct {
 	vehicleCollection                  *mongo.Collection
 	vehicleLocationConnection          *mongo.Collection
+	vehicleStateEventConnection        *mongo.Collection
 	vehicleAlertConnection             *mongo.Collection
 	vehicleAlertHistoryConnection      *mongo.Collection
-	alertConfigConnection              *mongo.Collection
 	vehicleFallAlertsConnection        *mongo.Collection
 	testConnection                     *mongo.Collection
 	vehicleDistanceTravelConnection    *mongo.Collection
@@ -101,68 +89,57 @@ type vehiclerepository struct {
 	batteryCycleTempReportConnection   *mongo.Collection
 	batteryCycleHistoryConnection      *mongo.Collection
 	batteryCycleLocationConnection     *mongo.Collection
+	telematics                         TelematicsProvider
+	feed                               proxyapis.FeedProvider
+	gpsFilter                          helper.GPSFilter
 }
 
-func NewVehicleRepository() VehicleRepository {
+func NewVehicleRepository(db CollectionProvider, telematics TelematicsProvider, feed proxyapis.FeedProvider, gpsFilter helper.GPSFilter) VehicleRepository {
 	return &vehiclerepository{
-		vehicleCollection:                  vehicleCollection,
-		vehicleLocationConnection:          vehicleLocationCollection,
-		vehicleAlertConnection:             vehicleAlertCollection,
-		vehicleAlertHistoryConnection:      vehicleAlertHistoryCollection,
-		alertConfigConnection:              alertMasterConfigCollection,
-		vehicleFallAlertsConnection:        vehicleFallAlertCollection,
-		testConnection:                     testCollection,
-		vehicleDistanceTravelConnection:    vehicleDistanceTravelCollection,
-		batteryTempConnection:              batteryTempCollection,
-		batteryMainConnection:              batteryMainCollection,
-		batteryReportingConnection:         batteryReportingCollection,
-		batteryTemperatureConnection:       bmsTempCollection,
-		batteryDistanceTravelledConnection: batteryDistanceTravelledCollection,
-		batteryCycleTempReportConnection:   batteryCycleTempReportCollection,
-		batteryCycleHistoryConnection:      batteryCycleHistoryCollection,
-		batteryCycleLocationConnection:     batteryCycleLocationCollection,
+		vehicleCollection:                  db.Collection("vehicle_info"),
+		vehicleLocationConnection:          db.Collection("vehicles"),
+		vehicleStateEventConnection:        db.Collection("vehicle_state_events"),
+		vehicleAlertConnection:             db.Collection("vehicle_alerts"),
+		vehicleAlertHistoryConnection:      db.Collection("alert_history"),
+		vehicleFallAlertsConnection:        db.Collection("vehicle_fall_alerts"),
+		testConnection:                     db.Collection("test_collection"),
+		vehicleDistanceTravelConnection:    db.Collection("vehicle_distance_travel"),
+		batteryTempConnection:              db.Collection("battery_temp"),
+		batteryMainConnection:              db.Collection("battery_main"),
+		batteryReportingConnection:         db.Collection("battery_reporting"),
+		batteryTemperatureConnection:       db.Collection("bms_temperature_alert"),
+		batteryDistanceTravelledConnection: db.Collection("battery_distance_travelled"),
+		batteryCycleTempReportConnection:   db.Collection("battery_cycle_temp_report"),
+		batteryCycleHistoryConnection:      db.Collection("battery_cycle_history"),
+		batteryCycleLocationConnection:     db.Collection("battery_cycle_location"),
+		telematics:                         telematics,
+		feed:                               feed,
+		gpsFilter:                          gpsFilter,
 	}
 }
 
-func (db *vehiclerepository) AddUpdateVehicleInformation(vehicleInfo models.VehiclesData) {
+func (db *vehiclerepository) AddUpdateVehicleInformation(ctx context.Context, vehicleInfo models.VehiclesData) {
 	filter := bson.D{
 		bson.E{Key: "vehicleno", Value: vehicleInfo.VehicleNo},
 	}
 	opt := options.FindOneAndReplace().SetUpsert(true)
 
-	_ = db.vehicleCollection.FindOneAndReplace(context.TODO(), filter, vehicleInfo, opt)
+	_ = db.vehicleCollection.FindOneAndReplace(ctx, filter, vehicleInfo, opt)
 
 }
 
-func (db *vehiclerepository) AddVehicleLocationData(vehicleLocation models.VehicleLocationData) {
+func (db *vehiclerepository) AddVehicleLocationData(ctx context.Context, vehicleLocation models.VehicleLocationData) {
 
-	_, _ = db.vehicleLocationConnection.InsertOne(context.Background(), vehicleLocation)
+	_, _ = db.vehicleLocationConnection.InsertOne(ctx, vehicleLocation)
 
 }
 
-func (db *vehiclerepository) RefreshVehicleData() ([]models.VehiclesData, error) {
-	reqURL := "http://fusioniot.mobilogix.com/webservice?token=getLiveData&user=skroman@mautoafrica.com&pass=Mauto@777"
-
-	requestChannel := make(chan models.AutoGenerated)
-	go proxyapis.GetAllVehicels(reqURL, requestChannel)
-	responseData := <-requestChannel
-
-	if len(responseData.Root.VehicleData) <= 1 {
-		return nil, errors.New("API time limit exceed")
-	}
-
-	var vehicleData []models.VehiclesData
-
-	for i := range responseData.Root.VehicleData {
-		temp := models.VehiclesData{}
-		_ = smapping.FillStruct(&temp, smapping.MapFields(responseData.Root.VehicleData[i]))
-		vehicleData = append(vehicleData, temp)
-	}
+func (db *vehiclerepository) RefreshVehicleData(ctx context.Context) ([]models.VehiclesData, error) {
 
-	return vehicleData, nil
+	return db.feed.FetchVehicles(ctx)
 }
 
-func (db *vehiclerepository) UpdateVehicleData(vehicle models.VehiclesData) error {
+func (db *vehiclerepository) UpdateVehicleData(ctx context.Context, vehicle models.VehiclesData) error {
 	opt := options.FindOneAndReplace().SetUpsert(true)
 
 	filter := bson.D{
@@ -170,97 +147,219 @@ func (db *vehiclerepository) UpdateVehicleData(vehicle models.VehiclesData) erro
 	}
 
 	result := models.VehiclesData{}
-	err := db.vehicleCollection.FindOne(context.TODO(), filter).Decode(&result)
+	err := db.vehicleCollection.FindOne(ctx, filter).Decode(&result)
 
-	if err != nil {
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
 		return err
 	}
 
-	if (result != models.VehiclesData{}) {
-		prevLatitude := helper.ConvertStrToFloat(result.Latitude)
-		prevLongitude := helper.ConvertStrToFloat(result.Longitude)
+	current := vehicle.TypedSnapshot()
+	createdAt := primitive.NewDateTimeFromTime(time.Now())
 
-		currentLatitude := helper.ConvertStrToFloat(vehicle.Latitude)
-		currentLongitude := helper.ConvertStrToFloat(vehicle.Longitude)
+	if (result != models.VehiclesData{}) {
+		if result.CreatedAt != 0 {
+			createdAt = result.CreatedAt
+		}
 
-		pointA := helper.Coordinates{Latitude: prevLatitude, Longitude: prevLongitude}
-		pointB := helper.Coordinates{Latitude: currentLatitude, Longitude: currentLongitude}
-		distance := pointA.Distance(pointB)
+		prev := result.TypedSnapshot()
 
-		vehicle.DistanceTraveled = result.DistanceTraveled + distance
+		// legacy documents have no stored snapshot and their times were never
+		// read in the feed timezone, so only compare against stored snapshots
+		if result.Snapshot != nil && prev.Valid(models.FieldGPSTime) && current.Valid(models.FieldGPSTime) &&
+			current.GPSTime.Before(prev.GPSTime) {
+			return ErrStaleFix
+		}
 	}
 
-	vehicle.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	db.filterDistance(&vehicle, result, current)
+
+	vehicle.CreatedAt = createdAt
 	vehicle.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
-	vehicle.TimeStamp = primitive.NewDateTimeFromTime(time.Now())
+	vehicle.TimeStamp = primitive.NewDateTimeFromTime(current.FixTime())
 
-	res := db.vehicleCollection.FindOneAndReplace(context.TODO(), filter, &vehicle, opt)
+	res := db.vehicleCollection.FindOneAndReplace(ctx, filter, &vehicle, opt)
 	return res.Err()
 }
 
-func (db *vehiclerepository) GetVehicleAlertById(vehicleId string) (models.VehicleAlerts, error) {
-	filter := bson.D{
-		bson.E{Key: "bike_no", Value: vehicleId},
+// filterDistance runs the new fix through the gps filter, only an accepted
+// fix adds to DistanceTraveled and becomes the origin for the next one
+func (db *vehiclerepository) filterDistance(vehicle *models.VehiclesData, stored models.VehiclesData, current models.VehicleSnapshot) {
+	vehicle.DistanceTraveled = stored.DistanceTraveled
+	vehicle.GPSRejections = stored.GPSRejections
+	vehicle.LastGoodFix = stored.LastGoodFix
+
+	// an unreadable coordinate is no evidence of movement either way
+	if !current.HasPosition() {
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	fix := helper.GPSFix{
+		Point:       helper.Coordinates{Latitude: current.Latitude, Longitude: current.Longitude},
+		Time:        current.FixTime(),
+		IgnitionOff: current.Valid(models.FieldIgnition) && !current.Ignition,
+	}
+	accepted := &models.GPSPoint{Latitude: current.Latitude, Longitude: current.Longitude, Time: fix.Time}
+
+	last := stored.LastGoodFix
+	if last == nil && stored.VehicleNo != "" {
+		// documents written before the filter existed start from their stored position
+		prev := stored.TypedSnapshot()
+		prevPoint := helper.Coordinates{Latitude: prev.Latitude, Longitude: prev.Longitude}
+		if ok, _ := db.gpsFilter.ValidPoint(prevPoint); ok && prev.HasPosition() {
+			last = &models.GPSPoint{Latitude: prev.Latitude, Longitude: prev.Longitude, Time: stored.UpdatedAt.Time()}
+		}
+	}
 
-	var vehicleData models.VehicleAlerts
+	if last == nil {
+		if ok, reason := db.gpsFilter.ValidPoint(fix.Point); !ok {
+			countGPSRejection(&vehicle.GPSRejections, reason)
+			return
+		}
+		vehicle.LastGoodFix = accepted
+		return
+	}
 
-	_ = db.vehicleAlertConnection.FindOne(ctx, filter).Decode(&vehicleData)
+	origin := helper.GPSFix{
+		Point: helper.Coordinates{Latitude: last.Latitude, Longitude: last.Longitude},
+		Time:  last.Time,
+	}
+	distance, reason := db.gpsFilter.Accept(origin, fix)
+	if reason != "" {
+		countGPSRejection(&vehicle.GPSRejections, reason)
+		return
+	}
 
-	return vehicleData, nil
+	vehicle.DistanceTraveled += distance
+	vehicle.LastGoodFix = accepted
 }
 
-func (db *vehiclerepository) GetVehicleFallAlertById(vehicleId string) (models.VehicleFallAlerts, error) {
-	filter := bson.D{
-		bson.E{Key: "bike_no", Value: vehicleId},
+func countGPSRejection(counts *models.GPSRejectionCounts, reason string) {
+	switch reason {
+	case helper.GPSRejectInvalid:
+		counts.Invalid++
+	case helper.GPSRejectZero:
+		counts.Zero++
+	case helper.GPSRejectImpossibleSpeed:
+		counts.ImpossibleSpeed++
+	case helper.GPSRejectIdleDrift:
+		counts.IdleDrift++
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (db *vehiclerepository) ListVehicles(ctx context.Context, filter models.VehicleFilter, page models.PageRequest) ([]models.VehiclesData, int64, error) {
+	query := bson.D{}
+	for field, value := range map[string]string{
+		"branch":      filter.Branch,
+		"company":     filter.Company,
+		"status":      filter.Status,
+		"vehicletype": filter.VehicleType,
+	} {
+		if value != "" {
+			query = append(query, bson.E{Key: field, Value: value})
+		}
+	}
+	if filter.VehicleNo != "" {
+		query = append(query, bson.E{Key: "vehicleno", Value: primitive.Regex{Pattern: "^" + regexp.QuoteMeta(filter.VehicleNo), Options: "i"}})
+	}
 
-	var vehicleData models.VehicleFallAlerts
+	vehicles := []models.VehiclesData{}
+	total, err := findPage(ctx, db.vehicleCollection, query, page, &vehicles)
+	return vehicles, total, err
+}
 
-	_ = db.vehicleFallAlertsConnection.FindOne(ctx, filter).Decode(&vehicleData)
+func (db *vehiclerepository) GetAlertHistory(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]bson.M, int64, error) {
+	query := bson.D{}
+	if match := subjectMatch(filter.SubjectId, filter.SubjectIds); match != nil {
+		query = append(query, bson.E{Key: "$or", Value: bson.A{
+			bson.D{bson.E{Key: "bike_no", Value: match}},
+			bson.D{bson.E{Key: "bms_id", Value: match}},
+		}})
+	}
+	if filter.AlertType != "" {
+		query = append(query, bson.E{Key: "alert_type", Value: filter.AlertType})
+	}
+	query = timeRange(query, "history_timestamp", filter)
 
-	return vehicleData, nil
+	history := []bson.M{}
+	total, err := findPage(ctx, db.vehicleAlertHistoryConnection, query, page, &history)
+	return history, total, err
 }
 
-func (db *vehiclerepository) TrackVehicleAlert() ([]models.VehiclesData, error) {
-	reqURL := "http://fusioniot.mobilogix.com/webservice?token=getLiveData&user=skroman@mautoafrica.com&pass=Mauto@777"
-
-	resp, err := http.Get(reqURL)
+func (db *vehiclerepository) GetScopeVehicleNumbers(ctx context.Context, scope models.Scope) ([]string, error) {
+	values, err := db.vehicleCollection.Distinct(ctx, "vehicleno", scopeQuery(scope))
 	if err != nil {
-		fmt.Println("URL heat error => ", err)
+		return nil, err
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(resp.Body)
-	body, err := ioutil.ReadAll(resp.Body)
+	return distinctStrings(values), nil
+}
+
+func (db *vehiclerepository) AddVehicleStateEvents(ctx context.Context, events []models.VehicleStateEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(events))
+	for i := range events {
+		events[i].CreatedAt = time.Now().UTC()
+		docs[i] = events[i]
+	}
+
+	_, err := db.vehicleStateEventConnection.InsertMany(ctx, docs)
+	return err
+}
+
+func (db *vehiclerepository) GetVehicleStateEvents(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleStateEvent, error) {
+	filter := bson.D{
+		bson.E{Key: "vehicle_no", Value: vehicleNo},
+		bson.E{Key: "time", Value: bson.D{
+			bson.E{Key: "$gte", Value: from},
+			bson.E{Key: "$lte", Value: to},
+		}},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "time", Value: -1}})
+
+	cursor, err := db.vehicleStateEventConnection.Find(ctx, filter, opts)
 	if err != nil {
-		fmt.Println("Read all error =>", err)
+		return nil, err
+	}
+
+	events := []models.VehicleStateEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (db *vehiclerepository) GetVehicleAlertById(ctx context.Context, vehicleId string) (models.VehicleAlerts, error) {
+	filter := bson.D{
+		bson.E{Key: "bike_no", Value: vehicleId},
 	}
-	content := string(body)
-	var jsonMap models.AutoGenerated
-	_ = json.Unmarshal([]byte(content), &jsonMap)
-	vehicleData := []models.VehiclesData{}
 
-	for i := range jsonMap.Root.VehicleData {
-		temp := models.VehiclesData{}
-		_ = smapping.FillStruct(&temp, smapping.MapFields(jsonMap.Root.VehicleData[i]))
+	var vehicleData models.VehicleAlerts
+
+	_ = db.vehicleAlertConnection.FindOne(ctx, filter).Decode(&vehicleData)
+
+	return vehicleData, nil
+}
 
-		vehicleData = append(vehicleData, temp)
+func (db *vehiclerepository) GetVehicleFallAlertById(ctx context.Context, vehicleId string) (models.VehicleFallAlerts, error) {
+	filter := bson.D{
+		bson.E{Key: "bike_no", Value: vehicleId},
 	}
 
+	var vehicleData models.VehicleFallAlerts
+
+	_ = db.vehicleFallAlertsConnection.FindOne(ctx, filter).Decode(&vehicleData)
+
 	return vehicleData, nil
 }
 
-func (db *vehiclerepository) UpdateVehicleAlert(vehicleData models.VehicleAlerts) error {
+func (db *vehiclerepository) TrackVehicleAlert(ctx context.Context) ([]models.VehiclesData, error) {
+
+	return db.feed.FetchVehicles(ctx)
+}
+
+func (db *vehiclerepository) UpdateVehicleAlert(ctx context.Context, vehicleData models.VehicleAlerts) error {
 
 	vehicleData.CreateAt = primitive.NewDateTimeFromTime(time.Now())
 	vehicleData.UpdateAt = primitive.NewDateTimeFromTime(time.Now())
@@ -273,15 +372,12 @@ func (db *vehiclerepository) UpdateVehicleAlert(vehicleData models.VehicleAlerts
 	}
 	opts := options.FindOneAndReplace().SetUpsert(true)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	_ = db.vehicleAlertConnection.FindOneAndReplace(ctx, filter, vehicleData, opts)
 
 	return nil
 }
 
-func (db *vehiclerepository) UpdateVehicleFallAlert(vehicleData models.VehicleFallAlerts) error {
+func (db *vehiclerepository) UpdateVehicleFallAlert(ctx context.Context, vehicleData models.VehicleFallAlerts) error {
 
 	vehicleData.CreateAt = primitive.NewDateTimeFromTime(time.Now())
 	vehicleData.UpdateAt = primitive.NewDateTimeFromTime(time.Now())
@@ -294,15 +390,12 @@ func (db *vehiclerepository) UpdateVehicleFallAlert(vehicleData models.VehicleFa
 	}
 	opts := options.FindOneAndReplace().SetUpsert(true)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	_ = db.vehicleFallAlertsConnection.FindOneAndReplace(ctx, filter, vehicleData, opts)
 
 	return nil
 }
 
-func (db *vehiclerepository) GetOverSpeedAlerts() ([]models.VehicleAlerts, error) {
+func (db *vehiclerepository) GetOverSpeedAlerts(ctx context.Context) ([]models.VehicleAlerts, error) {
 
 	filter := []bson.M{
 		{"$match": bson.M{
@@ -313,7 +406,7 @@ func (db *vehiclerepository) GetOverSpeedAlerts() ([]models.VehicleAlerts, error
 		},
 	}
 
-	cursor, curErr := db.vehicleAlertConnection.Aggregate(context.TODO(), filter)
+	cursor, curErr := db.vehicleAlertConnection.Aggregate(ctx, filter)
 
 	if curErr != nil {
 		return nil, curErr
@@ -321,14 +414,14 @@ func (db *vehiclerepository) GetOverSpeedAlerts() ([]models.VehicleAlerts, error
 
 	var vehicleAlerts []models.VehicleAlerts
 
-	if err := cursor.All(context.TODO(), &vehicleAlerts); err != nil {
+	if err := cursor.All(ctx, &vehicleAlerts); err != nil {
 		return nil, err
 	}
 
 	return vehicleAlerts, nil
 }
 
-func (db *vehiclerepository) GetAllVehicleFallAlerts() ([]models.VehicleFallAlerts, error) {
+func (db *vehiclerepository) GetAllVehicleFallAlerts(ctx context.Context) ([]models.VehicleFallAlerts, error) {
 	filter := []bson.M{
 		{"$match": bson.M{
 			"create_at": bson.M{
@@ -338,7 +431,7 @@ func (db *vehiclerepository) GetAllVehicleFallAlerts() ([]models.VehicleFallAler
 		},
 	}
 
-	cursor, curErr := db.vehicleFallAlertsConnection.Aggregate(context.TODO(), filter)
+	cursor, curErr := db.vehicleFallAlertsConnection.Aggregate(ctx, filter)
 
 	if curErr != nil {
 		return nil, curErr
@@ -346,14 +439,14 @@ func (db *vehiclerepository) GetAllVehicleFallAlerts() ([]models.VehicleFallAler
 
 	var vehicleAlerts []models.VehicleFallAlerts
 
-	if err := cursor.All(context.TODO(), &vehicleAlerts); err != nil {
+	if err := cursor.All(ctx, &vehicleAlerts); err != nil {
 		return nil, err
 	}
 
 	return vehicleAlerts, nil
 }
 
-func (db *vehiclerepository) CreateOverSpeedAlertHistory(vehicleAlerts []models.VehicleAlerts) error {
+func (db *vehiclerepository) CreateOverSpeedAlertHistory(ctx context.Context, vehicleAlerts []models.VehicleAlerts) error {
 
 	for i := range vehicleAlerts {
 		if (reflect.DeepEqual(models.VehicleAlerts{}, vehicleAlerts[i])) {
@@ -367,13 +460,13 @@ func (db *vehiclerepository) CreateOverSpeedAlertHistory(vehicleAlerts []models.
 			temp.HistoryTimestamp = primitive.NewDateTimeFromTime(time.Now())
 			temp.AlertType = "overspeed"
 
-			_, err := db.vehicleAlertHistoryConnection.InsertOne(context.TODO(), temp)
+			_, err := db.vehicleAlertHistoryConnection.InsertOne(ctx, temp)
 
 			if err != nil {
 				return err
 			}
 
-			_ = db.DeleteTodayAlert(vehicleAlerts[i].Id)
+			_ = db.DeleteTodayAlert(ctx, vehicleAlerts[i].Id)
 		}
 
 	}
@@ -381,7 +474,7 @@ func (db *vehiclerepository) CreateOverSpeedAlertHistory(vehicleAlerts []models.
 	return nil
 }
 
-func (db *vehiclerepository) CreateVehicleFallAlertHistory(vehicleAlerts []models.VehicleFallAlerts) error {
+func (db *vehiclerepository) CreateVehicleFallAlertHistory(ctx context.Context, vehicleAlerts []models.VehicleFallAlerts) error {
 
 	for i := range vehicleAlerts {
 		if (reflect.DeepEqual(models.VehicleFallAlerts{}, vehicleAlerts[i])) {
@@ -395,13 +488,13 @@ func (db *vehiclerepository) CreateVehicleFallAlertHistory(vehicleAlerts []model
 			temp.HistoryTimestamp = primitive.NewDateTimeFromTime(time.Now())
 			temp.AlertType = "fall"
 
-			_, err := db.vehicleAlertHistoryConnection.InsertOne(context.TODO(), temp)
+			_, err := db.vehicleAlertHistoryConnection.InsertOne(ctx, temp)
 
 			if err != nil {
 				return err
 			}
 
-			_ = db.DeleteTodayFallAlert(vehicleAlerts[i].Id)
+			_ = db.DeleteTodayFallAlert(ctx, vehicleAlerts[i].Id)
 		}
 
 	}
@@ -409,43 +502,28 @@ func (db *vehiclerepository) CreateVehicleFallAlertHistory(vehicleAlerts []model
 	return nil
 }
 
-func (db *vehiclerepository) DeleteTodayAlert(alertId primitive.ObjectID) error {
+func (db *vehiclerepository) DeleteTodayAlert(ctx context.Context, alertId primitive.ObjectID) error {
 
 	filter := bson.D{
 		bson.E{Key: "_id", Value: alertId},
 	}
 
-	_, err := db.vehicleAlertConnection.DeleteOne(context.TODO(), filter)
+	_, err := db.vehicleAlertConnection.DeleteOne(ctx, filter)
 
 	return err
 }
 
-func (db *vehiclerepository) DeleteTodayFallAlert(alertId primitive.ObjectID) error {
+func (db *vehiclerepository) DeleteTodayFallAlert(ctx context.Context, alertId primitive.ObjectID) error {
 	filter := bson.D{
 		bson.E{Key: "_id", Value: alertId},
 	}
 
-	_, err := db.vehicleFallAlertsConnection.DeleteOne(context.TODO(), filter)
+	_, err := db.vehicleFallAlertsConnection.DeleteOne(ctx, filter)
 
 	return err
 }
 
-func (db *vehiclerepository) GetAlertLimit(alertType string) (models.AlertConfig, error) {
-	filter := bson.D{
-		bson.E{Key: "alert_type", Value: alertType},
-	}
-
-	alertConfig := models.AlertConfig{}
-
-	res := db.alertConfigConnection.FindOne(context.TODO(), filter).Decode(&alertConfig)
-	if res != nil {
-		return models.AlertConfig{}, res
-	}
-
-	return alertConfig, nil
-}
-
-func (db *vehiclerepository) AddTestData() error {
+func (db *vehiclerepository) AddTestData(ctx context.Context) error {
 	// filter := bson.D{
 	// 	bson.E{Key: "test", Value: "test2"},
 	// }
@@ -475,9 +553,9 @@ func (db *vehiclerepository) AddTestData() error {
 	// }
 	// return nil
 
-	bmsTempCollection := dbconfig.GetCollection(dbconfig.ResolveClientDB(), "bms_temperature_alert")
+	bmsTempCollection := db.batteryTemperatureConnection
 
-	cursor, curErr := bmsTempCollection.Find(context.TODO(), bson.M{})
+	cursor, curErr := bmsTempCollection.Find(ctx, bson.M{})
 
 	if curErr != nil {
 		return curErr
@@ -485,7 +563,7 @@ func (db *vehiclerepository) AddTestData() error {
 
 	var data []models.BatteryTemperatureAlert
 
-	if err := cursor.All(context.TODO(), &data); err != nil {
+	if err := cursor.All(ctx, &data); err != nil {
 		return err
 	}
 
@@ -495,7 +573,7 @@ func (db *vehiclerepository) AddTestData() error {
 			filter := bson.D{
 				bson.E{Key: "bms_id", Value: data[i].BMSID},
 			}
-			_, _ = bmsTempCollection.DeleteOne(context.TODO(), filter)
+			_, _ = bmsTempCollection.DeleteOne(ctx, filter)
 
 		}
 	}
@@ -503,8 +581,8 @@ func (db *vehiclerepository) AddTestData() error {
 	return nil
 }
 
-func (db *vehiclerepository) GetAllVehicles() ([]models.VehiclesData, error) {
-	cursor, curErr := db.vehicleCollection.Find(context.TODO(), bson.M{})
+func (db *vehiclerepository) GetAllVehicles(ctx context.Context) ([]models.VehiclesData, error) {
+	cursor, curErr := db.vehicleCollection.Find(ctx, bson.M{})
 
 	if curErr != nil {
 		return nil, curErr
@@ -512,14 +590,14 @@ func (db *vehiclerepository) GetAllVehicles() ([]models.VehiclesData, error) {
 
 	vehiclesData := []models.VehiclesData{}
 
-	if err := cursor.All(context.TODO(), &vehiclesData); err != nil {
+	if err := cursor.All(ctx, &vehiclesData); err != nil {
 		return nil, err
 	}
 
 	return vehiclesData, nil
 }
 
-func (db *vehiclerepository) CreateDistanceTravelHistory(vehicleData []models.VehiclesData) error {
+func (db *vehiclerepository) CreateDistanceTravelHistory(ctx context.Context, vehicleData []models.VehiclesData) error {
 	for i := range vehicleData {
 		temp := models.VehicleFallAlertHistory{}
 
@@ -530,7 +608,7 @@ func (db *vehiclerepository) CreateDistanceTravelHistory(vehicleData []models.Ve
 		temp.CreateAt = primitive.NewDateTimeFromTime(time.Now())
 		temp.DistanceTraveled = vehicleData[i].DistanceTraveled
 
-		_, err := db.vehicleAlertHistoryConnection.InsertOne(context.TODO(), temp)
+		_, err := db.vehicleAlertHistoryConnection.InsertOne(ctx, temp)
 
 		if err != nil {
 			return err
@@ -540,27 +618,23 @@ func (db *vehiclerepository) CreateDistanceTravelHistory(vehicleData []models.Ve
 	return nil
 }
 
-func (db *vehiclerepository) BatteryTempToMain() error {
-	fmt.Println("battery temp to main run from repo..")
+func (db *vehiclerepository) BatteryTempToMain(ctx context.Context) ([]models.BatteryHardwareMain, error) {
 	filter := bson.D{
 		bson.E{Key: "is_first_fill", Value: true},
 		bson.E{Key: "is_second_fill", Value: true},
 		bson.E{Key: "is_third_fill", Value: true},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	cursor, curErr := db.batteryTempConnection.Find(ctx, filter)
 
 	if curErr != nil {
-		return curErr
+		return nil, curErr
 	}
 
 	var batteryData []models.BatteryHardwareMain
 
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
-		return err
+	if err := cursor.All(ctx, &batteryData); err != nil {
+		return nil, err
 	}
 
 	dataToDelete := []string{}
@@ -569,44 +643,47 @@ func (db *vehiclerepository) BatteryTempToMain() error {
 		dataToDelete = append(dataToDelete, batteryData[i].BmsID)
 	}
 
-	go db.CreateMBMSRawAndSOCData(batteryData)
-	db.UpdateBatteryCycleStartParamsInMain(batteryData)
-	db.UpdateBatteryLocationForCycle(batteryData)
-	db.DeleteBatteryTempData(dataToDelete)
-	db.AddBatteryToMain(batteryData)
-	db.UpdateBMSDistanceTravelled(batteryData)
-	// db.UpdateBMSReporting(dataToDelete)
-	return nil
+	// part of the run, so a slow telematics cluster can't pile up writes
+	// behind the next runs
+	if err := db.CreateMBMSRawAndSOCData(ctx, batteryData); err != nil {
+		logger.From(ctx).WithError(err).Error("failed to store bms raw and soc data")
+	}
+	db.UpdateBatteryCycleStartParamsInMain(ctx, batteryData)
+	db.UpdateBatteryLocationForCycle(ctx, batteryData)
+	db.DeleteBatteryTempData(ctx, dataToDelete)
+	db.AddBatteryToMain(ctx, batteryData)
+	db.UpdateBMSDistanceTravelled(ctx, batteryData)
+	// db.UpdateBMSReporting(ctx, dataToDelete)
+	return batteryData, nil
 }
 
-func (db *vehiclerepository) DeleteBatteryTempData(batteryData []string) error {
-	fmt.Println("Delete battery temp data run successfully... with data :  ", len(batteryData))
+func (db *vehiclerepository) DeleteBatteryTempData(ctx context.Context, batteryData []string) error {
 	filter := bson.D{
 		bson.E{Key: "bms_id", Value: bson.D{
 			bson.E{Key: "$in", Value: batteryData},
 		}},
 	}
 
-	res, err := db.batteryTempConnection.DeleteMany(context.TODO(), filter)
-	fmt.Println("Result data from delete : ", res.DeletedCount)
-	return err
+	res, err := db.batteryTempConnection.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	logger.From(ctx).WithField("deleted", res.DeletedCount).Debug("deleted moved battery temp data")
+	return nil
 }
 
-func (db *vehiclerepository) DeleteBatteryTemperatureAlert(batteryTempAlert []string) error {
+func (db *vehiclerepository) DeleteBatteryTemperatureAlert(ctx context.Context, batteryTempAlert []string) error {
 	filter := bson.D{
 		bson.E{Key: "bms_id", Value: bson.D{
 			bson.E{Key: "$in", Value: batteryTempAlert},
 		}},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	_, err := db.batteryTemperatureConnection.DeleteMany(ctx, filter)
 	return err
 }
 
-func (db *vehiclerepository) AddBatteryToMain(batteryData []models.BatteryHardwareMain) error {
+func (db *vehiclerepository) AddBatteryToMain(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	var operations []mongo.WriteModel
 
 	for i := range batteryData {
@@ -693,15 +770,12 @@ func (db *vehiclerepository) AddBatteryToMain(batteryData []models.BatteryHardwa
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	res, err := db.batteryMainConnection.BulkWrite(ctx, operations)
-	fmt.Println("Add battery result : ", res)
+	logBulkWrite(ctx, "moved battery temp data to main", res)
 	return err
 }
 
-func (db *vehiclerepository) UpdateBMSReporting(batteryData []string) error {
+func (db *vehiclerepository) UpdateBMSReporting(ctx context.Context, batteryData []string) error {
 	var operations []mongo.WriteModel
 
 	for i := range batteryData {
@@ -730,19 +804,19 @@ func (db *vehiclerepository) UpdateBMSReporting(batteryData []string) error {
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	_, err := db.batteryReportingConnection.BulkWrite(ctx, operations)
 
 	return err
 }
 
-func (db *vehiclerepository) CreateMBMSRawAndSOCData(hardWareData []models.BatteryHardwareMain) error {
-	Mclient = ConnectToMDB()
-	var remote = "telematics"
-	rawDataCollection := Mclient.Database(remote).Collection("bms_rawdata")
-	socDataCollection := Mclient.Database(remote).Collection("bms_soc_updated_data")
+func (db *vehiclerepository) CreateMBMSRawAndSOCData(ctx context.Context, hardWareData []models.BatteryHardwareMain) error {
+
+	telematicsDB, err := db.telematics.Database(ctx)
+	if err != nil {
+		return err
+	}
+	rawDataCollection := telematicsDB.Collection("bms_rawdata")
+	socDataCollection := telematicsDB.Collection("bms_soc_updated_data")
 
 	currentTime := time.Now()
 	isoDateTime := currentTime.Format(time.RFC3339)
@@ -758,7 +832,7 @@ func (db *vehiclerepository) CreateMBMSRawAndSOCData(hardWareData []models.Batte
 		hardWareData[i].UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
 		hardWareData[i].Id = primitive.NewObjectID()
 
-		rawDataCollection.InsertOne(context.TODO(), hardWareData[i])
+		rawDataCollection.InsertOne(ctx, hardWareData[i])
 		// if err != nil {
 		// 	fmt.Println("Error from raw collection => ", err)
 		// } else {
@@ -823,7 +897,7 @@ func (db *vehiclerepository) CreateMBMSRawAndSOCData(hardWareData []models.Batte
 			}},
 		}
 
-		socDataCollection.UpdateOne(context.TODO(), filter, &update, opts)
+		socDataCollection.UpdateOne(ctx, filter, &update, opts)
 		// if err != nil {
 		// 	fmt.Println("Error from raw collection => ", err)
 		// } else {
@@ -834,7 +908,7 @@ func (db *vehiclerepository) CreateMBMSRawAndSOCData(hardWareData []models.Batte
 	return nil
 }
 
-func (db *vehiclerepository) CreateBatteryTemperatureHistory(batteryTemperatureData []models.BatteryTemperatureAlert) error {
+func (db *vehiclerepository) CreateBatteryTemperatureHistory(ctx context.Context, batteryTemperatureData []models.BatteryTemperatureAlert) error {
 	dataToDelete := []string{}
 
 	for i := range batteryTemperatureData {
@@ -850,21 +924,16 @@ func (db *vehiclerepository) CreateBatteryTemperatureHistory(batteryTemperatureD
 
 		dataToDelete = append(dataToDelete, batteryTemperatureData[i].BMSID)
 
-		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
-		defer cancel()
-
 		_, _ = db.vehicleAlertHistoryConnection.InsertOne(ctx, temp)
 	}
 
-	err := db.DeleteBatteryTemperatureAlert(dataToDelete)
+	err := db.DeleteBatteryTemperatureAlert(ctx, dataToDelete)
 
 	return err
 
 }
 
-func (db *vehiclerepository) GetBatteryTemperatureData() ([]models.BatteryTemperatureAlert, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
-	defer cancel()
+func (db *vehiclerepository) GetBatteryTemperatureData(ctx context.Context) ([]models.BatteryTemperatureAlert, error) {
 
 	filter := []bson.M{
 		{"$match": bson.M{
@@ -882,7 +951,7 @@ func (db *vehiclerepository) GetBatteryTemperatureData() ([]models.BatteryTemper
 
 	batteryData := []models.BatteryTemperatureAlert{}
 
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
+	if err := cursor.All(ctx, &batteryData); err != nil {
 		return nil, err
 	}
 
@@ -890,44 +959,7 @@ func (db *vehiclerepository) GetBatteryTemperatureData() ([]models.BatteryTemper
 
 }
 
-func ConnectToMDB() *mongo.Client {
-	// if Mclient == nil {
-	// 	var err error
-	// 	clientOptions := options.Client().ApplyURI(dbconfig.MongoURI())
-	// 	Mclient, err = mongo.Connect(context.Background(), clientOptions)
-	// 	if err != nil {
-	// 		log.Fatal(err)
-	// 	}
-
-	// 	// check the connection
-	// 	err = Mclient.Ping(context.Background(), nil)
-	// 	if err != nil {
-	// 		log.Fatal(err)
-	// 	}
-	// }
-
-	var err error
-	//TODO add to your .env.yml or .config.yml MONGODB_URI: mongodb://localhost:27017
-	clientOptions := options.Client().ApplyURI(dbconfig.MongoURI())
-	Mclient, err = mongo.Connect(context.Background(), clientOptions)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// check the connection
-	err = Mclient.Ping(context.Background(), nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// TODO optional you can log your connected MongoDB client
-	fmt.Println("Client DB Connection established...", time.Now())
-	return Mclient
-}
-
-func (db *vehiclerepository) UpdateBMSDistanceTravelled(batteryData []models.BatteryHardwareMain) error {
-	// ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
-	// defer cancel()
+func (db *vehiclerepository) UpdateBMSDistanceTravelled(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	var operations []mongo.WriteModel
 
 	for i := range batteryData {
@@ -957,13 +989,12 @@ func (db *vehiclerepository) UpdateBMSDistanceTravelled(batteryData []models.Bat
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	_, err := db.batteryDistanceTravelledConnection.BulkWrite(context.TODO(), operations)
+	_, err := db.batteryDistanceTravelledConnection.BulkWrite(ctx, operations)
 	return err
 
 }
 
-func (db *vehiclerepository) CheckForBatteryCycle() ([]models.BatteryHardwareMain, error) {
-	fmt.Println("start fetching all battery data...")
+func (db *vehiclerepository) CheckForBatteryCycle(ctx context.Context) ([]models.BatteryHardwareMain, error) {
 	opts := options.Find().SetProjection(
 		bson.D{
 			bson.E{Key: "bms_id", Value: 1},
@@ -980,24 +1011,23 @@ func (db *vehiclerepository) CheckForBatteryCycle() ([]models.BatteryHardwareMai
 			bson.E{Key: "odo_meter", Value: 1},
 		},
 	)
-	cursor, curErr := db.batteryMainConnection.Find(context.TODO(), bson.M{}, opts)
+	cursor, curErr := db.batteryMainConnection.Find(ctx, bson.M{}, opts)
 	if curErr != nil {
 		return nil, curErr
 	}
 
 	var batteryData []models.BatteryHardwareMain
 
-	if err := cursor.All(context.TODO(), &batteryData); err != nil {
+	if err := cursor.All(ctx, &batteryData); err != nil {
 		return nil, err
 	}
 
-	fmt.Println("Returning from repo.....")
 	return batteryData, nil
 }
 
 //update current cycle count to old count
 
-func (db *vehiclerepository) UpdateCycleOldCycleCount(batteryData []models.BatteryHardwareMain) error {
+func (db *vehiclerepository) UpdateCycleOldCycleCount(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	operation := []mongo.WriteModel{}
 
 	for i := range batteryData {
@@ -1020,12 +1050,12 @@ func (db *vehiclerepository) UpdateCycleOldCycleCount(batteryData []models.Batte
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	res, err := db.batteryMainConnection.BulkWrite(context.TODO(), operation)
-	fmt.Println(res)
+	res, err := db.batteryMainConnection.BulkWrite(ctx, operation)
+	logBulkWrite(ctx, "updated old cycle counts", res)
 	return err
 }
 
-func (db *vehiclerepository) UpdateBatteryCycle(batteryData []models.BatteryHardwareMain) error {
+func (db *vehiclerepository) UpdateBatteryCycle(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	var bmsIDS []string
 	var cycleStartOperation, batteryDistanceOperation []mongo.WriteModel
 	var wg sync.WaitGroup
@@ -1034,8 +1064,9 @@ func (db *vehiclerepository) UpdateBatteryCycle(batteryData []models.BatteryHard
 		defer wg.Done()
 		// update battery old cycle count every time when ever cycle get started and ended
 		temp := new(models.UpdateOldCycleCount).SetUpdateOldCycleCount(batteryData)
-		err := db.UpdateBatteryCycleOldCount(temp)
-		fmt.Println(err)
+		if err := db.UpdateBatteryCycleOldCount(ctx, temp); err != nil {
+			logger.From(ctx).WithError(err).Error("failed to update old cycle counts")
+		}
 	}()
 
 	for i := range batteryData {
@@ -1046,13 +1077,10 @@ func (db *vehiclerepository) UpdateBatteryCycle(batteryData []models.BatteryHard
 
 		var batteryCycle models.CreateCycleBasedReport
 
-		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
-		defer cancel()
-
 		db.batteryCycleTempReportConnection.FindOne(ctx, filter).Decode(&batteryCycle)
 
 		if (batteryCycle == models.CreateCycleBasedReport{}) {
-			fmt.Println("Preparing to start a cycle for : ", batteryData[i].BmsID)
+			logger.From(ctx).WithField(logger.FieldBmsID, batteryData[i].BmsID).Debug("starting a battery cycle")
 			cycleStartOption := mongo.NewUpdateOneModel()
 
 			update := bson.D{
@@ -1095,7 +1123,7 @@ func (db *vehiclerepository) UpdateBatteryCycle(batteryData []models.BatteryHard
 			batteryDistanceOperation = append(batteryDistanceOperation, batteryDistanceOption)
 
 		} else {
-			fmt.Println("Preparing to end a cycle for : ", batteryData[i].BmsID)
+			logger.From(ctx).WithField(logger.FieldBmsID, batteryData[i].BmsID).Debug("ending a battery cycle")
 			var totalSpeed int
 			var avgSpeed int
 			var topSpeed int = -100000000
@@ -1137,8 +1165,7 @@ func (db *vehiclerepository) UpdateBatteryCycle(batteryData []models.BatteryHard
 
 			// km calculater
 			if topSpeedChanged && lowSpeedChanged && minSocChanged && maxSocChanged {
-				fmt.Println("Preparing a for create cycle history...")
-				kmT, _ := db.GetBatteryCycleLocations(batteryCycle.BMSID)
+				kmT, _ := db.GetBatteryCycleLocations(ctx, batteryCycle.BMSID)
 				batteryCycle.KMTravelled = kmT
 				batteryCycle.MinSoc = minSoc
 				batteryCycle.MaxSoc = maxSoc
@@ -1160,30 +1187,31 @@ func (db *vehiclerepository) UpdateBatteryCycle(batteryData []models.BatteryHard
 				batteryCycle.DOD = strSoc + "%"
 
 				// create cycle history
-				res, err := db.batteryCycleHistoryConnection.InsertOne(context.TODO(), batteryCycle)
-				fmt.Println("Error from history created : ", err, " and result : ", res.InsertedID)
+				if _, err := db.batteryCycleHistoryConnection.InsertOne(ctx, batteryCycle); err != nil {
+					logger.From(ctx).WithField(logger.FieldBmsID, batteryData[i].BmsID).WithError(err).Error("failed to create the battery cycle history")
+				}
 				// remove cycle temp data
-				db.RemoveCycleTempData(batteryCycle.BMSID)
+				db.RemoveCycleTempData(ctx, batteryCycle.BMSID)
 
 				bmsIDS = append(bmsIDS, batteryData[i].BmsID)
 			} else {
-				fmt.Println("Failed to prepare a to create a history with bms id : ", batteryData[i].BmsID)
+				logger.From(ctx).WithField(logger.FieldBmsID, batteryData[i].BmsID).Warn("battery cycle ended without speed or soc readings, no history created")
 			}
 		}
 	}
 
-	fmt.Println("Sending a bulk data for start the cycle...")
-	cycleStartErr := db.StartNewBatteryCycle(cycleStartOperation)
-	fmt.Println("Cycle start Error : ", cycleStartErr)
+	if cycleStartErr := db.StartNewBatteryCycle(ctx, cycleStartOperation); cycleStartErr != nil {
+		logger.From(ctx).WithError(cycleStartErr).Error("failed to start battery cycles")
+	}
 
-	fmt.Println("Sending a bulk data for storing a battery location....")
-	createLocationErr := db.CreateBatteryLocationData(batteryDistanceOperation)
-	fmt.Println("Cycle location stored error : ", createLocationErr)
+	if createLocationErr := db.CreateBatteryLocationData(ctx, batteryDistanceOperation); createLocationErr != nil {
+		logger.From(ctx).WithError(createLocationErr).Error("failed to store battery cycle locations")
+	}
 
 	// updating a min max soc array and speed cal array after ending the cycle
-	fmt.Println("Sending data to set a empty array to min max soc and speed cal array....")
-	upMainErr := db.UpdateBatteryCycleDataInBatteryMain(bmsIDS)
-	fmt.Println("Update min max soc and speed cal array error : ", upMainErr)
+	if upMainErr := db.UpdateBatteryCycleDataInBatteryMain(ctx, bmsIDS); upMainErr != nil {
+		logger.From(ctx).WithError(upMainErr).Error("failed to reset the soc and speed ranges in battery main")
+	}
 
 	wg.Wait()
 	return nil
@@ -1191,26 +1219,40 @@ func (db *vehiclerepository) UpdateBatteryCycle(batteryData []models.BatteryHard
 }
 
 // create a new battery cycle start
-func (db *vehiclerepository) StartNewBatteryCycle(operations []mongo.WriteModel) error {
+func (db *vehiclerepository) StartNewBatteryCycle(ctx context.Context, operations []mongo.WriteModel) error {
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	res, err := db.batteryCycleTempReportConnection.BulkWrite(context.TODO(), operations)
-	fmt.Println("Start new battery cycle inserted count : ", res.InsertedCount)
-	return err
+	if len(operations) == 0 {
+		return nil
+	}
+
+	res, err := db.batteryCycleTempReportConnection.BulkWrite(ctx, operations)
+	if err != nil {
+		return err
+	}
+	logBulkWrite(ctx, "started battery cycles", res)
+	return nil
 }
 
 // create  a battery location data to find a KM for all cycle
-func (db *vehiclerepository) CreateBatteryLocationData(operations []mongo.WriteModel) error {
+func (db *vehiclerepository) CreateBatteryLocationData(ctx context.Context, operations []mongo.WriteModel) error {
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	res, err := db.batteryCycleLocationConnection.BulkWrite(context.TODO(), operations)
-	fmt.Println("Create battery location data inserted count : ", res.InsertedCount)
-	return err
+	if len(operations) == 0 {
+		return nil
+	}
+
+	res, err := db.batteryCycleLocationConnection.BulkWrite(ctx, operations)
+	if err != nil {
+		return err
+	}
+	logBulkWrite(ctx, "stored battery cycle locations", res)
+	return nil
 }
 
-func (db *vehiclerepository) GetBatteryCycleLocations(bmsID string) (float64, error) {
+func (db *vehiclerepository) GetBatteryCycleLocations(ctx context.Context, bmsID string) (float64, error) {
 	filter := []bson.M{
 		{
 			"$match": bson.M{
@@ -1220,7 +1262,7 @@ func (db *vehiclerepository) GetBatteryCycleLocations(bmsID string) (float64, er
 	}
 
 	batteryData := models.BatteryDistanceTravelled{}
-	res := db.batteryCycleLocationConnection.FindOne(context.TODO(), filter).Decode(&batteryData)
+	res := db.batteryCycleLocationConnection.FindOne(ctx, filter).Decode(&batteryData)
 
 	var totalKM float64
 	if len(batteryData.Location) > 0 {
@@ -1243,25 +1285,22 @@ func (db *vehiclerepository) GetBatteryCycleLocations(bmsID string) (float64, er
 	}
 	//delete location after cycle completed
 	if res == nil {
-		db.batteryCycleLocationConnection.DeleteOne(context.TODO(), filter)
+		db.batteryCycleLocationConnection.DeleteOne(ctx, filter)
 	}
 	return totalKM / 1000, res
 }
 
-func (db *vehiclerepository) RemoveCycleTempData(bmsID string) error {
+func (db *vehiclerepository) RemoveCycleTempData(ctx context.Context, bmsID string) error {
 	filter := bson.D{
 		bson.E{Key: "bms_id", Value: bmsID},
 	}
 
-	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
-	defer cancel()
-
 	db.batteryCycleTempReportConnection.DeleteOne(ctx, filter)
 	return nil
 }
 
 // update and set empty array to min max soc and speed cal in main
-func (db *vehiclerepository) UpdateBatteryCycleDataInBatteryMain(bmsIDS []string) error {
+func (db *vehiclerepository) UpdateBatteryCycleDataInBatteryMain(ctx context.Context, bmsIDS []string) error {
 
 	operations := []mongo.WriteModel{}
 
@@ -1287,13 +1326,13 @@ func (db *vehiclerepository) UpdateBatteryCycleDataInBatteryMain(bmsIDS []string
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	_, err := db.batteryMainConnection.BulkWrite(context.TODO(), operations)
-	fmt.Println("Update Battery Cycle Data In Battery Main Inserted Count : ")
+	res, err := db.batteryMainConnection.BulkWrite(ctx, operations)
+	logBulkWrite(ctx, "reset the soc and speed ranges in battery main", res)
 	return err
 }
 
 // update old battery count in main to refer start / end cycle
-func (db *vehiclerepository) UpdateBatteryCycleOldCount(batteryData []models.UpdateOldCycleCount) error {
+func (db *vehiclerepository) UpdateBatteryCycleOldCount(ctx context.Context, batteryData []models.UpdateOldCycleCount) error {
 	operations := []mongo.WriteModel{}
 
 	for i := range batteryData {
@@ -1319,13 +1358,13 @@ func (db *vehiclerepository) UpdateBatteryCycleOldCount(batteryData []models.Upd
 	bulkWriter := options.BulkWriteOptions{}
 	bulkWriter.SetOrdered(true)
 
-	res, err := db.batteryMainConnection.BulkWrite(context.TODO(), operations)
-	fmt.Println("Update Old Cycle Count Error : ", err, " and result : ", res)
+	res, err := db.batteryMainConnection.BulkWrite(ctx, operations)
+	logBulkWrite(ctx, "updated old cycle counts", res)
 	return err
 }
 
 // update battery location
-func (db *vehiclerepository) UpdateBatteryLocationForCycle(batteryData []models.BatteryHardwareMain) error {
+func (db *vehiclerepository) UpdateBatteryLocationForCycle(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	operations := []mongo.WriteModel{}
 
 	for i := range batteryData {
@@ -1350,13 +1389,13 @@ func (db *vehiclerepository) UpdateBatteryLocationForCycle(batteryData []models.
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	res, err := db.batteryCycleLocationConnection.BulkWrite(context.TODO(), operations)
-	fmt.Println(res)
+	res, err := db.batteryCycleLocationConnection.BulkWrite(ctx, operations)
+	logBulkWrite(ctx, "updated battery cycle locations", res)
 	return err
 }
 
 // store soc, speed  for battery cycle start
-func (db *vehiclerepository) UpdateBatteryCycleStartParamsInMain(batteryData []models.BatteryHardwareMain) error {
+func (db *vehiclerepository) UpdateBatteryCycleStartParamsInMain(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	operations := []mongo.WriteModel{}
 
 	for i := range batteryData {
@@ -1379,7 +1418,7 @@ func (db *vehiclerepository) UpdateBatteryCycleStartParamsInMain(batteryData []m
 	bulkOption := options.BulkWriteOptions{}
 	bulkOption.SetOrdered(true)
 
-	res, err := db.batteryMainConnection.BulkWrite(context.TODO(), operations)
-	fmt.Println(res)
+	res, err := db.batteryMainConnection.BulkWrite(ctx, operations)
+	logBulkWrite(ctx, "stored cycle start params in battery main", res)
 	return err
 }
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/models"
+)
+
+func TestVehicleRepositoryUpdateVehicleData(t *testing.T) {
+	repo := NewVehicleRepository(testDatabase(t), nil, nil, helper.GPSFilter{MaxSpeedKmph: 150, IdleDriftMeters: 50})
+	ctx := context.Background()
+	receivedAt := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	// 0.01 degrees of latitude are about 1.11 km
+	fix := func(gpsTime, latitude string) models.VehiclesData {
+		vehicle := models.VehiclesData{
+			VehicleNo:     "MH12AB1234",
+			Branch:        "pune",
+			Latitude:      latitude,
+			Longitude:     "73.8",
+			IGN:           "ON",
+			GPSActualTime: gpsTime,
+		}
+		snapshot := models.ParseVehicleSnapshot(vehicle, receivedAt, models.DefaultSnapshotOptions())
+		vehicle.Snapshot = &snapshot
+		return vehicle
+	}
+
+	steps := []struct {
+		name    string
+		vehicle models.VehiclesData
+		wantErr error
+	}{
+		{"first fix", fix("2023-05-02 10:00:00", "18.5"), nil},
+		{"next fix", fix("2023-05-02 10:01:00", "18.51"), nil},
+		{"older fix", fix("2023-05-02 09:59:00", "18.6"), ErrStaleFix},
+	}
+	for _, step := range steps {
+		if err := repo.UpdateVehicleData(ctx, step.vehicle); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s : err = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	vehicles, total, err := repo.ListVehicles(ctx, models.VehicleFilter{Branch: "pune", VehicleNo: "mh12"}, models.PageRequest{Page: 1, Limit: 10, Sort: "vehicleno"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(vehicles) != 1 {
+		t.Fatalf("listed %d of %d vehicles, want the one upserted", len(vehicles), total)
+	}
+	stored := vehicles[0]
+	if stored.Latitude != "18.51" {
+		t.Errorf("latitude = %s, the stale fix must not overwrite 18.51", stored.Latitude)
+	}
+	if stored.DistanceTraveled < 1.1 || stored.DistanceTraveled > 1.12 {
+		t.Errorf("distance = %.3f km, want about 1.11 km", stored.DistanceTraveled)
+	}
+	if stored.CreatedAt == 0 || stored.Snapshot == nil {
+		t.Errorf("stored vehicle misses created_at or the snapshot %+v", stored)
+	}
+}
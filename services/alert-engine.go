@@ -0,0 +1,554 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the limits that applied before alert_config documents were required
+const (
+	defaultOverspeedLimit    = 60
+	defaultFallAngleLimit    = 135
+	defaultFallMinAngleLimit = 45
+)
+
+// ErrInvalidAlertRule is wrapped by every rule validation error
+var ErrInvalidAlertRule = errors.New("invalid alert rule")
+
+const (
+	RuleFired   = "fired"   // the condition just started to hold (after its duration)
+	RuleOngoing = "ongoing" // the rule fired earlier and still holds
+	RuleCleared = "cleared" // the rule was active and the condition is gone
+)
+
+// RuleResult is what one rule says about one subject at one point in time
+type RuleResult struct {
+	Rule        models.AlertConfig
+	SubjectType string
+	SubjectId   string
+	Value       float64
+	Time        time.Time
+	Status      string
+}
+
+// vehicle rule fields on top of the snapshot fields
+const (
+	RuleFieldAnyDoorOpen = "any_door_open"
+	RuleFieldMoving      = "moving"
+)
+
+// battery rule fields, values are converted to volts, degrees etc.
+const (
+	RuleFieldBatterySoc         = "battery_soc"
+	RuleFieldBatteryVoltage     = "battery_voltage"
+	RuleFieldBatteryCurrent     = "battery_current"
+	RuleFieldBatteryTemperature = "battery_temperature"
+	RuleFieldIotTemperature     = "iot_temperature"
+	RuleFieldBatterySpeed       = "location_speed"
+	RuleFieldBatteryCycleCount  = "battery_cycle_count"
+	RuleFieldRemainingCapacity  = "battery_remaining_capacity"
+	RuleFieldGsmSignalStrength  = "gsm_signal_strength"
+	RuleFieldGpsSignalStrength  = "gps_signal_strength"
+)
+
+var vehicleRuleFields = map[string]bool{
+	models.FieldSpeed: true, models.FieldAngle: true, models.FieldLatitude: true, models.FieldLongitude: true,
+	models.FieldOdometer: true, models.FieldTemperature: true, models.FieldExternalVolt: true,
+	models.FieldBatteryPercentage: true, models.FieldIgnition: true, models.FieldPower: true, models.FieldAC: true,
+	models.FieldSOS: true, models.FieldImmobilized: true, models.FieldDoor1: true, models.FieldDoor2: true,
+	models.FieldDoor3: true, models.FieldDoor4: true, RuleFieldAnyDoorOpen: true, RuleFieldMoving: true,
+}
+
+var batteryRuleFields = map[string]bool{
+	RuleFieldBatterySoc: true, RuleFieldBatteryVoltage: true, RuleFieldBatteryCurrent: true,
+	RuleFieldBatteryTemperature: true, RuleFieldIotTemperature: true, RuleFieldBatterySpeed: true,
+	RuleFieldBatteryCycleCount: true, RuleFieldRemainingCapacity: true, RuleFieldGsmSignalStrength: true,
+	RuleFieldGpsSignalStrength: true,
+}
+
+// AlertEngine evaluates the alert_config rules. It keeps per rule and subject
+// state in memory so durations and hysteresis work across refreshes.
+type AlertEngine interface {
+	// SetRules swaps the rule set, state of rules that are still present is kept
+	SetRules(configs []models.AlertConfig) []error
+	Rules() []models.AlertConfig
+	EvaluateVehicle(vehicleNo string, snapshot models.VehicleSnapshot) []RuleResult
+	EvaluateBattery(battery models.BatteryHardwareMain, at time.Time) []RuleResult
+	// Restore marks the rule of a live incident active for its subject, so
+	// the next reading that doesn't hold clears it. It returns false when no
+	// current rule raised the incident.
+	Restore(incident models.AlertIncident) bool
+}
+
+type ruleState struct {
+	since  time.Time
+	active bool
+}
+
+type alertengine struct {
+	mu    sync.Mutex
+	rules []models.AlertConfig
+	state map[string]*ruleState
+	// alert types running on a built in rule, logged when that changes
+	builtIn map[string]bool
+}
+
+// NewAlertEngine starts with the built in overspeed and fall rules until
+// the first SetRules
+func NewAlertEngine() AlertEngine {
+	engine := &alertengine{state: map[string]*ruleState{}}
+	engine.SetRules(nil)
+	return engine
+}
+
+// NormalizeAlertConfig turns an alert_config document into a rule, documents
+// from before the rule engine only know the overspeed and fall limits
+func NormalizeAlertConfig(config models.AlertConfig) (models.AlertConfig, error) {
+	if config.Field == "" {
+		switch config.AlertType {
+		case models.AlertTypeOverspeed:
+			config.Source = models.AlertSourceVehicle
+			config.Field = models.FieldSpeed
+			config.Operator = models.AlertOperatorGTE
+			config.Threshold = float64(config.MaxLimit)
+			config.OnlyWhenMoving = true
+		case models.AlertTypeFall:
+			// documents without a min_limit get the lower angle of the built in rule
+			if config.MinLimit == 0 {
+				config.MinLimit = defaultFallMinAngleLimit
+			}
+			config.Source = models.AlertSourceVehicle
+			config.Field = models.FieldAngle
+			config.Operator = models.AlertOperatorOutside
+			config.MinThreshold = float64(config.MinLimit)
+			config.MaxThreshold = float64(config.MaxLimit)
+			config.OnlyWhenMoving = true
+		default:
+			return config, fmt.Errorf("%w : alert %q has no field", ErrInvalidAlertRule, config.AlertType)
+		}
+	}
+
+	if config.Severity == "" {
+		config.Severity = models.AlertSeverityWarning
+	}
+	return config, ValidateAlertRule(config)
+}
+
+// ValidateAlertRule checks a normalized rule
+func ValidateAlertRule(config models.AlertConfig) error {
+	var problems []string
+
+	if strings.TrimSpace(config.AlertType) == "" {
+		problems = append(problems, "alert_type is required")
+	}
+
+	switch config.Source {
+	case models.AlertSourceVehicle:
+		if !vehicleRuleFields[config.Field] {
+			problems = append(problems, fmt.Sprintf("field %q is not a vehicle field", config.Field))
+		}
+	case models.AlertSourceBattery:
+		if !batteryRuleFields[config.Field] {
+			problems = append(problems, fmt.Sprintf("field %q is not a battery field", config.Field))
+		}
+		if config.OnlyWhenMoving {
+			problems = append(problems, "only_when_moving is only supported for vehicle rules")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("source %q has to be vehicle or battery", config.Source))
+	}
+
+	switch config.Operator {
+	case models.AlertOperatorGT, models.AlertOperatorGTE, models.AlertOperatorLT, models.AlertOperatorLTE,
+		models.AlertOperatorEQ, models.AlertOperatorNEQ, models.AlertOperatorIsTrue, models.AlertOperatorIsFalse:
+	case models.AlertOperatorBetween, models.AlertOperatorOutside:
+		if config.MinThreshold > config.MaxThreshold {
+			problems = append(problems, "min_threshold can not be above max_threshold")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("operator %q is not supported", config.Operator))
+	}
+
+	switch config.Severity {
+	case models.AlertSeverityInfo, models.AlertSeverityWarning, models.AlertSeverityCritical:
+	default:
+		problems = append(problems, fmt.Sprintf("severity %q has to be info, warning or critical", config.Severity))
+	}
+
+	if config.DurationSeconds < 0 || config.Hysteresis < 0 {
+		problems = append(problems, "duration_seconds and hysteresis can not be negative")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w : %s", ErrInvalidAlertRule, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// SetRules normalizes configs, invalid and disabled ones are left out. When
+// no overspeed or fall rule is configured the old built in limits apply.
+func (e *alertengine) SetRules(configs []models.AlertConfig) []error {
+	var errs []error
+	rules := []models.AlertConfig{}
+	seen := map[string]bool{}
+
+	for i := range configs {
+		seen[configs[i].AlertType] = true
+		if configs[i].Disabled {
+			continue
+		}
+
+		rule, err := NormalizeAlertConfig(configs[i])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	builtIn := map[string]bool{}
+	for _, fallback := range []models.AlertConfig{
+		{AlertType: models.AlertTypeOverspeed, MaxLimit: defaultOverspeedLimit},
+		{AlertType: models.AlertTypeFall, MinLimit: defaultFallMinAngleLimit, MaxLimit: defaultFallAngleLimit},
+	} {
+		if seen[fallback.AlertType] {
+			continue
+		}
+		rule, _ := NormalizeAlertConfig(fallback)
+		rule.BuiltIn = true
+		rules = append(rules, rule)
+		builtIn[rule.AlertType] = true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for alertType := range builtIn {
+		if !e.builtIn[alertType] {
+			logger.From(context.Background()).WithField("alert_type", alertType).Info("no rule in alert_config, using the built in limit")
+		}
+	}
+	for alertType := range e.builtIn {
+		if !builtIn[alertType] {
+			logger.From(context.Background()).WithField("alert_type", alertType).Info("using the rule from alert_config instead of the built in limit")
+		}
+	}
+	e.builtIn = builtIn
+	e.rules = rules
+
+	// forget state of rules that are gone so a re-added rule starts clean
+	keep := map[string]bool{}
+	for i := range rules {
+		keep[ruleKey(rules[i])] = true
+	}
+	for key := range e.state {
+		if !keep[strings.SplitN(key, "|", 2)[0]] {
+			delete(e.state, key)
+		}
+	}
+
+	return errs
+}
+
+func (e *alertengine) Rules() []models.AlertConfig {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := make([]models.AlertConfig, len(e.rules))
+	copy(rules, e.rules)
+	return rules
+}
+
+func (e *alertengine) EvaluateVehicle(vehicleNo string, snapshot models.VehicleSnapshot) []RuleResult {
+	lookup := func(field string) (float64, bool) {
+		return vehicleFieldValue(snapshot, field)
+	}
+	return e.evaluate(models.AlertSourceVehicle, vehicleNo, snapshot.FixTime(), snapshot.Running, lookup)
+}
+
+func (e *alertengine) EvaluateBattery(battery models.BatteryHardwareMain, at time.Time) []RuleResult {
+	lookup := func(field string) (float64, bool) {
+		return batteryFieldValue(battery, field)
+	}
+	return e.evaluate(models.AlertSourceBattery, battery.BmsID, at, battery.LocationSpeed > 0, lookup)
+}
+
+func (e *alertengine) Restore(incident models.AlertIncident) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.rules {
+		rule := e.rules[i]
+		if rule.Source != incident.SubjectType || !raisedBy(incident, rule) {
+			continue
+		}
+
+		key := ruleKey(rule) + "|" + incident.SubjectId
+		state := e.state[key]
+		if state == nil {
+			state = &ruleState{}
+			e.state[key] = state
+		}
+		if !state.active {
+			state.active = true
+			state.since = incident.StartedAt
+		}
+		return true
+	}
+	return false
+}
+
+// raisedBy matches incidents by rule id, built in rules have none
+func raisedBy(incident models.AlertIncident, rule models.AlertConfig) bool {
+	if rule.Id.IsZero() {
+		return incident.RuleId.IsZero() && incident.AlertType == rule.AlertType
+	}
+	return incident.RuleId == rule.Id
+}
+
+func (e *alertengine) evaluate(source, subjectId string, at time.Time, moving bool, lookup func(string) (float64, bool)) []RuleResult {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	results := []RuleResult{}
+
+	for i := range e.rules {
+		rule := e.rules[i]
+		if rule.Source != source {
+			continue
+		}
+
+		value, ok := lookup(rule.Field)
+		// a value we could not read must not raise (or clear) an alert
+		if !ok {
+			continue
+		}
+
+		key := ruleKey(rule) + "|" + subjectId
+		state := e.state[key]
+		if state == nil {
+			state = &ruleState{}
+			e.state[key] = state
+		}
+
+		var holds bool
+		if state.active {
+			holds = !ruleCleared(rule, value)
+		} else {
+			holds = ruleMatches(rule, value)
+		}
+		if rule.OnlyWhenMoving && !moving {
+			holds = false
+		}
+
+		result := RuleResult{Rule: rule, SubjectType: source, SubjectId: subjectId, Value: value, Time: at}
+
+		switch {
+		case holds && state.active:
+			result.Status = RuleOngoing
+		case holds:
+			if state.since.IsZero() {
+				state.since = at
+			}
+			if at.Sub(state.since) < time.Duration(rule.DurationSeconds)*time.Second {
+				continue
+			}
+			state.active = true
+			result.Status = RuleFired
+		case state.active:
+			state.active = false
+			state.since = time.Time{}
+			result.Status = RuleCleared
+		default:
+			state.since = time.Time{}
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func ruleMatches(rule models.AlertConfig, value float64) bool {
+	switch rule.Operator {
+	case models.AlertOperatorGT:
+		return value > rule.Threshold
+	case models.AlertOperatorGTE:
+		return value >= rule.Threshold
+	case models.AlertOperatorLT:
+		return value < rule.Threshold
+	case models.AlertOperatorLTE:
+		return value <= rule.Threshold
+	case models.AlertOperatorEQ:
+		return value == rule.Threshold
+	case models.AlertOperatorNEQ:
+		return value != rule.Threshold
+	case models.AlertOperatorBetween:
+		return value >= rule.MinThreshold && value <= rule.MaxThreshold
+	case models.AlertOperatorOutside:
+		return value < rule.MinThreshold || value > rule.MaxThreshold
+	case models.AlertOperatorIsTrue:
+		return value != 0
+	case models.AlertOperatorIsFalse:
+		return value == 0
+	default:
+		return false
+	}
+}
+
+// ruleCleared applies the hysteresis band to an active rule
+func ruleCleared(rule models.AlertConfig, value float64) bool {
+	h := rule.Hysteresis
+
+	switch rule.Operator {
+	case models.AlertOperatorGT, models.AlertOperatorGTE:
+		return value < rule.Threshold-h
+	case models.AlertOperatorLT, models.AlertOperatorLTE:
+		return value > rule.Threshold+h
+	case models.AlertOperatorBetween:
+		return value < rule.MinThreshold-h || value > rule.MaxThreshold+h
+	case models.AlertOperatorOutside:
+		return value > rule.MinThreshold+h && value < rule.MaxThreshold-h
+	default:
+		return !ruleMatches(rule, value)
+	}
+}
+
+func ruleKey(rule models.AlertConfig) string {
+	if rule.Id.IsZero() {
+		return "default:" + rule.AlertType
+	}
+	return rule.Id.Hex()
+}
+
+func vehicleFieldValue(snapshot models.VehicleSnapshot, field string) (float64, bool) {
+	switch field {
+	case RuleFieldMoving:
+		return boolValue(snapshot.Running), true
+	case RuleFieldAnyDoorOpen:
+		known := false
+		for _, door := range []string{models.FieldDoor1, models.FieldDoor2, models.FieldDoor3, models.FieldDoor4} {
+			known = known || snapshot.Valid(door)
+		}
+		open := snapshot.Door1 || snapshot.Door2 || snapshot.Door3 || snapshot.Door4
+		return boolValue(open), known
+	}
+
+	if !snapshot.Valid(field) {
+		return 0, false
+	}
+
+	switch field {
+	case models.FieldSpeed:
+		return snapshot.Speed, true
+	case models.FieldAngle:
+		return snapshot.Angle, true
+	case models.FieldLatitude:
+		return snapshot.Latitude, true
+	case models.FieldLongitude:
+		return snapshot.Longitude, true
+	case models.FieldOdometer:
+		return snapshot.Odometer, true
+	case models.FieldTemperature:
+		return snapshot.Temperature, true
+	case models.FieldExternalVolt:
+		return snapshot.ExternalVolt, true
+	case models.FieldBatteryPercentage:
+		return snapshot.BatteryPercentage, true
+	case models.FieldIgnition:
+		return boolValue(snapshot.Ignition), true
+	case models.FieldPower:
+		return boolValue(snapshot.Power), true
+	case models.FieldAC:
+		return boolValue(snapshot.AC), true
+	case models.FieldSOS:
+		return boolValue(snapshot.SOS), true
+	case models.FieldImmobilized:
+		return boolValue(snapshot.Immobilized), true
+	case models.FieldDoor1:
+		return boolValue(snapshot.Door1), true
+	case models.FieldDoor2:
+		return boolValue(snapshot.Door2), true
+	case models.FieldDoor3:
+		return boolValue(snapshot.Door3), true
+	case models.FieldDoor4:
+		return boolValue(snapshot.Door4), true
+	default:
+		return 0, false
+	}
+}
+
+// batteryFieldValue reads the raw battery_temp record, the same unit
+// conversions as AddBatteryToMain are applied
+func batteryFieldValue(battery models.BatteryHardwareMain, field string) (float64, bool) {
+	switch field {
+	case RuleFieldBatterySoc:
+		return float64(battery.BatterySoc), true
+	case RuleFieldBatteryVoltage:
+		return battery.FormatByThousand(battery.BatteryVoltage), true
+	case RuleFieldBatteryCurrent:
+		return float64(battery.BatteryCurrent), true
+	case RuleFieldIotTemperature:
+		return battery.FormatByHundred(battery.IotTemperature), true
+	case RuleFieldBatteryTemperature:
+		return maxNumber(battery.BatteryTemperature)
+	case RuleFieldBatterySpeed:
+		return float64(battery.LocationSpeed), true
+	case RuleFieldBatteryCycleCount:
+		return float64(battery.BatteryCycleCount), true
+	case RuleFieldRemainingCapacity:
+		return float64(battery.BatteryRemainingCapacity), true
+	case RuleFieldGsmSignalStrength:
+		return float64(battery.GsmSignalStrength), true
+	case RuleFieldGpsSignalStrength:
+		return float64(battery.GpsSignalStrength), true
+	default:
+		return 0, false
+	}
+}
+
+// maxNumber finds the hottest sensor, battery_temperature is stored as
+// whatever the BMS sent: a single number or a list of them
+func maxNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case primitive.A:
+		return maxNumber([]interface{}(v))
+	case []interface{}:
+		found := false
+		highest := math.Inf(-1)
+		for i := range v {
+			if n, ok := maxNumber(v[i]); ok {
+				found = true
+				highest = math.Max(highest, n)
+			}
+		}
+		return highest, found
+	default:
+		return 0, false
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNormalizeAlertConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  models.AlertConfig
+		want    models.AlertConfig
+		wantErr bool
+	}{
+		{
+			name:   "legacy overspeed",
+			config: models.AlertConfig{AlertType: models.AlertTypeOverspeed, MaxLimit: 80},
+			want: models.AlertConfig{Source: models.AlertSourceVehicle, Field: models.FieldSpeed, Operator: models.AlertOperatorGTE,
+				Threshold: 80, OnlyWhenMoving: true, Severity: models.AlertSeverityWarning},
+		},
+		{
+			name:   "legacy fall with both limits",
+			config: models.AlertConfig{AlertType: models.AlertTypeFall, MinLimit: 30, MaxLimit: 150},
+			want: models.AlertConfig{Source: models.AlertSourceVehicle, Field: models.FieldAngle, Operator: models.AlertOperatorOutside,
+				MinThreshold: 30, MaxThreshold: 150, OnlyWhenMoving: true, Severity: models.AlertSeverityWarning},
+		},
+		{
+			name:   "legacy fall without min limit",
+			config: models.AlertConfig{AlertType: models.AlertTypeFall, MaxLimit: 135},
+			want: models.AlertConfig{Source: models.AlertSourceVehicle, Field: models.FieldAngle, Operator: models.AlertOperatorOutside,
+				MinThreshold: defaultFallMinAngleLimit, MaxThreshold: 135, OnlyWhenMoving: true, Severity: models.AlertSeverityWarning},
+		},
+		{
+			name: "rule keeps its severity",
+			config: models.AlertConfig{AlertType: "low_soc", Source: models.AlertSourceBattery, Field: RuleFieldBatterySoc,
+				Operator: models.AlertOperatorLT, Threshold: 20, Severity: models.AlertSeverityCritical},
+			want: models.AlertConfig{Source: models.AlertSourceBattery, Field: RuleFieldBatterySoc, Operator: models.AlertOperatorLT,
+				Threshold: 20, Severity: models.AlertSeverityCritical},
+		},
+		{
+			name:    "unknown legacy type",
+			config:  models.AlertConfig{AlertType: "harsh_braking", MaxLimit: 10},
+			wantErr: true,
+		},
+		{
+			name:    "battery field on a vehicle rule",
+			config:  models.AlertConfig{AlertType: "hot", Source: models.AlertSourceVehicle, Field: RuleFieldBatteryTemperature, Operator: models.AlertOperatorGT},
+			wantErr: true,
+		},
+		{
+			name:    "only when moving on a battery rule",
+			config:  models.AlertConfig{AlertType: "hot", Source: models.AlertSourceBattery, Field: RuleFieldBatteryTemperature, Operator: models.AlertOperatorGT, OnlyWhenMoving: true},
+			wantErr: true,
+		},
+		{
+			name:    "inverted band",
+			config:  models.AlertConfig{AlertType: "tilt", Source: models.AlertSourceVehicle, Field: models.FieldAngle, Operator: models.AlertOperatorBetween, MinThreshold: 10, MaxThreshold: 5},
+			wantErr: true,
+		},
+		{
+			name:    "negative hysteresis",
+			config:  models.AlertConfig{AlertType: "fast", Source: models.AlertSourceVehicle, Field: models.FieldSpeed, Operator: models.AlertOperatorGT, Hysteresis: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NormalizeAlertConfig(test.config)
+
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidAlertRule) {
+					t.Fatalf("err = %v, want ErrInvalidAlertRule", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got.Source != test.want.Source || got.Field != test.want.Field || got.Operator != test.want.Operator ||
+				got.Threshold != test.want.Threshold || got.MinThreshold != test.want.MinThreshold ||
+				got.MaxThreshold != test.want.MaxThreshold || got.OnlyWhenMoving != test.want.OnlyWhenMoving ||
+				got.Severity != test.want.Severity {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAlertEngineBuiltInRules(t *testing.T) {
+	engine := NewAlertEngine()
+
+	types := map[string]bool{}
+	for _, rule := range engine.Rules() {
+		if !rule.BuiltIn {
+			t.Errorf("%s should be built in", rule.AlertType)
+		}
+		types[rule.AlertType] = true
+	}
+	if !types[models.AlertTypeOverspeed] || !types[models.AlertTypeFall] || len(types) != 2 {
+		t.Fatalf("built in rules = %v, want overspeed and fall", types)
+	}
+
+	// a configured rule, even a disabled one, replaces the built in limit
+	engine.SetRules([]models.AlertConfig{{AlertType: models.AlertTypeOverspeed, MaxLimit: 80, Disabled: true}})
+	for _, rule := range engine.Rules() {
+		if rule.AlertType == models.AlertTypeOverspeed {
+			t.Errorf("disabled overspeed rule should leave no overspeed rule, got %+v", rule)
+		}
+	}
+
+	if errs := engine.SetRules([]models.AlertConfig{{AlertType: "broken"}}); len(errs) != 1 {
+		t.Errorf("SetRules errors = %v, want one for the broken rule", errs)
+	}
+}
+
+func TestAlertEngineFallAngle(t *testing.T) {
+	engine := NewAlertEngine()
+	engine.SetRules([]models.AlertConfig{{AlertType: models.AlertTypeOverspeed, MaxLimit: 1000}})
+	start := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		angle float64
+		want  string
+	}{
+		{90, ""},
+		{30, RuleFired},
+		{90, RuleCleared},
+		{140, RuleFired},
+	}
+
+	for i, test := range tests {
+		snapshot := models.VehicleSnapshot{Angle: test.angle, Running: true, ReceivedAt: start.Add(time.Duration(i) * time.Minute)}
+		got := ""
+		for _, result := range engine.EvaluateVehicle("MH12", snapshot) {
+			if result.Rule.AlertType == models.AlertTypeFall {
+				got = result.Status
+			}
+		}
+		if got != test.want {
+			t.Errorf("angle %v: status = %q, want %q", test.angle, got, test.want)
+		}
+	}
+}
+
+func TestAlertEngineHysteresisAndDuration(t *testing.T) {
+	engine := NewAlertEngine()
+	engine.SetRules([]models.AlertConfig{
+		{AlertType: models.AlertTypeOverspeed, MaxLimit: 1000},
+		{AlertType: models.AlertTypeFall, MaxLimit: 1000},
+		{
+			AlertType: "battery_speeding", Source: models.AlertSourceBattery, Field: RuleFieldBatterySpeed,
+			Operator: models.AlertOperatorGT, Threshold: 50, Hysteresis: 5, DurationSeconds: 60,
+		},
+	})
+	start := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		value int
+		want  string
+	}{
+		{"below the threshold", 0, 40, ""},
+		{"over but not long enough", time.Minute, 55, ""},
+		{"still over after the duration", 2 * time.Minute, 56, RuleFired},
+		{"inside the hysteresis band", 3 * time.Minute, 48, RuleOngoing},
+		{"below the band", 4 * time.Minute, 44, RuleCleared},
+		{"over again restarts the duration", 5 * time.Minute, 60, ""},
+		{"dip resets the duration", 5*time.Minute + 30*time.Second, 40, ""},
+		{"over again", 6 * time.Minute, 60, ""},
+		{"fires after a full duration", 7 * time.Minute, 60, RuleFired},
+	}
+
+	for _, test := range tests {
+		battery := models.BatteryHardwareMain{BmsID: "BMS1", LocationSpeed: test.value}
+		results := engine.EvaluateBattery(battery, start.Add(test.after))
+
+		got := ""
+		if len(results) > 0 {
+			got = results[0].Status
+		}
+		if got != test.want {
+			t.Errorf("%s: status = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAlertEngineOnlyWhenMoving(t *testing.T) {
+	engine := NewAlertEngine()
+	start := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	parked := models.VehicleSnapshot{Speed: 90, Angle: 90, ReceivedAt: start}
+	if results := engine.EvaluateVehicle("MH12", parked); len(results) != 0 {
+		t.Errorf("a parked vehicle should not raise %v", results)
+	}
+
+	moving := models.VehicleSnapshot{Speed: 90, Angle: 90, Running: true, ReceivedAt: start.Add(time.Minute)}
+	results := engine.EvaluateVehicle("MH12", moving)
+	if len(results) != 1 || results[0].Rule.AlertType != models.AlertTypeOverspeed || results[0].Status != RuleFired {
+		t.Errorf("results = %+v, want overspeed fired", results)
+	}
+
+	// an unparsable speed neither fires nor clears
+	unknown := models.VehicleSnapshot{Angle: 90, Running: true, ReceivedAt: start.Add(2 * time.Minute),
+		ParseErrors: []models.FieldParseError{{Field: models.FieldSpeed, Reason: models.ParseReasonInvalid}}}
+	if results := engine.EvaluateVehicle("MH12", unknown); len(results) != 0 {
+		t.Errorf("an invalid speed should not change the alert, got %+v", results)
+	}
+}
+
+func TestAlertEngineRestore(t *testing.T) {
+	engine := NewAlertEngine()
+	start := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	overspeed := models.AlertIncident{AlertType: models.AlertTypeOverspeed, SubjectType: models.AlertSourceVehicle, SubjectId: "MH12", StartedAt: start}
+	if !engine.Restore(overspeed) {
+		t.Fatal("the built in overspeed rule should take the incident")
+	}
+	removed := models.AlertIncident{RuleId: primitive.NewObjectID(), AlertType: "low_soc", SubjectType: models.AlertSourceBattery, SubjectId: "BMS1"}
+	if engine.Restore(removed) {
+		t.Error("an incident of an unknown rule should not be restored")
+	}
+	wrongSource := overspeed
+	wrongSource.SubjectType = models.AlertSourceBattery
+	if engine.Restore(wrongSource) {
+		t.Error("a vehicle rule should not take a battery incident")
+	}
+
+	// the engine never saw the speed go up, the restored state still clears
+	slow := models.VehicleSnapshot{Speed: 20, Angle: 90, Running: true, GPSTime: start.Add(time.Minute)}
+	results := engine.EvaluateVehicle("MH12", slow)
+	if len(results) != 1 || results[0].Status != RuleCleared {
+		t.Fatalf("results = %+v, want overspeed cleared", results)
+	}
+
+	fast := models.VehicleSnapshot{Speed: 90, Angle: 90, Running: true, GPSTime: start.Add(2 * time.Minute)}
+	engine.EvaluateVehicle("MH12", fast)
+	if !engine.Restore(overspeed) {
+		t.Fatal("restoring an active rule should still match")
+	}
+	results = engine.EvaluateVehicle("MH12", fast)
+	if len(results) != 1 || results[0].Status != RuleOngoing {
+		t.Errorf("results = %+v, want overspeed ongoing", results)
+	}
+}
+
+func TestAlertEngineBatteryTemperature(t *testing.T) {
+	engine := NewAlertEngine()
+	if errs := engine.SetRules([]models.AlertConfig{{
+		AlertType:  models.AlertTypeBatteryTemperature,
+		Source:     models.AlertSourceBattery,
+		Field:      RuleFieldBatteryTemperature,
+		Operator:   models.AlertOperatorGTE,
+		Threshold:  55,
+		Hysteresis: 5,
+		Severity:   models.AlertSeverityCritical,
+	}}); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	start := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		temperature interface{}
+		want        string
+	}{
+		{nil, ""},
+		{primitive.A{int32(30), int32(41)}, ""},
+		{primitive.A{int32(30), int32(57)}, RuleFired},
+		{int32(52), RuleOngoing},
+		{primitive.A{int32(49), int32(45)}, RuleCleared},
+	}
+
+	for i, test := range tests {
+		battery := models.BatteryHardwareMain{BmsID: "BMS1", BatteryTemperature: test.temperature}
+		results := engine.EvaluateBattery(battery, start.Add(time.Duration(i)*time.Minute))
+
+		got := ""
+		for _, result := range results {
+			if result.Rule.AlertType != models.AlertTypeBatteryTemperature {
+				continue
+			}
+			got = result.Status
+			if result.Rule.Severity != models.AlertSeverityCritical {
+				t.Errorf("severity = %s, want critical", result.Rule.Severity)
+			}
+		}
+		if got != test.want {
+			t.Errorf("temperature %v: status = %q, want %q", test.temperature, got, test.want)
+		}
+	}
+}
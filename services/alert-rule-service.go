@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AlertRuleService manages the alert_config documents. Every change is
+// audited and reloaded into the engine right away.
+type AlertRuleService interface {
+	ListRules(ctx context.Context) ([]models.AlertConfig, error)
+	// ActiveRules are the rules the engine evaluates, built in fallbacks
+	// included
+	ActiveRules() []models.AlertConfig
+	GetRule(ctx context.Context, ruleId primitive.ObjectID) (models.AlertConfig, error)
+	CreateRule(ctx context.Context, actor string, rule models.AlertConfig) (models.AlertConfig, error)
+	UpdateRule(ctx context.Context, actor string, ruleId primitive.ObjectID, rule models.AlertConfig) (models.AlertConfig, error)
+	DeleteRule(ctx context.Context, actor string, ruleId primitive.ObjectID) error
+	GetRuleAudits(ctx context.Context, ruleId primitive.ObjectID, page models.PageRequest) ([]models.AlertRuleAudit, int64, error)
+}
+
+type alertruleservice struct {
+	alertRepository repositories.AlertRepository
+	alertService    AlertService
+	engine          AlertEngine
+}
+
+func NewAlertRuleService(repo repositories.AlertRepository, alertService AlertService, engine AlertEngine) AlertRuleService {
+	return &alertruleservice{
+		alertRepository: repo,
+		alertService:    alertService,
+		engine:          engine,
+	}
+}
+
+func (s *alertruleservice) ListRules(ctx context.Context) ([]models.AlertConfig, error) {
+	return s.alertRepository.GetAlertConfigs(ctx)
+}
+
+func (s *alertruleservice) ActiveRules() []models.AlertConfig {
+	return s.engine.Rules()
+}
+
+func (s *alertruleservice) GetRule(ctx context.Context, ruleId primitive.ObjectID) (models.AlertConfig, error) {
+	return s.alertRepository.GetAlertConfigById(ctx, ruleId)
+}
+
+func (s *alertruleservice) CreateRule(ctx context.Context, actor string, rule models.AlertConfig) (models.AlertConfig, error) {
+	rule, err := NormalizeAlertConfig(cleanRule(rule))
+	if err != nil {
+		return rule, err
+	}
+	rule.UpdatedBy = actor
+
+	if err := s.alertRepository.AddAlertConfig(ctx, &rule); err != nil {
+		return rule, err
+	}
+	s.audit(ctx, models.AlertRuleAudit{RuleId: rule.Id, AlertType: rule.AlertType, Action: models.AlertRuleCreated, Actor: actor, After: &rule})
+	return rule, nil
+}
+
+func (s *alertruleservice) UpdateRule(ctx context.Context, actor string, ruleId primitive.ObjectID, rule models.AlertConfig) (models.AlertConfig, error) {
+	before, err := s.alertRepository.GetAlertConfigById(ctx, ruleId)
+	if err != nil {
+		return rule, err
+	}
+
+	rule, err = NormalizeAlertConfig(cleanRule(rule))
+	if err != nil {
+		return rule, err
+	}
+	rule.Id = before.Id
+	rule.CreatedAt = before.CreatedAt
+	rule.UpdatedBy = actor
+
+	if err := s.alertRepository.SaveAlertConfig(ctx, &rule); err != nil {
+		return rule, err
+	}
+	s.audit(ctx, models.AlertRuleAudit{RuleId: rule.Id, AlertType: rule.AlertType, Action: models.AlertRuleUpdated, Actor: actor, Before: &before, After: &rule})
+	return rule, nil
+}
+
+func (s *alertruleservice) DeleteRule(ctx context.Context, actor string, ruleId primitive.ObjectID) error {
+	before, err := s.alertRepository.GetAlertConfigById(ctx, ruleId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.alertRepository.DeleteAlertConfig(ctx, ruleId); err != nil {
+		return err
+	}
+	s.audit(ctx, models.AlertRuleAudit{RuleId: ruleId, AlertType: before.AlertType, Action: models.AlertRuleDeleted, Actor: actor, Before: &before})
+	return nil
+}
+
+func (s *alertruleservice) GetRuleAudits(ctx context.Context, ruleId primitive.ObjectID, page models.PageRequest) ([]models.AlertRuleAudit, int64, error) {
+	return s.alertRepository.GetAlertRuleAudits(ctx, ruleId, page)
+}
+
+// audit stores the change and reloads the engine. The change itself is
+// already saved, so failures here are only logged.
+func (s *alertruleservice) audit(ctx context.Context, audit models.AlertRuleAudit) {
+	audit.Time = time.Now().UTC()
+	if err := s.alertRepository.AddAlertRuleAudit(ctx, audit); err != nil {
+		logger.From(ctx).WithError(err).Error("failed to audit the alert rule change")
+	}
+
+	if err := s.alertService.ReloadRules(ctx); err != nil {
+		logger.From(ctx).WithError(err).Warn("failed to reload the alert rules, the change applies with the next refresh")
+	}
+}
+
+// cleanRule drops the fields clients don't get to set
+func cleanRule(rule models.AlertConfig) models.AlertConfig {
+	rule.Id = primitive.NilObjectID
+	rule.BuiltIn = false
+	rule.UpdatedBy = ""
+	rule.CreatedAt = 0
+	rule.UpdatedAt = 0
+	return rule
+}
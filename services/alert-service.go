@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrIncidentResolved is returned when acknowledging or resolving an
+// incident that is already resolved
+var ErrIncidentResolved = errors.New("alert incident is already resolved")
+
+type AlertService interface {
+	// ReloadRules reads alert_config into the engine, broken rules are
+	// reported but don't stop the others. Live incidents are handed to the
+	// engine so they clear even when it didn't raise them itself (restart,
+	// failover), incidents of removed or disabled rules are resolved.
+	ReloadRules(ctx context.Context) error
+	EvaluateVehicle(vehicleNo string, snapshot models.VehicleSnapshot) []RuleResult
+	EvaluateBattery(battery models.BatteryHardwareMain, at time.Time) []RuleResult
+	// RecordResults opens, extends and auto-resolves incidents and writes
+	// every transition to the alert_events log
+	RecordResults(ctx context.Context, results []RuleResult) error
+
+	AcknowledgeIncident(ctx context.Context, incidentId primitive.ObjectID, actor, note string) (models.AlertIncident, error)
+	ResolveIncident(ctx context.Context, incidentId primitive.ObjectID, actor, note string) (models.AlertIncident, error)
+	GetIncidents(ctx context.Context, filter models.IncidentFilter, page models.PageRequest) ([]models.AlertIncident, int64, error)
+	GetIncident(ctx context.Context, incidentId primitive.ObjectID) (models.AlertIncident, error)
+	GetIncidentEvents(ctx context.Context, incidentId primitive.ObjectID) ([]models.AlertEvent, error)
+}
+
+type alertservice struct {
+	alertRepository repositories.AlertRepository
+	engine          AlertEngine
+	notifications   NotificationService
+	// a rule firing again this soon after its incident resolved reopens it
+	dedupWindow time.Duration
+}
+
+func NewAlertService(repo repositories.AlertRepository, engine AlertEngine, notifications NotificationService, dedupWindow time.Duration) AlertService {
+	return &alertservice{
+		alertRepository: repo,
+		engine:          engine,
+		notifications:   notifications,
+		dedupWindow:     dedupWindow,
+	}
+}
+
+func (s *alertservice) ReloadRules(ctx context.Context) error {
+	configs, err := s.alertRepository.GetAlertConfigs(ctx)
+	if err != nil {
+		return fmt.Errorf("load alert rules : %w", err)
+	}
+
+	for _, ruleErr := range s.engine.SetRules(configs) {
+		logger.From(ctx).WithError(ruleErr).Warn("skipping alert rule")
+	}
+
+	// the new rules apply either way, the next reload tries again
+	if err := s.restoreIncidents(ctx); err != nil {
+		logger.From(ctx).WithError(err).Error("failed to restore the live alert incidents")
+	}
+	return nil
+}
+
+func (s *alertservice) restoreIncidents(ctx context.Context) error {
+	incidents, err := s.alertRepository.GetLiveIncidents(ctx)
+	if err != nil {
+		return err
+	}
+
+	events := []models.AlertEvent{}
+	now := time.Now().UTC()
+	for i := range incidents {
+		incident := incidents[i]
+		// state alerts clear on the next transition, not through the engine
+		if stateAlert(incident.AlertType) || s.engine.Restore(incident) {
+			continue
+		}
+
+		incident.Status = models.IncidentStatusResolved
+		incident.EndedAt = now
+		incident.ResolvedAt = now
+		incident.ResolvedBy = models.IncidentResolvedBySystem
+		if err := s.alertRepository.SaveIncident(ctx, &incident); err != nil {
+			return err
+		}
+		events = append(events, incidentEvent(incident, models.AlertEventCleared, models.IncidentResolvedBySystem, "the alert rule was removed or disabled", now))
+	}
+
+	if err := s.alertRepository.AddAlertEvents(ctx, events); err != nil {
+		return err
+	}
+	if err := s.notifications.NotifyAlertEvents(ctx, events); err != nil {
+		logger.From(ctx).WithError(err).Error("failed to notify alert events")
+	}
+	return nil
+}
+
+func (s *alertservice) EvaluateVehicle(vehicleNo string, snapshot models.VehicleSnapshot) []RuleResult {
+	return s.engine.EvaluateVehicle(vehicleNo, snapshot)
+}
+
+func (s *alertservice) EvaluateBattery(battery models.BatteryHardwareMain, at time.Time) []RuleResult {
+	return s.engine.EvaluateBattery(battery, at)
+}
+
+func (s *alertservice) RecordResults(ctx context.Context, results []RuleResult) error {
+	events := []models.AlertEvent{}
+	var errs []error
+
+	for i := range results {
+		applied, err := s.applyResult(ctx, results[i])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		events = append(events, applied...)
+	}
+
+	if err := s.alertRepository.AddAlertEvents(ctx, events); err != nil {
+		errs = append(errs, err)
+	}
+
+	// a notification that could not be queued must not fail the alert run
+	if err := s.notifications.NotifyAlertEvents(ctx, events); err != nil {
+		logger.From(ctx).WithError(err).Error("failed to notify alert events")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("record %d alert results failed, first error : %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// applyResult moves the incident of the result's rule and subject along and
+// returns the events to log, ongoing readings only update the incident
+func (s *alertservice) applyResult(ctx context.Context, result RuleResult) ([]models.AlertEvent, error) {
+	rule := result.Rule
+
+	incident, err := s.alertRepository.FindLatestIncident(ctx, rule.Id, rule.AlertType, result.SubjectType, result.SubjectId)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	found := err == nil
+	live := found && incident.Status != models.IncidentStatusResolved
+
+	events := []models.AlertEvent{}
+	eventName := ""
+
+	// an incident nobody has seen for longer than the de-dup window was left
+	// open by a restart, close it where it was last seen
+	if live && result.Status == RuleFired && result.Time.Sub(incident.LastSeenAt) > s.dedupWindow {
+		incident.Status = models.IncidentStatusResolved
+		incident.EndedAt = incident.LastSeenAt
+		incident.ResolvedAt = result.Time
+		incident.ResolvedBy = models.IncidentResolvedBySystem
+		if err := s.alertRepository.SaveIncident(ctx, &incident); err != nil {
+			return nil, err
+		}
+		events = append(events, incidentEvent(incident, models.AlertEventCleared, models.IncidentResolvedBySystem, "", incident.LastSeenAt))
+		found, live = false, false
+	}
+
+	switch result.Status {
+	case RuleFired:
+		switch {
+		case live:
+			// the engine lost its state (restart, rule reload), keep the episode going
+		case found && result.Time.Sub(incident.EndedAt) <= s.dedupWindow:
+			incident.Status = models.IncidentStatusOpen
+			incident.EndedAt = time.Time{}
+			incident.AcknowledgedBy = ""
+			incident.AcknowledgedAt = time.Time{}
+			incident.ResolvedAt = time.Time{}
+			incident.ResolvedBy = ""
+			incident.Occurrences++
+			eventName = models.AlertEventReopened
+		default:
+			incident = models.AlertIncident{
+				RuleId:      rule.Id,
+				AlertType:   rule.AlertType,
+				Severity:    rule.Severity,
+				SubjectType: result.SubjectType,
+				SubjectId:   result.SubjectId,
+				Field:       rule.Field,
+				Status:      models.IncidentStatusOpen,
+				StartedAt:   result.Time,
+				PeakValue:   result.Value,
+				Occurrences: 1,
+			}
+			eventName = models.AlertEventFired
+		}
+	case RuleOngoing:
+		if !live {
+			// resolved by hand while the condition still holds
+			return events, nil
+		}
+	case RuleCleared:
+		if !live {
+			return events, nil
+		}
+		incident.Status = models.IncidentStatusResolved
+		incident.EndedAt = result.Time
+		incident.ResolvedAt = result.Time
+		incident.ResolvedBy = models.IncidentResolvedBySystem
+		eventName = models.AlertEventCleared
+	default:
+		return events, nil
+	}
+
+	if result.Status != RuleCleared {
+		incident.LastSeenAt = result.Time
+		incident.LastValue = result.Value
+		incident.PeakValue = peakValue(rule, incident.PeakValue, result.Value)
+	}
+
+	if err := s.alertRepository.SaveIncident(ctx, &incident); err != nil {
+		return events, err
+	}
+
+	if eventName != "" {
+		event := incidentEvent(incident, eventName, models.IncidentResolvedBySystem, "", result.Time)
+		event.Value = result.Value
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (s *alertservice) AcknowledgeIncident(ctx context.Context, incidentId primitive.ObjectID, actor, note string) (models.AlertIncident, error) {
+	incident, err := s.alertRepository.GetIncidentById(ctx, incidentId)
+	if err != nil {
+		return incident, err
+	}
+	if incident.Status == models.IncidentStatusResolved {
+		return incident, ErrIncidentResolved
+	}
+
+	now := time.Now().UTC()
+	incident.Status = models.IncidentStatusAcknowledged
+	incident.AcknowledgedBy = actor
+	incident.AcknowledgedAt = now
+
+	return incident, s.saveWithEvent(ctx, &incident, models.AlertEventAcknowledged, actor, note, now)
+}
+
+func (s *alertservice) ResolveIncident(ctx context.Context, incidentId primitive.ObjectID, actor, note string) (models.AlertIncident, error) {
+	incident, err := s.alertRepository.GetIncidentById(ctx, incidentId)
+	if err != nil {
+		return incident, err
+	}
+	if incident.Status == models.IncidentStatusResolved {
+		return incident, ErrIncidentResolved
+	}
+
+	now := time.Now().UTC()
+	incident.Status = models.IncidentStatusResolved
+	incident.EndedAt = now
+	incident.ResolvedBy = actor
+	incident.ResolvedAt = now
+
+	return incident, s.saveWithEvent(ctx, &incident, models.AlertEventResolved, actor, note, now)
+}
+
+func (s *alertservice) saveWithEvent(ctx context.Context, incident *models.AlertIncident, eventName, actor, note string, at time.Time) error {
+	if err := s.alertRepository.SaveIncident(ctx, incident); err != nil {
+		return err
+	}
+
+	return s.alertRepository.AddAlertEvents(ctx, []models.AlertEvent{
+		incidentEvent(*incident, eventName, actor, note, at),
+	})
+}
+
+func incidentEvent(incident models.AlertIncident, eventName, actor, note string, at time.Time) models.AlertEvent {
+	return models.AlertEvent{
+		IncidentId:  incident.Id,
+		RuleId:      incident.RuleId,
+		AlertType:   incident.AlertType,
+		Severity:    incident.Severity,
+		SubjectType: incident.SubjectType,
+		SubjectId:   incident.SubjectId,
+		Field:       incident.Field,
+		Value:       incident.LastValue,
+		Event:       eventName,
+		Actor:       actor,
+		Note:        note,
+		Time:        at,
+	}
+}
+
+func (s *alertservice) GetIncidents(ctx context.Context, filter models.IncidentFilter, page models.PageRequest) ([]models.AlertIncident, int64, error) {
+	return s.alertRepository.GetIncidents(ctx, filter, page)
+}
+
+func (s *alertservice) GetIncident(ctx context.Context, incidentId primitive.ObjectID) (models.AlertIncident, error) {
+	return s.alertRepository.GetIncidentById(ctx, incidentId)
+}
+
+func (s *alertservice) GetIncidentEvents(ctx context.Context, incidentId primitive.ObjectID) ([]models.AlertEvent, error) {
+	return s.alertRepository.GetIncidentEvents(ctx, incidentId)
+}
+
+// peakValue keeps the worst reading, for lower limits that is the smallest
+func peakValue(rule models.AlertConfig, peak, value float64) float64 {
+	switch rule.Operator {
+	case models.AlertOperatorLT, models.AlertOperatorLTE:
+		return math.Min(peak, value)
+	case models.AlertOperatorOutside:
+		if math.Max(rule.MinThreshold-value, value-rule.MaxThreshold) > math.Max(rule.MinThreshold-peak, peak-rule.MaxThreshold) {
+			return value
+		}
+		return peak
+	default:
+		return math.Max(peak, value)
+	}
+}
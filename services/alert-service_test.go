@@ -0,0 +1,454 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fakeAlertRepository keeps the rules, incidents and events in memory, the
+// methods the alert service doesn't use do nothing
+type fakeAlertRepository struct {
+	configs   []models.AlertConfig
+	incidents []models.AlertIncident
+	events    []models.AlertEvent
+}
+
+func (f *fakeAlertRepository) EnsureIndexes(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeAlertRepository) GetAlertConfigs(ctx context.Context) ([]models.AlertConfig, error) {
+	return f.configs, nil
+}
+
+func (f *fakeAlertRepository) GetAlertConfigById(ctx context.Context, ruleId primitive.ObjectID) (models.AlertConfig, error) {
+	return models.AlertConfig{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeAlertRepository) AddAlertConfig(ctx context.Context, config *models.AlertConfig) error {
+	return nil
+}
+
+func (f *fakeAlertRepository) SaveAlertConfig(ctx context.Context, config *models.AlertConfig) error {
+	return nil
+}
+
+func (f *fakeAlertRepository) DeleteAlertConfig(ctx context.Context, ruleId primitive.ObjectID) error {
+	return nil
+}
+
+func (f *fakeAlertRepository) AddAlertRuleAudit(ctx context.Context, audit models.AlertRuleAudit) error {
+	return nil
+}
+
+func (f *fakeAlertRepository) GetAlertRuleAudits(ctx context.Context, ruleId primitive.ObjectID, page models.PageRequest) ([]models.AlertRuleAudit, int64, error) {
+	return nil, 0, nil
+}
+
+func (f *fakeAlertRepository) AddAlertEvents(ctx context.Context, events []models.AlertEvent) error {
+	f.events = append(f.events, events...)
+	return nil
+}
+
+func (f *fakeAlertRepository) GetIncidentEvents(ctx context.Context, incidentId primitive.ObjectID) ([]models.AlertEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeAlertRepository) FindLatestIncident(ctx context.Context, ruleId primitive.ObjectID, alertType, subjectType, subjectId string) (models.AlertIncident, error) {
+	latest, found := models.AlertIncident{}, false
+	for _, incident := range f.incidents {
+		if incident.RuleId != ruleId || incident.AlertType != alertType || incident.SubjectType != subjectType || incident.SubjectId != subjectId {
+			continue
+		}
+		if !found || incident.StartedAt.After(latest.StartedAt) {
+			latest, found = incident, true
+		}
+	}
+	if !found {
+		return latest, mongo.ErrNoDocuments
+	}
+	return latest, nil
+}
+
+func (f *fakeAlertRepository) GetIncidentById(ctx context.Context, incidentId primitive.ObjectID) (models.AlertIncident, error) {
+	for _, incident := range f.incidents {
+		if incident.Id == incidentId {
+			return incident, nil
+		}
+	}
+	return models.AlertIncident{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeAlertRepository) SaveIncident(ctx context.Context, incident *models.AlertIncident) error {
+	if incident.Id.IsZero() {
+		incident.Id = primitive.NewObjectID()
+		f.incidents = append(f.incidents, *incident)
+		return nil
+	}
+	for i := range f.incidents {
+		if f.incidents[i].Id == incident.Id {
+			f.incidents[i] = *incident
+		}
+	}
+	return nil
+}
+
+func (f *fakeAlertRepository) GetLiveIncidents(ctx context.Context) ([]models.AlertIncident, error) {
+	live := []models.AlertIncident{}
+	for _, incident := range f.incidents {
+		if incident.Status != models.IncidentStatusResolved {
+			live = append(live, incident)
+		}
+	}
+	return live, nil
+}
+
+func (f *fakeAlertRepository) GetIncidents(ctx context.Context, filter models.IncidentFilter, page models.PageRequest) ([]models.AlertIncident, int64, error) {
+	return f.incidents, int64(len(f.incidents)), nil
+}
+
+// fakeNotificationService records the events it was asked to notify
+type fakeNotificationService struct {
+	events []models.AlertEvent
+}
+
+func (f *fakeNotificationService) NotifyAlertEvents(ctx context.Context, events []models.AlertEvent) error {
+	f.events = append(f.events, events...)
+	return nil
+}
+
+func (f *fakeNotificationService) ProcessOutbox(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func eventNames(events []models.AlertEvent) []string {
+	names := []string{}
+	for _, event := range events {
+		names = append(names, event.Event)
+	}
+	return names
+}
+
+func sameNames(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPeakValue(t *testing.T) {
+	above := models.AlertConfig{Operator: models.AlertOperatorGT, Threshold: 60}
+	below := models.AlertConfig{Operator: models.AlertOperatorLTE, Threshold: 20}
+	outside := models.AlertConfig{Operator: models.AlertOperatorOutside, MinThreshold: 45, MaxThreshold: 135}
+
+	tests := []struct {
+		name  string
+		rule  models.AlertConfig
+		peak  float64
+		value float64
+		want  float64
+	}{
+		{"upper limit keeps the highest", above, 80, 70, 80},
+		{"upper limit takes a new high", above, 80, 95, 95},
+		{"lower limit keeps the lowest", below, 10, 15, 10},
+		{"lower limit takes a new low", below, 10, 5, 5},
+		{"outside takes the furthest below", outside, 140, 20, 20},
+		{"outside takes the furthest above", outside, 30, 170, 170},
+		{"outside keeps the peak", outside, 10, 150, 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := peakValue(test.rule, test.peak, test.value); got != test.want {
+				t.Errorf("peakValue(%v, %v) = %v, want %v", test.peak, test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRecordResultsIncidents(t *testing.T) {
+	const dedupWindow = 10 * time.Minute
+	now := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+	rule := models.AlertConfig{
+		Id:        primitive.NewObjectID(),
+		AlertType: models.AlertTypeOverspeed,
+		Severity:  models.AlertSeverityCritical,
+		Source:    models.AlertSourceVehicle,
+		Field:     models.FieldSpeed,
+		Operator:  models.AlertOperatorGT,
+		Threshold: 80,
+	}
+	incident := func(status string, startedAt, lastSeenAt, endedAt time.Time) models.AlertIncident {
+		return models.AlertIncident{
+			Id:          primitive.NewObjectID(),
+			RuleId:      rule.Id,
+			AlertType:   rule.AlertType,
+			Severity:    rule.Severity,
+			SubjectType: models.AlertSourceVehicle,
+			SubjectId:   "MH12AB1234",
+			Field:       rule.Field,
+			Status:      status,
+			StartedAt:   startedAt,
+			LastSeenAt:  lastSeenAt,
+			EndedAt:     endedAt,
+			PeakValue:   90,
+			LastValue:   90,
+			Occurrences: 1,
+		}
+	}
+	acknowledged := incident(models.IncidentStatusResolved, now.Add(-20*time.Minute), now.Add(-6*time.Minute), now.Add(-5*time.Minute))
+	acknowledged.AcknowledgedBy = "ops@mauto.in"
+	acknowledged.AcknowledgedAt = now.Add(-15 * time.Minute)
+	acknowledged.ResolvedBy = models.IncidentResolvedBySystem
+	acknowledged.ResolvedAt = now.Add(-5 * time.Minute)
+	resolvedByHand := incident(models.IncidentStatusResolved, now.Add(-5*time.Minute), now.Add(-2*time.Minute), now.Add(-time.Minute))
+	resolvedByHand.ResolvedBy = "ops@mauto.in"
+
+	tests := []struct {
+		name       string
+		existing   []models.AlertIncident
+		status     string
+		value      float64
+		wantEvents []string
+		// every incident after the result, oldest first
+		check func(t *testing.T, incidents []models.AlertIncident)
+	}{
+		{
+			name:       "first firing opens an incident",
+			status:     RuleFired,
+			value:      95,
+			wantEvents: []string{models.AlertEventFired},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				if len(incidents) != 1 || incidents[0].Status != models.IncidentStatusOpen || incidents[0].Occurrences != 1 || !incidents[0].StartedAt.Equal(now) {
+					t.Errorf("incidents = %+v, want one open incident started now", incidents)
+				}
+			},
+		},
+		{
+			name:       "ongoing reading extends the incident",
+			existing:   []models.AlertIncident{incident(models.IncidentStatusOpen, now.Add(-5*time.Minute), now.Add(-time.Minute), time.Time{})},
+			status:     RuleOngoing,
+			value:      110,
+			wantEvents: []string{},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				got := incidents[0]
+				if got.Status != models.IncidentStatusOpen || !got.LastSeenAt.Equal(now) || got.LastValue != 110 || got.PeakValue != 110 {
+					t.Errorf("incident = %+v, want open, last seen now with peak 110", got)
+				}
+			},
+		},
+		{
+			name:       "clear resolves the incident",
+			existing:   []models.AlertIncident{incident(models.IncidentStatusAcknowledged, now.Add(-5*time.Minute), now.Add(-time.Minute), time.Time{})},
+			status:     RuleCleared,
+			value:      60,
+			wantEvents: []string{models.AlertEventCleared},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				got := incidents[0]
+				if got.Status != models.IncidentStatusResolved || !got.EndedAt.Equal(now) || got.ResolvedBy != models.IncidentResolvedBySystem {
+					t.Errorf("incident = %+v, want resolved by the system now", got)
+				}
+				if got.LastValue != 90 {
+					t.Errorf("last value = %v, the clearing reading should not replace it", got.LastValue)
+				}
+			},
+		},
+		{
+			name:       "firing within the de-dup window reopens the incident",
+			existing:   []models.AlertIncident{acknowledged},
+			status:     RuleFired,
+			value:      95,
+			wantEvents: []string{models.AlertEventReopened},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				if len(incidents) != 1 {
+					t.Fatalf("%d incidents, want the old one reopened", len(incidents))
+				}
+				got := incidents[0]
+				if got.Status != models.IncidentStatusOpen || got.Occurrences != 2 || !got.EndedAt.IsZero() {
+					t.Errorf("incident = %+v, want open again with 2 occurrences", got)
+				}
+				if got.AcknowledgedBy != "" || !got.AcknowledgedAt.IsZero() || got.ResolvedBy != "" || !got.ResolvedAt.IsZero() {
+					t.Errorf("incident = %+v, the acknowledgement and resolution should be cleared", got)
+				}
+			},
+		},
+		{
+			name:       "firing after the de-dup window opens a new incident",
+			existing:   []models.AlertIncident{incident(models.IncidentStatusResolved, now.Add(-time.Hour), now.Add(-30*time.Minute), now.Add(-20*time.Minute))},
+			status:     RuleFired,
+			value:      95,
+			wantEvents: []string{models.AlertEventFired},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				if len(incidents) != 2 || incidents[0].Status != models.IncidentStatusResolved || incidents[1].Status != models.IncidentStatusOpen {
+					t.Errorf("incidents = %+v, want the old one resolved and a new open one", incidents)
+				}
+			},
+		},
+		{
+			name:       "firing while live keeps the episode going",
+			existing:   []models.AlertIncident{incident(models.IncidentStatusOpen, now.Add(-5*time.Minute), now.Add(-time.Minute), time.Time{})},
+			status:     RuleFired,
+			value:      95,
+			wantEvents: []string{},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				if len(incidents) != 1 || incidents[0].Occurrences != 1 || !incidents[0].LastSeenAt.Equal(now) {
+					t.Errorf("incidents = %+v, want the same incident seen now", incidents)
+				}
+			},
+		},
+		{
+			name:       "stale live incident is closed where it was last seen",
+			existing:   []models.AlertIncident{incident(models.IncidentStatusOpen, now.Add(-time.Hour), now.Add(-30*time.Minute), time.Time{})},
+			status:     RuleFired,
+			value:      95,
+			wantEvents: []string{models.AlertEventCleared, models.AlertEventFired},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				if len(incidents) != 2 {
+					t.Fatalf("%d incidents, want the stale one closed and a new one", len(incidents))
+				}
+				stale := incidents[0]
+				if stale.Status != models.IncidentStatusResolved || !stale.EndedAt.Equal(now.Add(-30*time.Minute)) || !stale.ResolvedAt.Equal(now) {
+					t.Errorf("stale incident = %+v, want ended at its last sighting and resolved now", stale)
+				}
+				if incidents[1].Status != models.IncidentStatusOpen || !incidents[1].StartedAt.Equal(now) {
+					t.Errorf("new incident = %+v, want open from now", incidents[1])
+				}
+			},
+		},
+		{
+			name:       "ongoing reading after a manual resolve is ignored",
+			existing:   []models.AlertIncident{resolvedByHand},
+			status:     RuleOngoing,
+			value:      95,
+			wantEvents: []string{},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				if len(incidents) != 1 || incidents[0] != resolvedByHand {
+					t.Errorf("incidents = %+v, the resolved incident should stay as it was", incidents)
+				}
+			},
+		},
+		{
+			name:       "clear without a live incident does nothing",
+			status:     RuleCleared,
+			value:      60,
+			wantEvents: []string{},
+			check: func(t *testing.T, incidents []models.AlertIncident) {
+				if len(incidents) != 0 {
+					t.Errorf("incidents = %+v, want none", incidents)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := &fakeAlertRepository{incidents: append([]models.AlertIncident{}, test.existing...)}
+			notifications := &fakeNotificationService{}
+			service := NewAlertService(repo, NewAlertEngine(), notifications, dedupWindow)
+
+			err := service.RecordResults(context.Background(), []RuleResult{{
+				Rule:        rule,
+				SubjectType: models.AlertSourceVehicle,
+				SubjectId:   "MH12AB1234",
+				Value:       test.value,
+				Time:        now,
+				Status:      test.status,
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := eventNames(repo.events); !sameNames(got, test.wantEvents) {
+				t.Errorf("events = %v, want %v", got, test.wantEvents)
+			}
+			if got := eventNames(notifications.events); !sameNames(got, test.wantEvents) {
+				t.Errorf("notified %v, want %v", got, test.wantEvents)
+			}
+			test.check(t, repo.incidents)
+		})
+	}
+}
+
+func TestReloadRulesResolvesOrphanedIncidents(t *testing.T) {
+	started := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+	kept := models.AlertConfig{
+		Id:        primitive.NewObjectID(),
+		AlertType: "low_soc",
+		Severity:  models.AlertSeverityWarning,
+		Source:    models.AlertSourceBattery,
+		Field:     "battery_soc",
+		Operator:  models.AlertOperatorLT,
+		Threshold: 20,
+	}
+	disabled := kept
+	disabled.Id = primitive.NewObjectID()
+	disabled.AlertType = "low_soc_critical"
+	disabled.Threshold = 10
+	disabled.Disabled = true
+
+	live := func(ruleId primitive.ObjectID, alertType, subjectType string) models.AlertIncident {
+		return models.AlertIncident{
+			Id:          primitive.NewObjectID(),
+			RuleId:      ruleId,
+			AlertType:   alertType,
+			SubjectType: subjectType,
+			SubjectId:   "BMS1",
+			Status:      models.IncidentStatusOpen,
+			StartedAt:   started,
+			LastSeenAt:  started,
+		}
+	}
+	repo := &fakeAlertRepository{
+		configs: []models.AlertConfig{kept, disabled},
+		incidents: []models.AlertIncident{
+			live(kept.Id, kept.AlertType, models.AlertSourceBattery),
+			live(primitive.NewObjectID(), "removed", models.AlertSourceBattery),
+			live(disabled.Id, disabled.AlertType, models.AlertSourceBattery),
+			live(primitive.ObjectID{}, models.AlertTypeSOS, models.AlertSourceVehicle),
+			live(primitive.ObjectID{}, models.AlertTypeOverspeed, models.AlertSourceVehicle),
+		},
+	}
+	notifications := &fakeNotificationService{}
+	service := NewAlertService(repo, NewAlertEngine(), notifications, 10*time.Minute)
+
+	if err := service.ReloadRules(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the configured rule, the state alert and the built in overspeed rule
+	// keep their incidents, the removed and the disabled rule lose theirs
+	wantStatus := []string{
+		models.IncidentStatusOpen,
+		models.IncidentStatusResolved,
+		models.IncidentStatusResolved,
+		models.IncidentStatusOpen,
+		models.IncidentStatusOpen,
+	}
+	for i, incident := range repo.incidents {
+		if incident.Status != wantStatus[i] {
+			t.Errorf("%s incident status = %s, want %s", incident.AlertType, incident.Status, wantStatus[i])
+		}
+		if incident.Status == models.IncidentStatusResolved && (incident.ResolvedBy != models.IncidentResolvedBySystem || incident.EndedAt.IsZero()) {
+			t.Errorf("%s incident = %+v, want ended and resolved by the system", incident.AlertType, incident)
+		}
+	}
+
+	if len(repo.events) != 2 || len(notifications.events) != 2 {
+		t.Fatalf("events = %+v, notified %+v, want 2 cleared events", repo.events, notifications.events)
+	}
+	for _, event := range repo.events {
+		if event.Event != models.AlertEventCleared || event.Note != "the alert rule was removed or disabled" {
+			t.Errorf("event = %+v, want cleared because the rule is gone", event)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/notifier"
+	"github.com/aniket0951/testproject/repositories"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidToken       = errors.New("the token is invalid or has expired")
+	ErrEmailTaken         = errors.New("the email is already in use")
+	ErrInvalidRole        = errors.New("the role has to be admin, operator, viewer or fleet-client")
+	ErrWeakPassword       = errors.New("the password needs at least 8 characters")
+	ErrPasswordReused     = errors.New("the new password has to differ from the last one")
+	ErrScopeRequired      = errors.New("a fleet-client needs a company")
+	ErrBranchScope        = errors.New("a branch needs a company")
+	ErrNameRequired       = errors.New("the name is required")
+	ErrResetUnavailable   = errors.New("password resets need an email channel, ask an admin to set a new password")
+)
+
+const minPasswordLength = 8
+
+// token types, a refresh token is never accepted as an access token
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+type AuthSettings struct {
+	Secret     []byte
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	ResetTTL   time.Duration
+	BcryptCost int
+}
+
+// Claims are carried by the api tokens, Subject is the user id
+type Claims struct {
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Company string `json:"company,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+	Type    string `json:"typ"`
+	// the user has to change the password before using the rest of the api
+	PasswordReset bool `json:"pwd_reset,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (claims *Claims) Scope() models.Scope {
+	return models.Scope{Company: claims.Company, Branch: claims.Branch}
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// seconds until the access token expires
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// NewUser is what an admin fills in to create an account
+type NewUser struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+	Company  string `json:"company"`
+	Branch   string `json:"branch"`
+}
+
+// UserUpdate changes the set fields of an account
+type UserUpdate struct {
+	Name     *string `json:"name"`
+	Role     *string `json:"role"`
+	Company  *string `json:"company"`
+	Branch   *string `json:"branch"`
+	Disabled *bool   `json:"disabled"`
+	Password *string `json:"password"`
+}
+
+type AuthService interface {
+	Login(ctx context.Context, email, password string) (TokenPair, models.User, error)
+	// Refresh swaps a refresh token for a new pair, the old refresh token
+	// stops working
+	Refresh(ctx context.Context, refreshToken string) (TokenPair, error)
+	Logout(ctx context.Context, userId primitive.ObjectID) error
+	ParseAccessToken(token string) (*Claims, error)
+
+	ChangePassword(ctx context.Context, userId primitive.ObjectID, oldPassword, newPassword string) error
+	// RequestPasswordReset mails a reset token, unknown emails are ignored
+	// so the answer doesn't tell which accounts exist. Without an email
+	// channel it returns ErrResetUnavailable.
+	RequestPasswordReset(ctx context.Context, email string) error
+	ConfirmPasswordReset(ctx context.Context, token, newPassword string) error
+
+	CreateUser(ctx context.Context, newUser NewUser) (models.User, error)
+	UpdateUser(ctx context.Context, userId primitive.ObjectID, update UserUpdate) (models.User, error)
+	GetUser(ctx context.Context, userId primitive.ObjectID) (models.User, error)
+	ListUsers(ctx context.Context, page models.PageRequest) ([]models.User, int64, error)
+	// EnsureAdmin creates the admin account while there are no users yet
+	EnsureAdmin(ctx context.Context, email, password string) error
+}
+
+type authservice struct {
+	userRepository repositories.UserRepository
+	// mails the reset tokens, password resets are refused when nil
+	mailer   notifier.Notifier
+	settings AuthSettings
+}
+
+func NewAuthService(repo repositories.UserRepository, mailer notifier.Notifier, settings AuthSettings) AuthService {
+	return &authservice{
+		userRepository: repo,
+		mailer:         mailer,
+		settings:       settings,
+	}
+}
+
+func (s *authservice) Login(ctx context.Context, email, password string) (TokenPair, models.User, error) {
+	user, err := s.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return TokenPair{}, user, ErrInvalidCredentials
+	}
+	if err != nil {
+		return TokenPair{}, user, err
+	}
+	if user.Disabled || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return TokenPair{}, user, ErrInvalidCredentials
+	}
+
+	tokens, err := s.issueTokens(ctx, &user)
+	return tokens, user, err
+}
+
+func (s *authservice) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	claims, err := s.parseToken(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	user, err := s.userFromClaims(ctx, claims)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if user.Disabled || user.Token == "" || user.Token != hashToken(claims.ID) {
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	return s.issueTokens(ctx, &user)
+}
+
+func (s *authservice) Logout(ctx context.Context, userId primitive.ObjectID) error {
+	user, err := s.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	user.Token = ""
+	return s.userRepository.SaveUser(ctx, &user)
+}
+
+func (s *authservice) ParseAccessToken(token string) (*Claims, error) {
+	return s.parseToken(token, tokenTypeAccess)
+}
+
+func (s *authservice) ChangePassword(ctx context.Context, userId primitive.ObjectID, oldPassword, newPassword string) error {
+	user, err := s.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)) != nil {
+		return ErrInvalidCredentials
+	}
+
+	if err := s.setPassword(&user, newPassword); err != nil {
+		return err
+	}
+	user.IsPasswordReset = false
+	return s.userRepository.SaveUser(ctx, &user)
+}
+
+func (s *authservice) RequestPasswordReset(ctx context.Context, email string) error {
+	// the token must never end up anywhere but the user's inbox
+	if s.mailer == nil {
+		return ErrResetUnavailable
+	}
+
+	user, err := s.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return nil
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(s.settings.ResetTTL)
+	user.ResetToken = hashToken(token)
+	user.ResetExpiresAt = primitive.NewDateTimeFromTime(expires)
+	if err := s.userRepository.SaveUser(ctx, &user); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, notifier.Message{
+		Recipients: []string{user.Email},
+		Subject:    "Password reset",
+		Body: fmt.Sprintf("Use this token to reset your password, it is valid until %s:\n\n%s",
+			expires.UTC().Format(time.RFC1123), token),
+	})
+}
+
+func (s *authservice) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	if token == "" {
+		return ErrInvalidToken
+	}
+
+	user, err := s.userRepository.GetUserByResetToken(ctx, hashToken(token))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled || time.Now().After(user.ResetExpiresAt.Time()) {
+		return ErrInvalidToken
+	}
+
+	if err := s.setPassword(&user, newPassword); err != nil {
+		return err
+	}
+	user.IsPasswordReset = false
+	user.ResetToken = ""
+	user.ResetExpiresAt = 0
+	return s.userRepository.SaveUser(ctx, &user)
+}
+
+func (s *authservice) CreateUser(ctx context.Context, newUser NewUser) (models.User, error) {
+	user := models.User{
+		Name:     strings.TrimSpace(newUser.Name),
+		Email:    normalizeEmail(newUser.Email),
+		UserType: newUser.Role,
+		Company:  strings.TrimSpace(newUser.Company),
+		Branch:   strings.TrimSpace(newUser.Branch),
+		// the user has to pick their own password before using the api
+		IsPasswordReset: true,
+	}
+	if err := validateAccount(user); err != nil {
+		return user, err
+	}
+	if err := s.setPassword(&user, newUser.Password); err != nil {
+		return user, err
+	}
+
+	err := s.userRepository.AddUser(ctx, &user)
+	if mongo.IsDuplicateKeyError(err) {
+		return user, ErrEmailTaken
+	}
+	return user, err
+}
+
+func (s *authservice) UpdateUser(ctx context.Context, userId primitive.ObjectID, update UserUpdate) (models.User, error) {
+	user, err := s.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return user, err
+	}
+
+	if update.Name != nil {
+		user.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Role != nil {
+		user.UserType = *update.Role
+	}
+	if update.Company != nil {
+		user.Company = strings.TrimSpace(*update.Company)
+	}
+	if update.Branch != nil {
+		user.Branch = strings.TrimSpace(*update.Branch)
+	}
+	if update.Disabled != nil {
+		user.Disabled = *update.Disabled
+	}
+	if err := validateAccount(user); err != nil {
+		return user, err
+	}
+	if update.Password != nil {
+		if err := s.setPassword(&user, *update.Password); err != nil {
+			return user, err
+		}
+		user.IsPasswordReset = true
+	}
+	// a changed role, scope or password takes effect with the next login
+	if update.Role != nil || update.Company != nil || update.Branch != nil || update.Disabled != nil || update.Password != nil {
+		user.Token = ""
+	}
+
+	return user, s.userRepository.SaveUser(ctx, &user)
+}
+
+func (s *authservice) GetUser(ctx context.Context, userId primitive.ObjectID) (models.User, error) {
+	return s.userRepository.GetUserById(ctx, userId)
+}
+
+func (s *authservice) ListUsers(ctx context.Context, page models.PageRequest) ([]models.User, int64, error) {
+	return s.userRepository.ListUsers(ctx, page)
+}
+
+func (s *authservice) EnsureAdmin(ctx context.Context, email, password string) error {
+	if email == "" || password == "" {
+		return nil
+	}
+
+	count, err := s.userRepository.CountUsers(ctx)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = s.CreateUser(ctx, NewUser{Name: "admin", Email: email, Password: password, Role: models.RoleAdmin})
+	if err == nil {
+		logger.From(ctx).WithField("email", normalizeEmail(email)).Info("created the bootstrap admin")
+	}
+	return err
+}
+
+// issueTokens signs a new pair and keeps the refresh token id on the user,
+// which invalidates the refresh token issued before
+func (s *authservice) issueTokens(ctx context.Context, user *models.User) (TokenPair, error) {
+	now := time.Now()
+
+	access, err := s.signToken(user, tokenTypeAccess, "", now, s.settings.AccessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshId, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := s.signToken(user, tokenTypeRefresh, refreshId, now, s.settings.RefreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	user.Token = hashToken(refreshId)
+	if err := s.userRepository.SaveUser(ctx, user); err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.settings.AccessTTL / time.Second),
+	}, nil
+}
+
+func (s *authservice) signToken(user *models.User, tokenType, id string, now time.Time, ttl time.Duration) (string, error) {
+	claims := Claims{
+		Email:   user.Email,
+		Role:    user.UserType,
+		Company: user.Company,
+		Branch:  user.Branch,
+		Type:    tokenType,
+
+		PasswordReset: user.IsPasswordReset,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Issuer:    s.settings.Issuer,
+			Subject:   user.Id.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.settings.Secret)
+}
+
+func (s *authservice) parseToken(token, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return s.settings.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Type != tokenType || claims.ExpiresAt == nil || !claims.VerifyIssuer(s.settings.Issuer, true) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *authservice) userFromClaims(ctx context.Context, claims *Claims) (models.User, error) {
+	userId, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return models.User{}, ErrInvalidToken
+	}
+
+	user, err := s.userRepository.GetUserById(ctx, userId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrInvalidToken
+	}
+	return user, err
+}
+
+// setPassword hashes password into the user and keeps the previous hash
+// in OldPassword, reusing the current password is refused
+func (s *authservice) setPassword(user *models.User, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	if user.Password != "" && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+		return ErrPasswordReused
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.settings.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	user.OldPassword = user.Password
+	user.Password = string(hash)
+	user.PasswordChangedAt = primitive.NewDateTimeFromTime(time.Now())
+	// sessions started with the old password end
+	user.Token = ""
+	return nil
+}
+
+func validateAccount(user models.User) error {
+	if user.Name == "" {
+		return ErrNameRequired
+	}
+	switch user.UserType {
+	case models.RoleAdmin, models.RoleOperator, models.RoleViewer:
+	case models.RoleFleetClient:
+		if user.Company == "" {
+			return ErrScopeRequired
+		}
+	default:
+		return ErrInvalidRole
+	}
+	if user.Branch != "" && user.Company == "" {
+		return ErrBranchScope
+	}
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken is how refresh and reset tokens are stored, a leaked users
+// collection doesn't hand out sessions
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
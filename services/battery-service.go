@@ -2,28 +2,34 @@ package services
 
 import (
 	"context"
-	"fmt"
 	"sync"
 
 	"time"
 
 	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/jobs"
+	"github.com/aniket0951/testproject/logger"
 	"github.com/aniket0951/testproject/models"
 	"github.com/aniket0951/testproject/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type BatteryService interface {
-	UpdateBatteryStatus() error
+	UpdateBatteryStatus(ctx context.Context) error
 
-	GetBatteryDistanceTravelled() ([]models.BatteryDistanceTravelled, error)
+	GetBatteryDistanceTravelled(ctx context.Context) ([]models.BatteryDistanceTravelled, error)
 	CalculateDistanceForLatLng(batteryData models.BatteryDistanceTravelled) (float64, error)
-	UpdateBatteryDistanceTravelled() error
+	UpdateBatteryDistanceTravelled(ctx context.Context) error
 
-	UpdateLastSevenHourUnReported() error
-	UpdateLast24HourUnreported() error
+	UpdateLastSevenHourUnReported(ctx context.Context) error
+	UpdateLast24HourUnreported(ctx context.Context) error
 
-	CheckForBatteryChargingReport([]models.BatteryHardwareMain) error
+	CheckForBatteryChargingReport(ctx context.Context, batteryData []models.BatteryHardwareMain) error
+
+	GetBattery(ctx context.Context, bmsID string) (models.BatteryHardwareMain, error)
+	GetChargingReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.ChargingReport, int64, error)
+	GetCycleReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.CreateCycleBasedReport, int64, error)
+	GetUnreportedCounts(ctx context.Context) (models.UnreportedCounts, error)
 }
 
 type batteryService struct {
@@ -35,22 +41,26 @@ func NewBatteryService(repo repositories.BatteryRepository) BatteryService {
 		batteryRepo: repo,
 	}
 }
-func (ser *batteryService) UpdateBatteryStatus() error {
-	_, offlineCancel := context.WithTimeout(context.Background(), 10*time.Second)
-
-	go func(cancel context.CancelFunc) {
-
-		defer cancel()
-		batteryData, _ := ser.batteryRepo.GetOfflineBattery()
 
-		_ = ser.batteryRepo.UpdateBatteryOfflineStatus(batteryData)
+// UpdateBatteryStatus marks the batteries that stopped reporting as offline
+func (ser *batteryService) UpdateBatteryStatus(ctx context.Context) error {
+	batteryData, err := ser.batteryRepo.GetOfflineBattery(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	}(offlineCancel)
+	if err := ser.batteryRepo.UpdateBatteryOfflineStatus(ctx, batteryData); err != nil {
+		return err
+	}
+	jobs.AddItems(ctx, "offline", len(batteryData))
 	return nil
 }
 
-func (ser *batteryService) GetBatteryDistanceTravelled() ([]models.BatteryDistanceTravelled, error) {
-	return ser.batteryRepo.GetBatteryDistanceTravelled()
+func (ser *batteryService) GetBatteryDistanceTravelled(ctx context.Context) ([]models.BatteryDistanceTravelled, error) {
+	return ser.batteryRepo.GetBatteryDistanceTravelled(ctx)
 }
 
 func (ser *batteryService) CalculateDistanceForLatLng(batteryData models.BatteryDistanceTravelled) (float64, error) {
@@ -79,8 +89,8 @@ func (ser *batteryService) CalculateDistanceForLatLng(batteryData models.Battery
 	return total, nil
 }
 
-func (db *batteryService) UpdateBatteryDistanceTravelled() error {
-	res, err := db.GetBatteryDistanceTravelled()
+func (db *batteryService) UpdateBatteryDistanceTravelled(ctx context.Context) error {
+	res, err := db.GetBatteryDistanceTravelled(ctx)
 
 	if err != nil {
 		return err
@@ -98,39 +108,42 @@ func (db *batteryService) UpdateBatteryDistanceTravelled() error {
 		batteryData = append(batteryData, temp)
 	}
 
-	_ = db.batteryRepo.UpdateBatteryDistanceTravelled(batteryData)
-	delErr := db.batteryRepo.DeleteTodayDistanceTravelled()
+	_ = db.batteryRepo.UpdateBatteryDistanceTravelled(ctx, batteryData)
+	jobs.AddItems(ctx, "batteries", len(batteryData))
+	delErr := db.batteryRepo.DeleteTodayDistanceTravelled(ctx)
 	return delErr
 
 }
 
-func (ser *batteryService) UpdateLastSevenHourUnReported() error {
+func (ser *batteryService) UpdateLastSevenHourUnReported(ctx context.Context) error {
 	// fetching old seven records
-	data, err := ser.GetUnreportedForSevenHour()
+	data, err := ser.GetUnreportedForSevenHour(ctx)
 	if err != nil {
 		return err
 	}
 
 	// delete all previous  records...
-	delErr := ser.batteryRepo.DeleteLastSevenHourUnreported()
-	fmt.Println("Delete Error : ", delErr)
+	if delErr := ser.batteryRepo.DeleteLastSevenHourUnreported(ctx); delErr != nil {
+		logger.From(ctx).WithError(delErr).Error("failed to delete the last seven hour unreported counts")
+	}
 
 	for i := range data {
-		_ = ser.batteryRepo.InsertLastSevenHourUnreported(data[i])
+		_ = ser.batteryRepo.InsertLastSevenHourUnreported(ctx, data[i])
 	}
+	jobs.AddItems(ctx, "rows", len(data))
 
 	return nil
 }
 
-func (ser *batteryService) UpdateLast24HourUnreported() error {
-	data, err := ser.batteryRepo.GetLast24hoursUnreportedData()
+func (ser *batteryService) UpdateLast24HourUnreported(ctx context.Context) error {
+	data, err := ser.batteryRepo.GetLast24hoursUnreportedData(ctx)
 
 	if err != nil {
 		return err
 	}
 
 	// delete all last counts
-	_ = ser.batteryRepo.DeleteAllLast24HourUnreported()
+	_ = ser.batteryRepo.DeleteAllLast24HourUnreported(ctx)
 
 	for i := range data {
 		var ans int32
@@ -146,65 +159,58 @@ func (ser *batteryService) UpdateLast24HourUnreported() error {
 			CreatedAt:        primitive.NewDateTimeFromTime(time.Now()),
 		}
 
-		err := ser.batteryRepo.InsertLast24HourUnreported(temp)
-		fmt.Println("New data inserted error : ", err)
+		if err := ser.batteryRepo.InsertLast24HourUnreported(ctx, temp); err != nil {
+			logger.From(ctx).WithError(err).Error("failed to insert the last 24 hour unreported count")
+		}
 	}
+	jobs.AddItems(ctx, "rows", len(data))
 
 	// defer close(totalBatteryChan)
 
 	return nil
 }
 
-func (ser *batteryService) GetLastSevenHourUnreported() ([]models.LastSevenHourUnreported, error) {
-	return ser.batteryRepo.GetLastSevenHourUnreported()
+func (ser *batteryService) GetLastSevenHourUnreported(ctx context.Context) ([]models.LastSevenHourUnreported, error) {
+	return ser.batteryRepo.GetLastSevenHourUnreported(ctx)
 }
 
-func (ser *batteryService) GetUnreportedForSevenHour() ([]models.LastSevenHourUnreported, error) {
-	allBattery := make(chan int64)
-
-	go func() {
-		count, _ := ser.batteryRepo.GetBatteryCount()
-		allBattery <- count
-	}()
-
-	res, err := ser.batteryRepo.GetLast7hoursUnreportedData()
+func (ser *batteryService) GetUnreportedForSevenHour(ctx context.Context) ([]models.LastSevenHourUnreported, error) {
+	total, err := ser.batteryRepo.GetBatteryCount(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	total := <-allBattery
+	res, err := ser.batteryRepo.GetLast7hoursUnreportedData(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	for i := range res {
 		res[i].SetLastSevenHourUnreported(total)
 	}
-	close(allBattery)
 	return res, nil
 }
 
-func (ser *batteryService) GetUnreportedForOneHour() (map[string]int64, error) {
-	allBattery := make(chan int64)
-
-	go func() {
-		count, _ := ser.batteryRepo.GetBatteryCount()
-		allBattery <- count
-	}()
+func (ser *batteryService) GetUnreportedForOneHour(ctx context.Context) (map[string]int64, error) {
+	total, err := ser.batteryRepo.GetBatteryCount(ctx)
+	if err != nil {
+		return map[string]int64{}, err
+	}
 
-	res, err := ser.batteryRepo.GetLast1hoursUnreportedData()
+	res, err := ser.batteryRepo.GetLast1hoursUnreportedData(ctx)
 	if err != nil {
 		return map[string]int64{}, err
 	}
 
-	total := <-allBattery
 	for k, v := range res {
 		temp := total - v
 		res[k] = temp
 	}
-	close(allBattery)
 	return res, nil
 }
 
 // battery charging report check
-func (ser *batteryService) CheckForBatteryChargingReport(batteryData []models.BatteryHardwareMain) error {
+func (ser *batteryService) CheckForBatteryChargingReport(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	// check old and current battery current and store it another model list for next operations
 	var newBatteryData []models.BatteryHardwareMain
 
@@ -221,13 +227,13 @@ func (ser *batteryService) CheckForBatteryChargingReport(batteryData []models.Ba
 	}
 
 	// check for trip is start or end do implementation accordingly
-	err := ser.CheckBatteryCurrentCycleStartOrEnd(newBatteryData)
+	err := ser.CheckBatteryCurrentCycleStartOrEnd(ctx, newBatteryData)
 
 	return err
 }
 
 // check for cycle started or ended with the help of temp collection
-func (ser *batteryService) CheckBatteryCurrentCycleStartOrEnd(batteryData []models.BatteryHardwareMain) error {
+func (ser *batteryService) CheckBatteryCurrentCycleStartOrEnd(ctx context.Context, batteryData []models.BatteryHardwareMain) error {
 	var startCycleBattery, endCycleBattery, updateOldBatteryCurrent = []models.StartChargingReport{}, []models.EndChargingReport{}, []models.UpdateOldCurrent{}
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -241,7 +247,7 @@ func (ser *batteryService) CheckBatteryCurrentCycleStartOrEnd(batteryData []mode
 
 	// checking all bmsid one by one
 	for i := range batteryData {
-		startChargingReport := ser.batteryRepo.CheckChargingCycleStartOrNot(batteryData[i].BmsID)
+		startChargingReport := ser.batteryRepo.CheckChargingCycleStartOrNot(ctx, batteryData[i].BmsID)
 
 		// check for start
 		if (startChargingReport == models.StartChargingReport{}) {
@@ -258,27 +264,31 @@ func (ser *batteryService) CheckBatteryCurrentCycleStartOrEnd(batteryData []mode
 	}
 
 	// prepare and do a start current cycle
-	_ = ser.batteryRepo.StartChargingReport(startCycleBattery)
+	_ = ser.batteryRepo.StartChargingReport(ctx, startCycleBattery)
 	// go func() {
 	// 	defer wg.Done()
 	// 	fmt.Println("Send data to start charging Report....")
-	// 	err := ser.batteryRepo.StartChargingReport(startCycleBattery)
+	// 	err := ser.batteryRepo.StartChargingReport(ctx, startCycleBattery)
 	// 	fmt.Println("Cycle Start Error : ", err)
 	// }()
 
 	// prepare and do a end current cycle
 
 	// end the cycle first in temp c
-	endErr := ser.batteryRepo.EndChargingReport(endCycleBattery)
-	fmt.Println("Cycle End Error : ", endErr)
+	if endErr := ser.batteryRepo.EndChargingReport(ctx, endCycleBattery); endErr != nil {
+		logger.From(ctx).WithError(endErr).Error("failed to end the charging cycles")
+	}
 
 	// get all cycle end cycle battery
-	chargingReport, fetErr := ser.batteryRepo.GetCurrentCycleEnd()
-	fmt.Println("Fetch all end cycle error : ", fetErr)
+	chargingReport, fetErr := ser.batteryRepo.GetCurrentCycleEnd(ctx)
+	if fetErr != nil {
+		logger.From(ctx).WithError(fetErr).Error("failed to fetch the ended charging cycles")
+	}
 
 	// create a current cycle history
-	hisErr := ser.batteryRepo.CreateChargingReportHistory(chargingReport)
-	fmt.Println("Create current cycle history error : ", hisErr)
+	if hisErr := ser.batteryRepo.CreateChargingReportHistory(ctx, chargingReport); hisErr != nil {
+		logger.From(ctx).WithError(hisErr).Error("failed to create the charging cycle history")
+	}
 
 	// store only all bms id for remove temp data
 	bmsIDS := []string{}
@@ -287,8 +297,9 @@ func (ser *batteryService) CheckBatteryCurrentCycleStartOrEnd(batteryData []mode
 	}
 
 	// once history created remove all data from temp
-	delErr := ser.batteryRepo.DeleteChargingTempReport(bmsIDS)
-	fmt.Println("Delete current cycle temp data error : ", delErr)
+	if delErr := ser.batteryRepo.DeleteChargingTempReport(ctx, bmsIDS); delErr != nil {
+		logger.From(ctx).WithError(delErr).Error("failed to delete the ended charging cycles from temp")
+	}
 
 	// go func() {
 	// 	defer wg.Done()
@@ -296,19 +307,19 @@ func (ser *batteryService) CheckBatteryCurrentCycleStartOrEnd(batteryData []mode
 
 	// 	// end the cycle first in temp c
 	// 	fmt.Println("ending the cycle first...")
-	// 	err := ser.batteryRepo.EndChargingReport(endCycleBattery)
+	// 	err := ser.batteryRepo.EndChargingReport(ctx, endCycleBattery)
 	// 	fmt.Println("Cycle End Error : ", err)
 	// 	fmt.Println("Cycle has been ended...")
 
 	// 	// get all cycle end cycle battery
 	// 	fmt.Println("fetching all end cycle battery..")
-	// 	chargingReport, fetErr := ser.batteryRepo.GetCurrentCycleEnd()
+	// 	chargingReport, fetErr := ser.batteryRepo.GetCurrentCycleEnd(ctx)
 	// 	fmt.Println("Fetch all end cycle error : ", fetErr)
 	// 	fmt.Println("fetched all end cycle battery..")
 
 	// 	// create a current cycle history
 	// 	fmt.Println("Send data to create a current cycle history....")
-	// 	hisErr := ser.batteryRepo.CreateChargingReportHistory(chargingReport)
+	// 	hisErr := ser.batteryRepo.CreateChargingReportHistory(ctx, chargingReport)
 	// 	fmt.Println("Create current cycle history error : ", hisErr)
 	// 	fmt.Println("Current cycle history has been created....")
 
@@ -322,17 +333,49 @@ func (ser *batteryService) CheckBatteryCurrentCycleStartOrEnd(batteryData []mode
 
 	// 	// once history created remove all data from temp
 	// 	fmt.Println("Send data to delete all data from temp started....")
-	// 	delErr := ser.batteryRepo.DeleteChargingTempReport(bmsIDS)
+	// 	delErr := ser.batteryRepo.DeleteChargingTempReport(ctx, bmsIDS)
 	// 	fmt.Println("Delete current cycle temp data error : ", delErr)
 	// 	fmt.Println("Send data to delete all data from temp ended....")
 
 	// }()
-	fmt.Println("Waiting for goroutine done")
 	wg.Wait()
 
 	// for every start or end we have to update battery old current with latest battery current
-	upErr := ser.batteryRepo.UpdateBatteryCurrentInMain(updateOldBatteryCurrent)
-	fmt.Println("Update old battery current in main error : ", upErr)
+	if upErr := ser.batteryRepo.UpdateBatteryCurrentInMain(ctx, updateOldBatteryCurrent); upErr != nil {
+		logger.From(ctx).WithError(upErr).Error("failed to update the old battery current in main")
+	}
 
 	return nil
 }
+
+func (ser *batteryService) GetBattery(ctx context.Context, bmsID string) (models.BatteryHardwareMain, error) {
+	return ser.batteryRepo.GetBatteryByBmsID(ctx, bmsID)
+}
+
+func (ser *batteryService) GetChargingReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.ChargingReport, int64, error) {
+	return ser.batteryRepo.GetChargingReports(ctx, filter, page)
+}
+
+func (ser *batteryService) GetCycleReports(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]models.CreateCycleBasedReport, int64, error) {
+	return ser.batteryRepo.GetCycleReports(ctx, filter, page)
+}
+
+// GetUnreportedCounts combines the live count of the last hour with the
+// hourly counts the unreported jobs keep
+func (ser *batteryService) GetUnreportedCounts(ctx context.Context) (models.UnreportedCounts, error) {
+	counts := models.UnreportedCounts{}
+
+	lastHour, err := ser.GetUnreportedForOneHour(ctx)
+	if err != nil {
+		return counts, err
+	}
+	counts.LastHour = lastHour
+
+	if counts.LastSevenHours, err = ser.GetLastSevenHourUnreported(ctx); err != nil {
+		return counts, err
+	}
+	if counts.Last24Hours, err = ser.batteryRepo.GetLast24HourUnreported(ctx); err != nil {
+		return counts, err
+	}
+	return counts, nil
+}
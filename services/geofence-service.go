@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidGeofence is wrapped by every geofence validation error
+var ErrInvalidGeofence = errors.New("invalid geofence")
+
+type GeofenceService interface {
+	// Evaluate checks the fixes of one subject type against every enabled
+	// geofence and records enter, exit and dwell events
+	Evaluate(ctx context.Context, subjectType string, fixes []models.GeofenceFix) error
+
+	CreateGeofence(ctx context.Context, fence models.Geofence) (models.Geofence, error)
+	GetGeofences(ctx context.Context) ([]models.Geofence, error)
+	DeleteGeofence(ctx context.Context, fenceId primitive.ObjectID) error
+	GetEvents(ctx context.Context, subjectType, subjectId string, from, to time.Time) ([]models.GeofenceEvent, error)
+}
+
+type geofenceservice struct {
+	geofenceRepository repositories.GeofenceRepository
+}
+
+func NewGeofenceService(repo repositories.GeofenceRepository) GeofenceService {
+	return &geofenceservice{
+		geofenceRepository: repo,
+	}
+}
+
+func (s *geofenceservice) Evaluate(ctx context.Context, subjectType string, fixes []models.GeofenceFix) error {
+	if len(fixes) == 0 {
+		return nil
+	}
+
+	fences, err := s.geofenceRepository.GetEnabledGeofences(ctx)
+	if err != nil {
+		return fmt.Errorf("load geofences : %w", err)
+	}
+	if len(fences) == 0 {
+		return nil
+	}
+
+	stored, err := s.geofenceRepository.GetStates(ctx, subjectType)
+	if err != nil {
+		return fmt.Errorf("load geofence states : %w", err)
+	}
+
+	states := map[string]*models.GeofenceState{}
+	for i := range stored {
+		states[geofenceStateKey(stored[i].GeofenceId, stored[i].SubjectId)] = &stored[i]
+	}
+
+	sorted := make([]models.GeofenceFix, len(fixes))
+	copy(sorted, fixes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	events := []models.GeofenceEvent{}
+	changed := map[string]*models.GeofenceState{}
+
+	for i := range sorted {
+		fix := sorted[i]
+		point := helper.Coordinates{Latitude: fix.Point.Latitude, Longitude: fix.Point.Longitude}
+		// a (0,0) or out of range fix would look like leaving every geofence
+		if ok, _ := (helper.GPSFilter{}).ValidPoint(point); !ok {
+			continue
+		}
+
+		for j := range fences {
+			fence := &fences[j]
+			if !fence.AppliesTo(subjectType, fix.SubjectId, fix.Branch) {
+				continue
+			}
+
+			key := geofenceStateKey(fence.Id, fix.SubjectId)
+			state, known := states[key]
+			if !known {
+				state = &models.GeofenceState{GeofenceId: fence.Id, SubjectType: subjectType, SubjectId: fix.SubjectId}
+				states[key] = state
+			}
+
+			event := models.GeofenceEvent{
+				GeofenceId:   fence.Id,
+				GeofenceName: fence.Name,
+				Category:     fence.Category,
+				SubjectType:  subjectType,
+				SubjectId:    fix.SubjectId,
+				Point:        fix.Point,
+				Time:         fix.Time,
+			}
+			inside := fence.Contains(fix.Point)
+
+			switch {
+			case inside && !state.Inside:
+				state.Inside = true
+				state.EnteredAt = fix.Time
+				state.DwellReported = false
+				event.Event = models.GeofenceEventEnter
+			case inside && !state.DwellReported && fence.DwellSeconds > 0 &&
+				fix.Time.Sub(state.EnteredAt) >= time.Duration(fence.DwellSeconds)*time.Second:
+				state.DwellReported = true
+				event.Event = models.GeofenceEventDwell
+				event.DwellSeconds = int64(fix.Time.Sub(state.EnteredAt).Seconds())
+			case !inside && state.Inside:
+				state.Inside = false
+				event.Event = models.GeofenceEventExit
+				event.DwellSeconds = int64(fix.Time.Sub(state.EnteredAt).Seconds())
+			default:
+				continue
+			}
+
+			events = append(events, event)
+			changed[key] = state
+		}
+	}
+
+	if err := s.geofenceRepository.AddEvents(ctx, events); err != nil {
+		return fmt.Errorf("store geofence events : %w", err)
+	}
+
+	toSave := make([]models.GeofenceState, 0, len(changed))
+	for _, state := range changed {
+		toSave = append(toSave, *state)
+	}
+	if err := s.geofenceRepository.SaveStates(ctx, toSave); err != nil {
+		return fmt.Errorf("store geofence states : %w", err)
+	}
+	return nil
+}
+
+func (s *geofenceservice) CreateGeofence(ctx context.Context, fence models.Geofence) (models.Geofence, error) {
+	if err := validateGeofence(fence); err != nil {
+		return models.Geofence{}, err
+	}
+
+	err := s.geofenceRepository.CreateGeofence(ctx, &fence)
+	return fence, err
+}
+
+func (s *geofenceservice) GetGeofences(ctx context.Context) ([]models.Geofence, error) {
+	return s.geofenceRepository.GetGeofences(ctx)
+}
+
+func (s *geofenceservice) DeleteGeofence(ctx context.Context, fenceId primitive.ObjectID) error {
+	return s.geofenceRepository.DeleteGeofence(ctx, fenceId)
+}
+
+func (s *geofenceservice) GetEvents(ctx context.Context, subjectType, subjectId string, from, to time.Time) ([]models.GeofenceEvent, error) {
+	if !from.Before(to) {
+		return nil, errors.New("event range start has to be before its end")
+	}
+	return s.geofenceRepository.GetEvents(ctx, subjectType, subjectId, from.UTC(), to.UTC())
+}
+
+func validateGeofence(fence models.Geofence) error {
+	var problems []string
+
+	if strings.TrimSpace(fence.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+
+	switch fence.Shape {
+	case models.GeofenceShapeCircle:
+		if fence.RadiusMeters <= 0 {
+			problems = append(problems, "radius_meters has to be positive")
+		}
+		if !validGeoPoint(fence.Center) {
+			problems = append(problems, "center is not a valid coordinate")
+		}
+	case models.GeofenceShapePolygon:
+		if len(fence.Polygon) < 3 {
+			problems = append(problems, "polygon needs at least 3 points")
+		}
+		for i := range fence.Polygon {
+			if !validGeoPoint(fence.Polygon[i]) {
+				problems = append(problems, fmt.Sprintf("polygon point %d is not a valid coordinate", i))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("shape %q has to be circle or polygon", fence.Shape))
+	}
+
+	if fence.DwellSeconds < 0 {
+		problems = append(problems, "dwell_seconds can not be negative")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w : %s", ErrInvalidGeofence, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validGeoPoint(point models.GeoPoint) bool {
+	ok, _ := (helper.GPSFilter{}).ValidPoint(helper.Coordinates{Latitude: point.Latitude, Longitude: point.Longitude})
+	return ok
+}
+
+func geofenceStateKey(fenceId primitive.ObjectID, subjectId string) string {
+	return fenceId.Hex() + "/" + subjectId
+}
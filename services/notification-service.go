@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aniket0951/testproject/config"
+	"github.com/aniket0951/testproject/logger"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/notifier"
+	"github.com/aniket0951/testproject/repositories"
+)
+
+// how many outbox entries one ProcessOutbox run sends at most
+const outboxBatchSize = 100
+
+// NotificationSettings tunes delivery of alert notifications
+type NotificationSettings struct {
+	Enabled     bool
+	Routes      []config.NotificationRoute
+	RateLimit   time.Duration
+	MaxAttempts int
+	// first retry delay, doubled on every further attempt
+	RetryBackoff time.Duration
+	// zone the alert times are written in
+	Location *time.Location
+}
+
+type NotificationService interface {
+	// NotifyAlertEvents queues a message per matching route in the outbox,
+	// nothing is sent inline so a slow channel can't hold the caller
+	NotifyAlertEvents(ctx context.Context, events []models.AlertEvent) error
+	// ProcessOutbox sends the due outbox entries and returns how many were sent
+	ProcessOutbox(ctx context.Context) (int, error)
+}
+
+type notificationservice struct {
+	notificationRepository repositories.NotificationRepository
+	notifiers              map[string]notifier.Notifier
+	templates              *notifier.Templates
+	settings               NotificationSettings
+
+	mu sync.Mutex
+	// last time a route notified about an alert type of a subject
+	lastSent map[string]time.Time
+}
+
+func NewNotificationService(repo repositories.NotificationRepository, notifiers map[string]notifier.Notifier, templates *notifier.Templates, settings NotificationSettings) NotificationService {
+	if settings.Location == nil {
+		settings.Location = time.UTC
+	}
+
+	return &notificationservice{
+		notificationRepository: repo,
+		notifiers:              notifiers,
+		templates:              templates,
+		settings:               settings,
+		lastSent:               map[string]time.Time{},
+	}
+}
+
+func (s *notificationservice) NotifyAlertEvents(ctx context.Context, events []models.AlertEvent) error {
+	if !s.settings.Enabled || len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	notifications := []models.Notification{}
+	// rate limit keys of the notifications queued below, they only count
+	// towards the window once they are stored
+	queued := map[string]bool{}
+
+	for i := range events {
+		event := events[i]
+		for j := range s.settings.Routes {
+			route := s.settings.Routes[j]
+			key := rateLimitKey(route, event)
+			if !routeMatches(route, event) || s.rateLimited(key, now) || (queued[key] && s.settings.RateLimit > 0) {
+				continue
+			}
+
+			subject, body, err := s.templates.Render(notifier.TemplateData{
+				AlertType:   event.AlertType,
+				Severity:    event.Severity,
+				Event:       event.Event,
+				SubjectType: event.SubjectType,
+				SubjectId:   event.SubjectId,
+				Field:       event.Field,
+				Value:       event.Value,
+				Time:        event.Time.In(s.settings.Location),
+			})
+			if err != nil {
+				logger.From(ctx).WithField("alert_type", event.AlertType).WithError(err).Error("failed to render the notification")
+				continue
+			}
+
+			notifications = append(notifications, models.Notification{
+				Route:         route.Name,
+				Channel:       route.Channel,
+				Recipients:    route.Recipients,
+				Subject:       subject,
+				Body:          body,
+				IncidentId:    event.IncidentId,
+				AlertType:     event.AlertType,
+				Severity:      event.Severity,
+				Event:         event.Event,
+				SubjectType:   event.SubjectType,
+				SubjectId:     event.SubjectId,
+				Value:         event.Value,
+				AlertTime:     event.Time,
+				Status:        models.NotificationPending,
+				NextAttemptAt: now,
+			})
+			queued[key] = true
+		}
+	}
+
+	if err := s.notificationRepository.AddNotifications(ctx, notifications); err != nil {
+		return fmt.Errorf("queue notifications : %w", err)
+	}
+	s.recordSent(queued, now)
+	return nil
+}
+
+func (s *notificationservice) ProcessOutbox(ctx context.Context) (int, error) {
+	due, err := s.notificationRepository.GetDueNotifications(ctx, time.Now().UTC(), outboxBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("load notification outbox : %w", err)
+	}
+
+	sent := 0
+	var errs []error
+	for i := range due {
+		errs = appendIfErr(errs, s.deliver(ctx, &due[i]))
+		if due[i].Status == models.NotificationSent {
+			sent++
+		}
+	}
+	if len(errs) > 0 {
+		return sent, fmt.Errorf("save %d notifications failed, first error : %w", len(errs), errs[0])
+	}
+	return sent, nil
+}
+
+// deliver makes one send attempt and stores the outcome, only a failure to
+// store it is returned
+func (s *notificationservice) deliver(ctx context.Context, notification *models.Notification) error {
+	notification.Attempts++
+
+	var sendErr error
+	channel, ok := s.notifiers[notification.Channel]
+	if !ok {
+		sendErr = fmt.Errorf("notification channel %q is not configured", notification.Channel)
+	} else {
+		sendErr = channel.Send(ctx, notifier.Message{
+			Recipients: notification.Recipients,
+			Subject:    notification.Subject,
+			Body:       notification.Body,
+			Data:       notification,
+		})
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case sendErr == nil:
+		notification.Status = models.NotificationSent
+		notification.SentAt = now
+		notification.LastError = ""
+	case notification.Attempts >= s.settings.MaxAttempts:
+		notification.Status = models.NotificationFailed
+		notification.LastError = sendErr.Error()
+		logger.From(ctx).WithFields(logger.Fields{
+			"channel":         notification.Channel,
+			"notification_id": notification.Id.Hex(),
+		}).WithError(sendErr).Error("giving up on the notification")
+	default:
+		notification.LastError = sendErr.Error()
+		notification.NextAttemptAt = now.Add(s.settings.RetryBackoff << (notification.Attempts - 1))
+	}
+
+	return s.notificationRepository.SaveNotification(ctx, notification)
+}
+
+func rateLimitKey(route config.NotificationRoute, event models.AlertEvent) string {
+	return route.Name + "|" + route.Channel + "|" + event.AlertType + "|" + event.SubjectType + "|" + event.SubjectId + "|" + event.Event
+}
+
+// rateLimited reports whether the route already notified about the alert
+// type of the subject within the window
+func (s *notificationservice) rateLimited(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.lastSent[key]
+	return ok && now.Sub(last) < s.settings.RateLimit
+}
+
+// recordSent starts the window of the queued notifications
+func (s *notificationservice) recordSent(keys map[string]bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range keys {
+		s.lastSent[key] = now
+	}
+
+	// forget keys outside the window so the map doesn't grow forever
+	for k, last := range s.lastSent {
+		if now.Sub(last) >= s.settings.RateLimit {
+			delete(s.lastSent, k)
+		}
+	}
+}
+
+func routeMatches(route config.NotificationRoute, event models.AlertEvent) bool {
+	switch event.Event {
+	case models.AlertEventFired, models.AlertEventReopened:
+	case models.AlertEventCleared:
+		if !route.OnClear {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if severityRank(event.Severity) < severityRank(route.MinSeverity) {
+		return false
+	}
+
+	if len(route.AlertTypes) == 0 {
+		return true
+	}
+	for _, alertType := range route.AlertTypes {
+		if alertType == event.AlertType {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case models.AlertSeverityCritical:
+		return 2
+	case models.AlertSeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aniket0951/testproject/config"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/notifier"
+)
+
+// fakeNotificationRepository keeps the outbox in memory, AddNotifications
+// fails while failAdd is set
+type fakeNotificationRepository struct {
+	queued  []models.Notification
+	failAdd bool
+}
+
+func (f *fakeNotificationRepository) EnsureIndexes(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeNotificationRepository) AddNotifications(ctx context.Context, notifications []models.Notification) error {
+	if f.failAdd {
+		return errors.New("outbox unavailable")
+	}
+	f.queued = append(f.queued, notifications...)
+	return nil
+}
+
+func (f *fakeNotificationRepository) GetDueNotifications(ctx context.Context, now time.Time, limit int64) ([]models.Notification, error) {
+	return nil, nil
+}
+
+func (f *fakeNotificationRepository) SaveNotification(ctx context.Context, notification *models.Notification) error {
+	return nil
+}
+
+func TestNotifyAlertEventsRateLimit(t *testing.T) {
+	templates, err := notifier.NewTemplates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeNotificationRepository{}
+	service := NewNotificationService(repo, nil, templates, NotificationSettings{
+		Enabled:   true,
+		Routes:    []config.NotificationRoute{{Name: "on-call", Channel: config.ChannelSMS, Recipients: []string{"+911234567890"}}},
+		RateLimit: time.Hour,
+	})
+	fired := models.AlertEvent{
+		AlertType:   models.AlertTypeOverspeed,
+		Severity:    models.AlertSeverityCritical,
+		SubjectType: models.AlertSourceVehicle,
+		SubjectId:   "MH12AB1234",
+		Event:       models.AlertEventFired,
+		Time:        time.Now(),
+	}
+	ctx := context.Background()
+
+	repo.failAdd = true
+	if err := service.NotifyAlertEvents(ctx, []models.AlertEvent{fired}); err == nil {
+		t.Fatal("want the outbox error")
+	}
+
+	// the failed insert must not mute the route
+	repo.failAdd = false
+	if err := service.NotifyAlertEvents(ctx, []models.AlertEvent{fired, fired}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.queued) != 1 {
+		t.Fatalf("queued %d notifications, want 1", len(repo.queued))
+	}
+
+	if err := service.NotifyAlertEvents(ctx, []models.AlertEvent{fired}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.queued) != 1 {
+		t.Fatalf("queued %d notifications inside the rate limit window, want 1", len(repo.queued))
+	}
+}
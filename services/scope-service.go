@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/repositories"
+)
+
+// ScopeService resolves which vehicles and batteries a scoped user may see.
+// Every method returns nil ids for the unrestricted scope.
+type ScopeService interface {
+	VehicleNumbers(ctx context.Context, scope models.Scope) ([]string, error)
+	BmsIds(ctx context.Context, scope models.Scope) ([]string, error)
+	// SubjectIds are the vehicle numbers and bms ids together, alert
+	// history and incidents mix both
+	SubjectIds(ctx context.Context, scope models.Scope) ([]string, error)
+
+	CanSeeVehicle(ctx context.Context, scope models.Scope, vehicleNo string) (bool, error)
+	CanSeeBattery(ctx context.Context, scope models.Scope, bmsId string) (bool, error)
+	CanSeeSubject(ctx context.Context, scope models.Scope, subjectId string) (bool, error)
+}
+
+type scopeservice struct {
+	vehicleRepository repositories.VehicleRepository
+	batteryRepository repositories.BatteryRepository
+}
+
+func NewScopeService(vehicleRepo repositories.VehicleRepository, batteryRepo repositories.BatteryRepository) ScopeService {
+	return &scopeservice{
+		vehicleRepository: vehicleRepo,
+		batteryRepository: batteryRepo,
+	}
+}
+
+func (s *scopeservice) VehicleNumbers(ctx context.Context, scope models.Scope) ([]string, error) {
+	if scope.Unrestricted() {
+		return nil, nil
+	}
+	return s.vehicleRepository.GetScopeVehicleNumbers(ctx, scope)
+}
+
+func (s *scopeservice) BmsIds(ctx context.Context, scope models.Scope) ([]string, error) {
+	if scope.Unrestricted() {
+		return nil, nil
+	}
+	return s.batteryRepository.GetScopeBmsIds(ctx, scope)
+}
+
+func (s *scopeservice) SubjectIds(ctx context.Context, scope models.Scope) ([]string, error) {
+	if scope.Unrestricted() {
+		return nil, nil
+	}
+
+	vehicles, err := s.VehicleNumbers(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	batteries, err := s.BmsIds(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	return append(vehicles, batteries...), nil
+}
+
+func (s *scopeservice) CanSeeVehicle(ctx context.Context, scope models.Scope, vehicleNo string) (bool, error) {
+	if scope.Unrestricted() {
+		return true, nil
+	}
+
+	vehicles, err := s.VehicleNumbers(ctx, scope)
+	if err != nil {
+		return false, err
+	}
+	return containsString(vehicles, vehicleNo), nil
+}
+
+func (s *scopeservice) CanSeeBattery(ctx context.Context, scope models.Scope, bmsId string) (bool, error) {
+	if scope.Unrestricted() {
+		return true, nil
+	}
+
+	batteries, err := s.BmsIds(ctx, scope)
+	if err != nil {
+		return false, err
+	}
+	return containsString(batteries, bmsId), nil
+}
+
+func (s *scopeservice) CanSeeSubject(ctx context.Context, scope models.Scope, subjectId string) (bool, error) {
+	if scope.Unrestricted() {
+		return true, nil
+	}
+
+	subjects, err := s.SubjectIds(ctx, scope)
+	if err != nil {
+		return false, err
+	}
+	return containsString(subjects, subjectId), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
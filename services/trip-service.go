@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/repositories"
+)
+
+// TripSettings tunes how the fix stream is cut into trips
+type TripSettings struct {
+	// below this speed a vehicle with the ignition on counts as idling
+	MinMovingSpeedKmph float64
+	// an open trip is closed when the vehicle stays silent for longer
+	MaxGap time.Duration
+	// shorter trips are dropped, they are mostly ignition flicks in the yard
+	MinDistanceKm float64
+}
+
+type TripService interface {
+	ProcessTrackPoints(ctx context.Context, points []models.VehicleTrackPoint) error
+	RecordAlert(ctx context.Context, vehicleNo string) error
+	GetVehicleTrips(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleTrip, error)
+}
+
+type tripservice struct {
+	tripRepository repositories.TripRepository
+	gpsFilter      helper.GPSFilter
+	settings       TripSettings
+}
+
+func NewTripService(repo repositories.TripRepository, gpsFilter helper.GPSFilter, settings TripSettings) TripService {
+	return &tripservice{
+		tripRepository: repo,
+		gpsFilter:      gpsFilter,
+		settings:       settings,
+	}
+}
+
+// ProcessTrackPoints folds a batch of fixes into the open trips, opening,
+// extending and closing trips as the vehicles start and stop
+func (s *tripservice) ProcessTrackPoints(ctx context.Context, points []models.VehicleTrackPoint) error {
+	openTrips, err := s.tripRepository.GetOpenTrips(ctx)
+	if err != nil {
+		return fmt.Errorf("load open trips : %w", err)
+	}
+
+	open := map[string]*models.VehicleTrip{}
+	for i := range openTrips {
+		open[openTrips[i].VehicleNo] = &openTrips[i]
+	}
+
+	sorted := make([]models.VehicleTrackPoint, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	closed := []*models.VehicleTrip{}
+	touched := map[string]bool{}
+
+	for i := range sorted {
+		vehicleNo := sorted[i].VehicleNo
+		next, finished := s.step(open[vehicleNo], sorted[i])
+		if finished != nil {
+			closed = append(closed, finished)
+		}
+
+		if next == nil {
+			delete(open, vehicleNo)
+		} else {
+			open[vehicleNo] = next
+		}
+		touched[vehicleNo] = true
+	}
+
+	// vehicles that went silent never send the fix that would close their trip
+	now := time.Now().UTC()
+	for vehicleNo, trip := range open {
+		if !touched[vehicleNo] && now.Sub(trip.LastFix.Time) > s.settings.MaxGap {
+			s.close(trip)
+			closed = append(closed, trip)
+			delete(open, vehicleNo)
+		}
+	}
+
+	// closed trips go first, the new open trip of the same vehicle would
+	// otherwise collide with the one-open-trip-per-vehicle index
+	var errs []error
+	for _, trip := range closed {
+		if trip.DistanceKm < s.settings.MinDistanceKm {
+			if !trip.Id.IsZero() {
+				errs = appendIfErr(errs, s.tripRepository.DeleteTrip(ctx, trip.Id))
+			}
+			continue
+		}
+		errs = appendIfErr(errs, s.tripRepository.SaveTrip(ctx, trip))
+	}
+
+	for vehicleNo, trip := range open {
+		if touched[vehicleNo] {
+			errs = appendIfErr(errs, s.tripRepository.SaveTrip(ctx, trip))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("save %d trips failed, first error : %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// step folds one fix into the vehicle's open trip. It returns the trip that
+// is open afterwards (nil when the vehicle is parked) and the trip it closed.
+func (s *tripservice) step(open *models.VehicleTrip, point models.VehicleTrackPoint) (*models.VehicleTrip, *models.VehicleTrip) {
+	var closed *models.VehicleTrip
+
+	if open != nil {
+		// the track store can hand us a fix we have already folded in
+		if !point.Time.After(open.LastFix.Time) {
+			return open, nil
+		}
+
+		if point.Time.Sub(open.LastFix.Time) > s.settings.MaxGap {
+			s.close(open)
+			closed, open = open, nil
+		} else {
+			s.extend(open, point)
+			if !s.active(point) {
+				s.close(open)
+				return nil, open
+			}
+			return open, nil
+		}
+	}
+
+	if s.active(point) {
+		return s.start(point), closed
+	}
+	return nil, closed
+}
+
+// active is true while the ignition is on or the vehicle moves, a towed
+// vehicle with the ignition off still makes a trip
+func (s *tripservice) active(point models.VehicleTrackPoint) bool {
+	return point.Running ||
+		(point.IgnitionKnown && point.Ignition) ||
+		point.Speed >= s.settings.MinMovingSpeedKmph
+}
+
+func (s *tripservice) start(point models.VehicleTrackPoint) *models.VehicleTrip {
+	location := models.TripLocation{Latitude: point.Latitude, Longitude: point.Longitude, Location: point.Location}
+
+	return &models.VehicleTrip{
+		VehicleNo:     point.VehicleNo,
+		Status:        models.TripStatusOpen,
+		StartTime:     point.Time,
+		EndTime:       point.Time,
+		StartLocation: location,
+		EndLocation:   location,
+		MaxSpeed:      point.Speed,
+		PointCount:    1,
+		LastFix: models.TripFix{
+			Time:      point.Time,
+			Latitude:  point.Latitude,
+			Longitude: point.Longitude,
+			Speed:     point.Speed,
+		},
+	}
+}
+
+func (s *tripservice) extend(trip *models.VehicleTrip, point models.VehicleTrackPoint) {
+	elapsed := point.Time.Sub(trip.LastFix.Time)
+
+	origin := helper.GPSFix{
+		Point: helper.Coordinates{Latitude: trip.LastFix.Latitude, Longitude: trip.LastFix.Longitude},
+		Time:  trip.LastFix.Time,
+	}
+	fix := helper.GPSFix{
+		Point:       helper.Coordinates{Latitude: point.Latitude, Longitude: point.Longitude},
+		Time:        point.Time,
+		IgnitionOff: point.IgnitionKnown && !point.Ignition,
+	}
+
+	// a rejected fix keeps the last good position as the origin
+	if distance, reason := s.gpsFilter.Accept(origin, fix); reason == "" {
+		trip.DistanceKm += distance
+		trip.LastFix.Latitude = point.Latitude
+		trip.LastFix.Longitude = point.Longitude
+		trip.EndLocation = models.TripLocation{Latitude: point.Latitude, Longitude: point.Longitude, Location: point.Location}
+	}
+
+	if point.Speed < s.settings.MinMovingSpeedKmph {
+		trip.IdleSeconds += int64(elapsed.Seconds())
+	}
+	if point.Speed > trip.MaxSpeed {
+		trip.MaxSpeed = point.Speed
+	}
+
+	trip.LastFix.Time = point.Time
+	trip.LastFix.Speed = point.Speed
+	trip.EndTime = point.Time
+	trip.PointCount++
+	trip.DurationSeconds = int64(trip.EndTime.Sub(trip.StartTime).Seconds())
+
+	if moving := trip.DurationSeconds - trip.IdleSeconds; moving > 0 {
+		trip.AvgSpeed = trip.DistanceKm / (float64(moving) / 3600)
+	}
+}
+
+func (s *tripservice) close(trip *models.VehicleTrip) {
+	trip.Status = models.TripStatusClosed
+}
+
+func (s *tripservice) RecordAlert(ctx context.Context, vehicleNo string) error {
+	return s.tripRepository.IncrementOpenTripAlerts(ctx, vehicleNo)
+}
+
+func (s *tripservice) GetVehicleTrips(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleTrip, error) {
+	if !from.Before(to) {
+		return nil, errors.New("trip range start has to be before its end")
+	}
+	return s.tripRepository.GetTrips(ctx, vehicleNo, from.UTC(), to.UTC())
+}
+
+func appendIfErr(errs []error, err error) []error {
+	if err != nil {
+		return append(errs, err)
+	}
+	return errs
+}
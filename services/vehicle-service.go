@@ -1,166 +1,282 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 	"sync"
 	"time"
 
+	"github.com/aniket0951/testproject/helper"
+	"github.com/aniket0951/testproject/jobs"
+	"github.com/aniket0951/testproject/logger"
 	"github.com/aniket0951/testproject/models"
+	"github.com/aniket0951/testproject/proxyapis"
 	"github.com/aniket0951/testproject/repositories"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 var wg sync.WaitGroup
-var overSpeedLimitChannel int
-var maxAngleLimit int
-var minAngleLimit int
 
 type VehicleServices interface {
-	AddUpdateVehicleInformation(vehicleInfo []models.VehiclesData) bool
-	RefreshVehicleData() error
-	AddVehicleLocationData(vehicleLocation []models.VehicleLocationData)
-
-	TrackVehicleAlert(vehicleData []models.VehiclesData) error
-	VerifyVehicleForAlert(vehicleData []models.VehiclesData) error
-	UpdateVehicleAlert(vehicleData models.VehicleAlerts) error
-	UpdateVehicleFallAlert(vehicleAlert models.VehicleFallAlerts) error
-	CreateVehicleAlertHistory() error
-	CreateDistanceTravelHistory() error
-	CreateBatteryTemperatureHistory() error
-
-	BatteryTempToMain() error
-	CheckForBatteryCycle() error
-
-	AddTestData() error
+	AddUpdateVehicleInformation(ctx context.Context, vehicleInfo []models.VehiclesData) bool
+	RefreshVehicleData(ctx context.Context) error
+	AddVehicleLocationData(ctx context.Context, vehicleLocation []models.VehicleLocationData)
+	GetVehicleTrack(ctx context.Context, vehicleNo string, from, to time.Time, interval time.Duration) ([]models.VehicleTrackPoint, error)
+	GetVehicleTrips(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleTrip, error)
+	GetVehicleStateEvents(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleStateEvent, error)
+	ListVehicles(ctx context.Context, filter models.VehicleFilter, page models.PageRequest) ([]models.VehiclesData, int64, error)
+	GetAlertHistory(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]bson.M, int64, error)
+
+	TrackVehicleAlert(ctx context.Context, vehicleData []models.VehiclesData) error
+	VerifyVehicleForAlert(ctx context.Context, vehicleData []models.VehiclesData) error
+	UpdateVehicleAlert(ctx context.Context, vehicleData models.VehicleAlerts) error
+	UpdateVehicleFallAlert(ctx context.Context, vehicleAlert models.VehicleFallAlerts) error
+	CreateVehicleAlertHistory(ctx context.Context) error
+	CreateDistanceTravelHistory(ctx context.Context) error
+	CreateBatteryTemperatureHistory(ctx context.Context) error
+
+	BatteryTempToMain(ctx context.Context) error
+	CheckForBatteryCycle(ctx context.Context) error
+
+	AddTestData(ctx context.Context) error
 }
 
 type vehicleservice struct {
 	vehicleRepository repositories.VehicleRepository
+	trackRepository   repositories.TrackRepository
+	tripService       TripService
+	geofenceService   GeofenceService
+	alertService      AlertService
 	batteryService    BatteryService
+	snapshotOptions   models.SnapshotOptions
 }
 
-func NewVehicleService(repo repositories.VehicleRepository, batteryService BatteryService) VehicleServices {
+func NewVehicleService(repo repositories.VehicleRepository, trackRepo repositories.TrackRepository, tripService TripService, geofenceService GeofenceService, alertService AlertService, batteryService BatteryService, snapshotOptions models.SnapshotOptions) VehicleServices {
 	return &vehicleservice{
 		vehicleRepository: repo,
+		trackRepository:   trackRepo,
+		tripService:       tripService,
+		geofenceService:   geofenceService,
+		alertService:      alertService,
 		batteryService:    batteryService,
+		snapshotOptions:   snapshotOptions,
 	}
 }
 
-func (ser *vehicleservice) AddUpdateVehicleInformation(vehicleInfo []models.VehiclesData) bool {
+func (ser *vehicleservice) AddUpdateVehicleInformation(ctx context.Context, vehicleInfo []models.VehiclesData) bool {
 	for i := range vehicleInfo {
-		ser.vehicleRepository.AddUpdateVehicleInformation(vehicleInfo[i])
+		ser.vehicleRepository.AddUpdateVehicleInformation(ctx, vehicleInfo[i])
 	}
 	return true
 }
 
-func (ser *vehicleservice) AddVehicleLocationData(vehicleLocation []models.VehicleLocationData) {
+func (ser *vehicleservice) AddVehicleLocationData(ctx context.Context, vehicleLocation []models.VehicleLocationData) {
 
 	for i := range vehicleLocation {
-		ser.vehicleRepository.AddVehicleLocationData(vehicleLocation[i])
-		break
+		ser.vehicleRepository.AddVehicleLocationData(ctx, vehicleLocation[i])
 	}
 }
 
-func (s *vehicleservice) RefreshVehicleData() error {
-	vehicleData, err := s.vehicleRepository.RefreshVehicleData()
+func (ser *vehicleservice) GetVehicleTrack(ctx context.Context, vehicleNo string, from, to time.Time, interval time.Duration) ([]models.VehicleTrackPoint, error) {
+	if !from.Before(to) {
+		return nil, errors.New("track range start has to be before its end")
+	}
+	return ser.trackRepository.GetVehicleTrack(ctx, vehicleNo, from.UTC(), to.UTC(), interval)
+}
+
+func (ser *vehicleservice) GetVehicleTrips(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleTrip, error) {
+	return ser.tripService.GetVehicleTrips(ctx, vehicleNo, from, to)
+}
+
+func (ser *vehicleservice) GetVehicleStateEvents(ctx context.Context, vehicleNo string, from, to time.Time) ([]models.VehicleStateEvent, error) {
+	if !from.Before(to) {
+		return nil, errors.New("event range start has to be before its end")
+	}
+	return ser.vehicleRepository.GetVehicleStateEvents(ctx, vehicleNo, from.UTC(), to.UTC())
+}
+
+func (ser *vehicleservice) ListVehicles(ctx context.Context, filter models.VehicleFilter, page models.PageRequest) ([]models.VehiclesData, int64, error) {
+	return ser.vehicleRepository.ListVehicles(ctx, filter, page)
+}
+
+func (ser *vehicleservice) GetAlertHistory(ctx context.Context, filter models.ReportFilter, page models.PageRequest) ([]bson.M, int64, error) {
+	return ser.vehicleRepository.GetAlertHistory(ctx, filter, page)
+}
+
+func (s *vehicleservice) RefreshVehicleData(ctx context.Context) error {
+	vehicleData, err := s.vehicleRepository.RefreshVehicleData(ctx)
 
 	if err != nil {
-		return err
+		// the feed only allows a few polls per window, the next run catches up
+		if errors.Is(err, proxyapis.ErrRateLimited) {
+			logger.From(ctx).WithError(err).Warn("vehicle feed rate limited, skipping the refresh")
+			return nil
+		}
+		return fmt.Errorf("refresh vehicle data : %w", err)
 	}
+	// the stored snapshots are what the state transitions are compared against
+	stored, err := s.vehicleRepository.GetAllVehicles(ctx)
+	if err != nil {
+		return fmt.Errorf("load stored vehicles : %w", err)
+	}
+	previous := map[string]models.VehiclesData{}
+	for i := range stored {
+		previous[stored[i].VehicleNo] = stored[i]
+	}
+
 	vehicleDataForAlerts := []models.VehiclesData{}
+	trackPoints := []models.VehicleTrackPoint{}
+	stateEvents := []models.VehicleStateEvent{}
+	stateResults := []RuleResult{}
+	geofenceFixes := []models.GeofenceFix{}
+	receivedAt := time.Now()
+	staleFixes := 0
 
 	for i := range vehicleData {
+		snapshot := models.ParseVehicleSnapshot(vehicleData[i], receivedAt, s.snapshotOptions)
+		vehicleData[i].Snapshot = &snapshot
+
+		if invalid := snapshot.InvalidFields(); len(invalid) > 0 {
+			logger.From(ctx).WithFields(logger.Fields{
+				logger.FieldVehicleNo: vehicleData[i].VehicleNo,
+				"fields":              invalid,
+			}).Warn("vehicle sent unparsable values")
+		}
 
-		go func() {
-			if vehicleData[i].Status == "RUNNING" {
-				vehicleDataForAlerts = append(vehicleDataForAlerts, vehicleData[i])
-			}
-		}()
-
-		vehicleData[i].TimeStamp = primitive.NewDateTimeFromTime(time.Now())
-		insErr := s.vehicleRepository.UpdateVehicleData(vehicleData[i])
+		insErr := s.vehicleRepository.UpdateVehicleData(ctx, vehicleData[i])
 
+		if errors.Is(insErr, repositories.ErrStaleFix) {
+			// an out of order fix must neither move the vehicle nor raise alerts
+			staleFixes++
+			continue
+		}
 		if insErr != nil {
 			return insErr
 		}
 
-	}
-
-	serr := s.TrackVehicleAlert(vehicleDataForAlerts)
-
-	return serr
-}
+		if prev, ok := previous[vehicleData[i].VehicleNo]; ok {
+			events, results := DetectStateTransitions(vehicleData[i].VehicleNo, prev.TypedSnapshot(), snapshot)
+			stateEvents = append(stateEvents, events...)
+			stateResults = append(stateResults, results...)
+		}
 
-func (s *vehicleservice) TrackVehicleAlert(vehicleData []models.VehiclesData) error {
-	var res models.AlertConfig
-	var err error
-	res, err = s.vehicleRepository.GetAlertLimit("overspeed")
+		if snapshot.HasPosition() {
+			trackPoints = append(trackPoints, models.NewVehicleTrackPoint(vehicleData[i], snapshot))
+			geofenceFixes = append(geofenceFixes, models.GeofenceFix{
+				SubjectType: models.GeofenceSubjectVehicle,
+				SubjectId:   vehicleData[i].VehicleNo,
+				Branch:      vehicleData[i].Branch,
+				Point:       models.GeoPoint{Latitude: snapshot.Latitude, Longitude: snapshot.Longitude},
+				Time:        snapshot.FixTime(),
+			})
+		}
 
-	if err != nil {
-		overSpeedLimitChannel = 60
-	} else {
-		overSpeedLimitChannel = int(res.MaxLimit)
+		// rules decide themselves whether they only apply while moving
+		vehicleDataForAlerts = append(vehicleDataForAlerts, vehicleData[i])
 	}
 
-	fallLimit, err := s.vehicleRepository.GetAlertLimit("fall")
-
-	if err != nil {
-		maxAngleLimit = 135
-		minAngleLimit = 45
-	} else {
-		maxAngleLimit = int(fallLimit.MaxLimit)
-		minAngleLimit = int(fallLimit.MinLimit)
+	if staleFixes > 0 {
+		logger.From(ctx).WithField("count", staleFixes).Info("skipped stale vehicle fixes")
+	}
+	jobs.AddItems(ctx, "vehicles", len(vehicleData))
+	jobs.AddItems(ctx, "stale", staleFixes)
+	jobs.AddItems(ctx, "track_points", len(trackPoints))
+	jobs.AddItems(ctx, "state_events", len(stateEvents))
+
+	// losing track points is not worth failing the refresh and its alerts
+	trackCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if trackErr := s.trackRepository.InsertTrackPoints(trackCtx, trackPoints); trackErr != nil {
+		logger.From(ctx).WithError(trackErr).Error("failed to store vehicle track points")
+	}
+	if tripErr := s.tripService.ProcessTrackPoints(trackCtx, trackPoints); tripErr != nil {
+		logger.From(ctx).WithError(tripErr).Error("failed to update vehicle trips")
+	}
+	if fenceErr := s.geofenceService.Evaluate(trackCtx, models.GeofenceSubjectVehicle, geofenceFixes); fenceErr != nil {
+		logger.From(ctx).WithError(fenceErr).Error("failed to evaluate vehicle geofences")
+	}
+	if stateErr := s.vehicleRepository.AddVehicleStateEvents(trackCtx, stateEvents); stateErr != nil {
+		logger.From(ctx).WithError(stateErr).Error("failed to store vehicle state events")
+	}
+	for i := range stateResults {
+		if stateResults[i].Status == RuleFired {
+			s.recordTripAlert(ctx, stateResults[i].SubjectId)
+		}
+	}
+	if alertErr := s.alertService.RecordResults(trackCtx, stateResults); alertErr != nil {
+		logger.From(ctx).WithError(alertErr).Error("failed to record vehicle state alerts")
 	}
 
-	// res, err := s.vehicleRepository.TrackVehicleAlert()
+	serr := s.TrackVehicleAlert(ctx, vehicleDataForAlerts)
 
-	// if err != nil {
-	// 	fmt.Println("Error occur from TrackVehicleAlert", err)
-	// 	return err
-	// }
+	return serr
+}
+
+func (s *vehicleservice) TrackVehicleAlert(ctx context.Context, vehicleData []models.VehiclesData) error {
+	// rules are re-read every run so alert_config edits apply without a restart
+	if err := s.alertService.ReloadRules(ctx); err != nil {
+		logger.From(ctx).WithError(err).Warn("using the previous alert rules")
+	}
 
-	verErr := s.VerifyVehicleForAlert(vehicleData)
+	verErr := s.VerifyVehicleForAlert(ctx, vehicleData)
 	return verErr
 }
 
-func (s *vehicleservice) VerifyVehicleForAlert(vehicleData []models.VehiclesData) error {
-	for i := range vehicleData {
-		speed, _ := strconv.Atoi(vehicleData[i].Speed)
-
-		angel, _ := strconv.Atoi(vehicleData[i].Angle)
+func (s *vehicleservice) VerifyVehicleForAlert(ctx context.Context, vehicleData []models.VehiclesData) error {
+	allResults := []RuleResult{}
 
-		if speed >= overSpeedLimitChannel {
-			vehicleAlertData, _ := s.vehicleRepository.GetVehicleAlertById(vehicleData[i].VehicleNo)
+	for i := range vehicleData {
+		snapshot := vehicleData[i].TypedSnapshot()
+		results := s.alertService.EvaluateVehicle(vehicleData[i].VehicleNo, snapshot)
 
-			if reflect.DeepEqual(vehicleAlertData, models.VehicleAlerts{}) {
-				vehicleAlertData.BikeNo = vehicleData[i].VehicleNo
+		for j := range results {
+			if results[j].Status == RuleCleared {
+				continue
 			}
 
-			vehicleAlertData.BikeSpeed = append(vehicleAlertData.BikeSpeed, speed)
-			_ = s.UpdateVehicleAlert(vehicleAlertData)
+			// the legacy alert collections keep counting every reading over the limit
+			switch results[j].Rule.AlertType {
+			case models.AlertTypeOverspeed:
+				vehicleAlertData, _ := s.vehicleRepository.GetVehicleAlertById(ctx, vehicleData[i].VehicleNo)
 
-		}
+				if reflect.DeepEqual(vehicleAlertData, models.VehicleAlerts{}) {
+					vehicleAlertData.BikeNo = vehicleData[i].VehicleNo
+				}
 
-		if angel < 0 || angel > maxAngleLimit {
-			vehicleAlertData, _ := s.vehicleRepository.GetVehicleFallAlertById(vehicleData[i].VehicleNo)
+				vehicleAlertData.BikeSpeed = append(vehicleAlertData.BikeSpeed, int(results[j].Value))
+				_ = s.UpdateVehicleAlert(ctx, vehicleAlertData)
+			case models.AlertTypeFall:
+				vehicleAlertData, _ := s.vehicleRepository.GetVehicleFallAlertById(ctx, vehicleData[i].VehicleNo)
 
-			if reflect.DeepEqual(vehicleAlertData, models.VehicleFallAlerts{}) {
-				vehicleAlertData.BikeNo = vehicleData[i].VehicleNo
+				if reflect.DeepEqual(vehicleAlertData, models.VehicleFallAlerts{}) {
+					vehicleAlertData.BikeNo = vehicleData[i].VehicleNo
+				}
+
+				vehicleAlertData.BikeAngle = append(vehicleAlertData.BikeAngle, int(results[j].Value))
+				_ = s.UpdateVehicleFallAlert(ctx, vehicleAlertData)
 			}
 
-			vehicleAlertData.BikeAngle = append(vehicleAlertData.BikeAngle, angel)
+			if results[j].Status == RuleFired {
+				s.recordTripAlert(ctx, vehicleData[i].VehicleNo)
+			}
+		}
 
-			_ = s.UpdateVehicleFallAlert(vehicleAlertData)
+		allResults = append(allResults, results...)
+	}
 
-		}
+	return s.alertService.RecordResults(ctx, allResults)
+}
 
+// recordTripAlert counts the alert on the vehicle's open trip
+func (s *vehicleservice) recordTripAlert(ctx context.Context, vehicleNo string) {
+	if err := s.tripService.RecordAlert(ctx, vehicleNo); err != nil {
+		logger.From(ctx).WithField(logger.FieldVehicleNo, vehicleNo).WithError(err).Error("failed to count the alert on the open trip")
 	}
-	return nil
 }
 
-func (s *vehicleservice) UpdateVehicleAlert(vehicleAlert models.VehicleAlerts) error {
+func (s *vehicleservice) UpdateVehicleAlert(ctx context.Context, vehicleAlert models.VehicleAlerts) error {
 
 	if (reflect.DeepEqual(vehicleAlert, models.VehicleAlerts{})) {
 		vehicleAlert.AlertCount = 0
@@ -168,12 +284,12 @@ func (s *vehicleservice) UpdateVehicleAlert(vehicleAlert models.VehicleAlerts) e
 		vehicleAlert.AlertCount = vehicleAlert.AlertCount + 1
 	}
 
-	err := s.vehicleRepository.UpdateVehicleAlert(vehicleAlert)
+	err := s.vehicleRepository.UpdateVehicleAlert(ctx, vehicleAlert)
 
 	return err
 }
 
-func (s *vehicleservice) UpdateVehicleFallAlert(vehicleAlert models.VehicleFallAlerts) error {
+func (s *vehicleservice) UpdateVehicleFallAlert(ctx context.Context, vehicleAlert models.VehicleFallAlerts) error {
 
 	if (reflect.DeepEqual(vehicleAlert, models.VehicleFallAlerts{})) {
 		vehicleAlert.AlertCount = 0
@@ -181,33 +297,35 @@ func (s *vehicleservice) UpdateVehicleFallAlert(vehicleAlert models.VehicleFallA
 		vehicleAlert.AlertCount = vehicleAlert.AlertCount + 1
 	}
 
-	err := s.vehicleRepository.UpdateVehicleFallAlert(vehicleAlert)
+	err := s.vehicleRepository.UpdateVehicleFallAlert(ctx, vehicleAlert)
 
 	return err
 }
 
-func (s *vehicleservice) CreateVehicleAlertHistory() error {
-	res, err := s.vehicleRepository.GetOverSpeedAlerts()
+func (s *vehicleservice) CreateVehicleAlertHistory(ctx context.Context) error {
+	res, err := s.vehicleRepository.GetOverSpeedAlerts(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	s.vehicleRepository.CreateOverSpeedAlertHistory(res)
+	s.vehicleRepository.CreateOverSpeedAlertHistory(ctx, res)
+	jobs.AddItems(ctx, "overspeed", len(res))
 
-	fallAlerts, fallErr := s.vehicleRepository.GetAllVehicleFallAlerts()
+	fallAlerts, fallErr := s.vehicleRepository.GetAllVehicleFallAlerts(ctx)
 
 	if fallErr != nil {
 		return fallErr
 	} else {
-		err = s.vehicleRepository.CreateVehicleFallAlertHistory(fallAlerts)
+		err = s.vehicleRepository.CreateVehicleFallAlertHistory(ctx, fallAlerts)
+		jobs.AddItems(ctx, "fall", len(fallAlerts))
 	}
 
 	return err
 }
 
-func (s *vehicleservice) CreateDistanceTravelHistory() error {
-	vehicleData, err := s.vehicleRepository.GetAllVehicles()
+func (s *vehicleservice) CreateDistanceTravelHistory(ctx context.Context) error {
+	vehicleData, err := s.vehicleRepository.GetAllVehicles(ctx)
 
 	if err != nil {
 		return err
@@ -221,45 +339,87 @@ func (s *vehicleservice) CreateDistanceTravelHistory() error {
 		}
 	}
 
-	return s.vehicleRepository.CreateDistanceTravelHistory(requiredData)
+	jobs.AddItems(ctx, "vehicles", len(requiredData))
+	return s.vehicleRepository.CreateDistanceTravelHistory(ctx, requiredData)
 }
 
-func (s *vehicleservice) BatteryTempToMain() error {
-	return s.vehicleRepository.BatteryTempToMain()
+func (s *vehicleservice) BatteryTempToMain(ctx context.Context) error {
+	batteryData, err := s.vehicleRepository.BatteryTempToMain(ctx)
+	if err != nil {
+		return err
+	}
+	jobs.AddItems(ctx, "moved", len(batteryData))
+
+	fixes := []models.GeofenceFix{}
+	for i := range batteryData {
+		lat, lng := helper.FormatLatLngForFloat(batteryData[i].LocationLatitude, batteryData[i].LocationLongitude)
+
+		fixTime := batteryData[i].UpdatedAt.Time()
+		if batteryData[i].UpdatedAt == 0 {
+			fixTime = time.Now()
+		}
+
+		fixes = append(fixes, models.GeofenceFix{
+			SubjectType: models.GeofenceSubjectBattery,
+			SubjectId:   batteryData[i].BmsID,
+			Point:       models.GeoPoint{Latitude: lat, Longitude: lng},
+			Time:        fixTime.UTC(),
+		})
+	}
+
+	// only the geofence evaluation is bounded, the alerts get the rest of
+	// the job's time
+	fenceCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if fenceErr := s.geofenceService.Evaluate(fenceCtx, models.GeofenceSubjectBattery, fixes); fenceErr != nil {
+		logger.From(ctx).WithError(fenceErr).Error("failed to evaluate battery geofences")
+	}
+
+	if err := s.alertService.ReloadRules(ctx); err != nil {
+		logger.From(ctx).WithError(err).Warn("using the previous alert rules")
+	}
+	results := []RuleResult{}
+	for i := range batteryData {
+		results = append(results, s.alertService.EvaluateBattery(batteryData[i], fixes[i].Time)...)
+	}
+	if alertErr := s.alertService.RecordResults(ctx, results); alertErr != nil {
+		logger.From(ctx).WithError(alertErr).Error("failed to store battery alerts")
+	}
+	return nil
 }
 
-func (s *vehicleservice) CreateBatteryTemperatureHistory() error {
-	res, err := s.vehicleRepository.GetBatteryTemperatureData()
+func (s *vehicleservice) CreateBatteryTemperatureHistory(ctx context.Context) error {
+	res, err := s.vehicleRepository.GetBatteryTemperatureData(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := s.vehicleRepository.CreateBatteryTemperatureHistory(res); err != nil {
+	if err := s.vehicleRepository.CreateBatteryTemperatureHistory(ctx, res); err != nil {
 		return err
 	}
+	jobs.AddItems(ctx, "batteries", len(res))
 
 	return nil
 }
 
-func (s *vehicleservice) AddTestData() error {
-	return s.vehicleRepository.AddTestData()
+func (s *vehicleservice) AddTestData(ctx context.Context) error {
+	return s.vehicleRepository.AddTestData(ctx)
 }
 
-func (s *vehicleservice) CheckForBatteryCycle() error {
+func (s *vehicleservice) CheckForBatteryCycle(ctx context.Context) error {
 	// fetch all data from main
-	fmt.Println("Fetching data from main...")
-	batteryData, err := s.vehicleRepository.CheckForBatteryCycle()
+	batteryData, err := s.vehicleRepository.CheckForBatteryCycle(ctx)
 	if err != nil {
 		return err
 	}
-	fmt.Println("len of battery data : ", len(batteryData))
+	logger.From(ctx).WithField("count", len(batteryData)).Debug("fetched batteries for the cycle check")
 	var wg sync.WaitGroup
 	wg.Add(1)
 
 	//work for battery charge report
 	go func() {
 		defer wg.Done()
-		s.batteryService.CheckForBatteryChargingReport(batteryData)
+		s.batteryService.CheckForBatteryChargingReport(ctx, batteryData)
 	}()
 
 	// prepare for Cycle based report, Charging Report
@@ -272,7 +432,9 @@ func (s *vehicleservice) CheckForBatteryCycle() error {
 
 	}
 
-	upErr := s.vehicleRepository.UpdateBatteryCycle(newCycleReport)
+	upErr := s.vehicleRepository.UpdateBatteryCycle(ctx, newCycleReport)
 	wg.Wait()
+	jobs.AddItems(ctx, "batteries", len(batteryData))
+	jobs.AddItems(ctx, "cycles", len(newCycleReport))
 	return upErr
 }
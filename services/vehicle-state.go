@@ -0,0 +1,156 @@
+package services
+
+import (
+	"time"
+
+	"github.com/aniket0951/testproject/models"
+)
+
+// built in rules behind the state transition alerts, they are not stored in
+// alert_config so they always fire at critical severity
+var (
+	sosRule = models.AlertConfig{
+		AlertType: models.AlertTypeSOS,
+		Source:    models.AlertSourceVehicle,
+		Field:     models.FieldSOS,
+		Operator:  models.AlertOperatorIsTrue,
+		Severity:  models.AlertSeverityCritical,
+	}
+	immobilizerRule = models.AlertConfig{
+		AlertType: models.AlertTypeImmobilizer,
+		Source:    models.AlertSourceVehicle,
+		Field:     models.FieldImmobilized,
+		Operator:  models.AlertOperatorIsTrue,
+		Severity:  models.AlertSeverityCritical,
+	}
+	doorOpenMovingRule = models.AlertConfig{
+		AlertType:      models.AlertTypeDoorOpenMoving,
+		Source:         models.AlertSourceVehicle,
+		Field:          RuleFieldAnyDoorOpen,
+		Operator:       models.AlertOperatorIsTrue,
+		Severity:       models.AlertSeverityCritical,
+		OnlyWhenMoving: true,
+	}
+)
+
+// stateAlert reports whether alertType is raised by DetectStateTransitions
+// rather than by the rule engine
+func stateAlert(alertType string) bool {
+	switch alertType {
+	case models.AlertTypeSOS, models.AlertTypeImmobilizer, models.AlertTypeDoorOpenMoving:
+		return true
+	default:
+		return false
+	}
+}
+
+type stateFlag struct {
+	field     string
+	on, off   string
+	value     func(models.VehicleSnapshot) bool
+	alertRule *models.AlertConfig
+}
+
+var stateFlags = []stateFlag{
+	{field: models.FieldSOS, on: models.VehicleStateSOSPressed, off: models.VehicleStateSOSReleased,
+		value: func(s models.VehicleSnapshot) bool { return s.SOS }, alertRule: &sosRule},
+	{field: models.FieldImmobilized, on: models.VehicleStateImmobilized, off: models.VehicleStateMobilized,
+		value: func(s models.VehicleSnapshot) bool { return s.Immobilized }, alertRule: &immobilizerRule},
+	{field: models.FieldAC, on: models.VehicleStateACOn, off: models.VehicleStateACOff,
+		value: func(s models.VehicleSnapshot) bool { return s.AC }},
+	{field: models.FieldDoor1, on: models.VehicleStateDoorOpened, off: models.VehicleStateDoorClosed,
+		value: func(s models.VehicleSnapshot) bool { return s.Door1 }},
+	{field: models.FieldDoor2, on: models.VehicleStateDoorOpened, off: models.VehicleStateDoorClosed,
+		value: func(s models.VehicleSnapshot) bool { return s.Door2 }},
+	{field: models.FieldDoor3, on: models.VehicleStateDoorOpened, off: models.VehicleStateDoorClosed,
+		value: func(s models.VehicleSnapshot) bool { return s.Door3 }},
+	{field: models.FieldDoor4, on: models.VehicleStateDoorOpened, off: models.VehicleStateDoorClosed,
+		value: func(s models.VehicleSnapshot) bool { return s.Door4 }},
+}
+
+// DetectStateTransitions compares two snapshots of a vehicle and returns the
+// flags that changed together with the alert results they raise. A flag is
+// only compared when both snapshots parsed it, a missing value is no change.
+//
+// SOS and the immobilizer fire when switched on and clear when switched off,
+// a door opened while the vehicle moves fires until every door is closed.
+func DetectStateTransitions(vehicleNo string, prev, current models.VehicleSnapshot) ([]models.VehicleStateEvent, []RuleResult) {
+	events := []models.VehicleStateEvent{}
+	results := []RuleResult{}
+	at := current.FixTime()
+	moving := current.Running || current.Speed > 0
+
+	doorOpened, doorClosed := false, false
+	for _, flag := range stateFlags {
+		if !prev.Valid(flag.field) || !current.Valid(flag.field) {
+			continue
+		}
+
+		from, to := flag.value(prev), flag.value(current)
+		if from == to {
+			continue
+		}
+
+		event := models.VehicleStateEvent{
+			VehicleNo: vehicleNo,
+			Event:     flag.off,
+			Field:     flag.field,
+			From:      from,
+			To:        to,
+			Moving:    moving,
+			Speed:     current.Speed,
+			Latitude:  current.Latitude,
+			Longitude: current.Longitude,
+			Time:      at,
+		}
+		if to {
+			event.Event = flag.on
+		}
+		events = append(events, event)
+
+		if flag.alertRule != nil {
+			results = append(results, stateResult(*flag.alertRule, vehicleNo, to, at))
+		}
+		if flag.on == models.VehicleStateDoorOpened {
+			doorOpened = doorOpened || to
+			doorClosed = doorClosed || !to
+		}
+	}
+
+	anyDoorOpen, known := vehicleFieldValue(current, RuleFieldAnyDoorOpen)
+	switch {
+	case doorOpened && moving:
+		events = append(events, models.VehicleStateEvent{
+			VehicleNo: vehicleNo,
+			Event:     models.VehicleStateDoorOpenedMoving,
+			Field:     RuleFieldAnyDoorOpen,
+			To:        true,
+			Moving:    true,
+			Speed:     current.Speed,
+			Latitude:  current.Latitude,
+			Longitude: current.Longitude,
+			Time:      at,
+		})
+		results = append(results, stateResult(doorOpenMovingRule, vehicleNo, true, at))
+	case doorClosed && known && anyDoorOpen == 0:
+		// closing the last door clears a door alert that may still be open
+		results = append(results, stateResult(doorOpenMovingRule, vehicleNo, false, at))
+	}
+
+	return events, results
+}
+
+func stateResult(rule models.AlertConfig, vehicleNo string, on bool, at time.Time) RuleResult {
+	result := RuleResult{
+		Rule:        rule,
+		SubjectType: models.AlertSourceVehicle,
+		SubjectId:   vehicleNo,
+		Value:       boolValue(on),
+		Time:        at,
+		Status:      RuleCleared,
+	}
+	if on {
+		result.Status = RuleFired
+	}
+	return result
+}